@@ -10,9 +10,11 @@ import (
 	"time"
 
 	"github.com/CodeBoy2006/EasyProxyPool/internal/config"
+	"github.com/CodeBoy2006/EasyProxyPool/internal/geoip"
 	"github.com/CodeBoy2006/EasyProxyPool/internal/logging"
 	"github.com/CodeBoy2006/EasyProxyPool/internal/orchestrator"
 	"github.com/CodeBoy2006/EasyProxyPool/internal/pool"
+	"github.com/CodeBoy2006/EasyProxyPool/internal/routing"
 	"github.com/CodeBoy2006/EasyProxyPool/internal/server/admin"
 	"github.com/CodeBoy2006/EasyProxyPool/internal/server/httpproxy"
 	"github.com/CodeBoy2006/EasyProxyPool/internal/server/socks5proxy"
@@ -41,9 +43,94 @@ func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
-	mainPool := pool.New("pool", logger)
+	breaker := pool.BreakerConfig{
+		FailureThreshold:    cfg.Selection.CircuitBreaker.FailureThreshold,
+		HalfOpenMaxRequests: *cfg.Selection.CircuitBreaker.HalfOpenMaxRequests,
+	}
+	newPool := func(name string) *pool.Pool {
+		p := pool.New(name, logger)
+		p.SetMaxConcurrent(cfg.Selection.MaxConcurrent)
+		p.SetBreaker(breaker)
+		p.SetMaxDestinationPairs(cfg.Selection.DestinationHealth.MaxPairs)
+		minAnonymity, _ := pool.ParseAnonymity(cfg.Selection.MinAnonymity)
+		p.SetAttributeFilter(pool.AttributeFilter{
+			DedupByEgressIP: cfg.Selection.DedupByEgressIP,
+			MinAnonymity:    minAnonymity,
+			AllowTainted:    cfg.Selection.AllowTainted,
+			MinThroughput:   cfg.Selection.MinThroughputBytesPerSec,
+		})
+		p.SetScoring(pool.ScoringConfig{
+			Enabled:    cfg.Selection.Scoring.Enabled,
+			EjectBelow: cfg.Selection.Scoring.EjectBelow,
+			MinSamples: cfg.Selection.Scoring.MinSamples,
+		})
+		return p
+	}
+
+	// Every pool (default and named) has its own relaxed/strict pair, status and updater.
+	var named []admin.NamedPool
+	relaxedPools := map[string]*pool.Pool{}
+	strictPools := map[string]*pool.Pool{}
+	for _, name := range cfg.PoolNames() {
+		np := admin.NamedPool{Name: name, Status: orchestrator.NewStatus()}
+		if name == config.DefaultPool {
+			np.Pool = newPool("pool")
+			if cfg.StrictEnabled() {
+				np.StrictPool = newPool("strict")
+			}
+		} else {
+			np.Pool = newPool(name)
+			if cfg.StrictEnabled() {
+				np.StrictPool = newPool(name + "-strict")
+			}
+		}
+		relaxedPools[name] = np.Pool
+		strictPools[name] = np.StrictPool
+		named = append(named, np)
+	}
+	mainPool := relaxedPools[config.DefaultPool]
+	strictPool := strictPools[config.DefaultPool]
+	status := named[0].Status
+
+	leases := pool.NewLeases(pool.LeaseConfig{
+		TTL:         time.Duration(cfg.Selection.Sticky.LeaseTTLSeconds) * time.Second,
+		MaxUses:     cfg.Selection.Sticky.LeaseMaxUses,
+		MaxSessions: cfg.Selection.Sticky.LeaseMaxSessions,
+	})
+
+	router, err := routing.New(cfg.Routing)
+	if err != nil {
+		logger.Error("invalid routing rules", "err", err)
+		os.Exit(1)
+	}
+	// Routing rules name pools independently of the listener mode; strict listeners
+	// resolve them to the strict pool of the same name.
+	routingPools := func(byName map[string]*pool.Pool) map[string]*pool.Pool {
+		out := make(map[string]*pool.Pool, len(byName)+1)
+		for name, p := range byName {
+			out[name] = p
+		}
+		if strictPool != nil {
+			out["strict"] = strictPool
+		}
+		return out
+	}
+	tiers := func(byName map[string]*pool.Pool) []*pool.Pool {
+		var out []*pool.Pool
+		for _, name := range cfg.Selection.Tiers {
+			out = append(out, byName[name])
+		}
+		return out
+	}
 
-	status := orchestrator.NewStatus()
+	var geo *geoip.DB
+	if cfg.GeoIP.Enabled() {
+		geo, err = geoip.Open(cfg.GeoIP.Path, cfg.GeoIP.ASNPath)
+		if err != nil {
+			logger.Error("load geoip databases failed", "err", err)
+			os.Exit(1)
+		}
+	}
 
 	if cfg.Admin.Enabled && cfg.Admin.Addr != "" {
 		uiEnabled := cfg.Admin.UIEnabled == nil || *cfg.Admin.UIEnabled
@@ -51,29 +138,72 @@ func main() {
 		if cfg.Admin.SSEHeartbeatSeconds != nil && *cfg.Admin.SSEHeartbeatSeconds > 0 {
 			heartbeat = time.Duration(*cfg.Admin.SSEHeartbeatSeconds) * time.Second
 		}
-		adminServer := admin.New(logger, cfg.Admin.Addr, status, mainPool, admin.Options{
+		opt := admin.Options{
 			Auth:          cfg.Admin.Auth,
 			StartedAt:     startedAt,
 			UIEnabled:     uiEnabled,
 			LogBuffer:     logBuf,
 			MaxSSEClients: cfg.Admin.SSEMaxClients,
 			SSEHeartbeat:  heartbeat,
-		})
+			StrictPool:    strictPool,
+			Leases:        leases,
+		}
+		if len(named) > 1 {
+			opt.Pools = named
+		}
+		adminServer := admin.New(logger, cfg.Admin.Addr, status, mainPool, opt)
 		adminServer.Start(ctx)
 	}
 
-	updater := orchestrator.NewUpdater(logger, cfg, mainPool, status)
-	updater.Start(ctx)
+	var updaters []*orchestrator.Updater
+	for _, np := range named {
+		pcfg := cfg.ForPool(np.Name)
+		if np.Name == config.DefaultPool && !pcfg.HasSources() {
+			continue
+		}
+		log := logger
+		if np.Name != config.DefaultPool {
+			log = logger.With("pool", np.Name)
+		}
+		updater := orchestrator.NewUpdater(log, pcfg, np.Pool, np.StrictPool, np.Status)
+		updater.SetGeoIP(geo)
+		updater.Start(ctx)
+		updaters = append(updaters, updater)
+	}
 
-	var socks *socks5proxy.Server
-	var httpSrv *httpproxy.Server
+	var socksServers []*socks5proxy.Server
+	var httpServers []*httpproxy.Server
 	if cfg.Ports.SOCKS5Relaxed != "" {
-		socks = socks5proxy.New(logger, cfg.Ports.SOCKS5Relaxed, socks5proxy.ModeRelaxed, mainPool, cfg.Auth, cfg.Selection)
+		socks := socks5proxy.New(logger, cfg.Ports.SOCKS5Relaxed, socks5proxy.ModeRelaxed, mainPool, cfg.Auth, cfg.Selection)
+		socks.SetRouting(router, routingPools(relaxedPools))
+		socks.SetTiers(tiers(relaxedPools))
+		socks.SetLeases(leases)
 		socks.Start(ctx)
+		socksServers = append(socksServers, socks)
 	}
 	if cfg.Ports.HTTPRelaxed != "" {
-		httpSrv = httpproxy.New(logger, cfg.Ports.HTTPRelaxed, httpproxy.ModeRelaxed, mainPool, cfg.Auth, cfg.Selection)
+		httpSrv := httpproxy.New(logger, cfg.Ports.HTTPRelaxed, httpproxy.ModeRelaxed, mainPool, cfg.Auth, cfg.Selection)
+		httpSrv.SetRouting(router, routingPools(relaxedPools))
+		httpSrv.SetTiers(tiers(relaxedPools))
+		httpSrv.SetLeases(leases)
 		httpSrv.Start(ctx)
+		httpServers = append(httpServers, httpSrv)
+	}
+	if cfg.Ports.SOCKS5Strict != "" {
+		socks := socks5proxy.New(logger, cfg.Ports.SOCKS5Strict, socks5proxy.ModeStrict, strictPool, cfg.Auth, cfg.Selection)
+		socks.SetRouting(router, routingPools(strictPools))
+		socks.SetTiers(tiers(strictPools))
+		socks.SetLeases(leases)
+		socks.Start(ctx)
+		socksServers = append(socksServers, socks)
+	}
+	if cfg.Ports.HTTPStrict != "" {
+		httpSrv := httpproxy.New(logger, cfg.Ports.HTTPStrict, httpproxy.ModeStrict, strictPool, cfg.Auth, cfg.Selection)
+		httpSrv.SetRouting(router, routingPools(strictPools))
+		httpSrv.SetTiers(tiers(strictPools))
+		httpSrv.SetLeases(leases)
+		httpSrv.Start(ctx)
+		httpServers = append(httpServers, httpSrv)
 	}
 
 	<-ctx.Done()
@@ -81,11 +211,13 @@ func main() {
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	updater.Stop(shutdownCtx)
-	if socks != nil {
+	for _, updater := range updaters {
+		updater.Stop(shutdownCtx)
+	}
+	for _, socks := range socksServers {
 		socks.Stop(shutdownCtx)
 	}
-	if httpSrv != nil {
+	for _, httpSrv := range httpServers {
 		httpSrv.Stop(shutdownCtx)
 	}
 }
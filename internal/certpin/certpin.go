@@ -0,0 +1,21 @@
+// Package certpin parses certificate pins: base64 SHA-256 hashes of a
+// certificate's SubjectPublicKeyInfo.
+package certpin
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// Parse decodes a base64 SHA-256 SPKI pin, optionally prefixed with "sha256/".
+func Parse(pin string) ([sha256.Size]byte, error) {
+	var h [sha256.Size]byte
+	b, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(strings.TrimSpace(pin), "sha256/"))
+	if err != nil || len(b) != sha256.Size {
+		return h, fmt.Errorf("invalid pin %q (use base64 SHA-256 of the SubjectPublicKeyInfo)", pin)
+	}
+	copy(h[:], b)
+	return h, nil
+}
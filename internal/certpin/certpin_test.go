@@ -0,0 +1,24 @@
+package certpin
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	want := sha256.Sum256([]byte("spki"))
+	enc := base64.StdEncoding.EncodeToString(want[:])
+
+	for _, pin := range []string{enc, "sha256/" + enc, " " + enc + " "} {
+		got, err := Parse(pin)
+		if err != nil || got != want {
+			t.Fatalf("Parse(%q) = %x, %v", pin, got, err)
+		}
+	}
+	for _, pin := range []string{"not-a-pin", base64.StdEncoding.EncodeToString([]byte("short"))} {
+		if _, err := Parse(pin); err == nil {
+			t.Fatalf("expected %q to be rejected", pin)
+		}
+	}
+}
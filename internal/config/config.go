@@ -2,9 +2,14 @@ package config
 
 import (
 	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"regexp"
+	"strconv"
 	"strings"
 
+	"github.com/CodeBoy2006/EasyProxyPool/internal/certpin"
 	"gopkg.in/yaml.v3"
 )
 
@@ -21,6 +26,10 @@ type Config struct {
 	Auth        AuthConfig        `yaml:"auth"`
 	Admin       AdminConfig       `yaml:"admin"`
 	Selection   SelectionConfig   `yaml:"selection"`
+	Snapshot    SnapshotConfig    `yaml:"snapshot"`
+	SourceCache SourceCacheConfig `yaml:"source_cache"`
+	Routing     RoutingConfig     `yaml:"routing"`
+	GeoIP       GeoIPConfig       `yaml:"geoip"`
 
 	Adapters AdaptersConfig `yaml:"adapters"`
 }
@@ -33,6 +42,20 @@ type SourceConfig struct {
 
 	URL  string `yaml:"url"`
 	Path string `yaml:"path"`
+
+	// Name is exposed as the "source" label of the upstreams loaded from this source.
+	Name string `yaml:"name"`
+	// Labels are attached to every upstream loaded from this source and can be used
+	// to filter selection (e.g. X-EasyProxyPool-Select: tier=premium).
+	Labels map[string]string `yaml:"labels"`
+	// Pool assigns the source to a named pool with its own updater.
+	// Default: default
+	Pool string `yaml:"pool"`
+	// RefreshIntervalMinutes is how often the source is re-fetched, independently
+	// of the pool refresh; in between, its last successful result is reused. The
+	// pool is refreshed early only when a re-fetch returns different entries.
+	// Default: 0 (every pool refresh)
+	RefreshIntervalMinutes int `yaml:"refresh_interval_minutes"`
 }
 
 type HealthCheckConfig struct {
@@ -40,6 +63,114 @@ type HealthCheckConfig struct {
 	TLSHandshakeThresholdSeconds int    `yaml:"tls_handshake_threshold_seconds"`
 	TargetAddress                string `yaml:"target_address"`
 	TargetServerName             string `yaml:"target_server_name"`
+
+	// PublishBatchSize is the number of healthy upstreams published to the pool at
+	// once while a legacy refresh is still checking the rest; pending results are
+	// also published every second. Default: 100
+	PublishBatchSize int `yaml:"publish_batch_size"`
+
+	// UpstreamBudgetSeconds bounds the total time spent on one upstream per refresh:
+	// the health check plus the optional egress IP, anonymity, TLS interception and
+	// throughput checks. Checks still running when it expires fail and keep their
+	// previous result. Default: 3 × total_timeout_seconds
+	UpstreamBudgetSeconds int `yaml:"upstream_budget_seconds"`
+
+	// EgressIPURL is an echo endpoint (e.g. https://api.ipify.org) fetched through
+	// each healthy upstream to discover its egress IP. Empty disables discovery.
+	EgressIPURL string `yaml:"egress_ip_url"`
+
+	// AnonymityURL is a header-echo endpoint (e.g. http://httpbin.org/get) fetched
+	// through each healthy upstream to classify it as transparent, anonymous or
+	// elite. Use plain http so intermediaries can inject headers. Empty disables it.
+	AnonymityURL string `yaml:"anonymity_url"`
+
+	// Probes replaces the single TLS handshake to target_address with a set of
+	// probes. Empty keeps the TLS handshake.
+	Probes HealthProbesConfig `yaml:"probes"`
+
+	// TLSInterception flags upstreams that intercept TLS as tainted.
+	TLSInterception TLSInterceptionConfig `yaml:"tls_interception"`
+
+	// Throughput measures each healthy upstream's download rate.
+	Throughput ThroughputConfig `yaml:"throughput"`
+
+	// History keeps per-address check results across legacy refreshes and backs
+	// off checking addresses that keep failing.
+	History HealthHistoryConfig `yaml:"history"`
+}
+
+type HealthHistoryConfig struct {
+	// Size is the number of recent results kept per address. Default: 20
+	Size int `yaml:"size"`
+	// BackoffAfter is the number of consecutive failed checks after which an
+	// address is skipped for one update interval, doubling with every further
+	// failure up to max_backoff_minutes. 0 checks every address on every refresh.
+	// Default: 3
+	BackoffAfter *int `yaml:"backoff_after"`
+	// MaxBackoffMinutes caps the skip period. Default: 240
+	MaxBackoffMinutes int `yaml:"max_backoff_minutes"`
+}
+
+type ThroughputConfig struct {
+	// URL is downloaded through every healthy upstream. Empty disables the probe.
+	URL string `yaml:"url"`
+	// MaxBytes caps how much of URL is read. Default: 1048576
+	MaxBytes int64 `yaml:"max_bytes"`
+	// TimeoutSeconds bounds each download. Default: total_timeout_seconds
+	TimeoutSeconds int `yaml:"timeout_seconds"`
+}
+
+// TLSInterceptionConfig compares the certificates presented through each upstream
+// with configured pins or, without pins, with those presented to a direct
+// connection. Mismatching upstreams are tainted and not selected unless
+// selection.allow_tainted is set.
+type TLSInterceptionConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Address is the TLS endpoint (host:port) checked. Default: target_address
+	Address string `yaml:"address"`
+	// ServerName is the SNI. Default: target_server_name when Address is defaulted,
+	// otherwise the host of Address
+	ServerName string `yaml:"server_name"`
+	// Pins are base64 SHA-256 hashes of the SubjectPublicKeyInfo of any certificate
+	// in the expected chain, optionally prefixed with "sha256/".
+	Pins []string `yaml:"pins"`
+}
+
+// HealthProbesConfig runs every target through the upstream; the upstream is
+// healthy when at least Require of them pass. Its latency is the mean latency of
+// the passing probes.
+type HealthProbesConfig struct {
+	// Require is the number of targets that must pass (N of M). Default: all
+	Require int `yaml:"require"`
+
+	Targets []ProbeConfig `yaml:"targets"`
+}
+
+type ProbeConfig struct {
+	// Type supports:
+	// - tcp: connect to Address
+	// - tls: TLS handshake with Address (certificate verified on STRICT checks)
+	// - http: GET URL and check the response
+	Type string `yaml:"type"`
+
+	// Address is host:port for tcp and tls probes.
+	Address string `yaml:"address"`
+	// ServerName is the TLS SNI. Default: the host of Address
+	ServerName string `yaml:"server_name"`
+
+	// URL is the http(s) URL for http probes.
+	URL string `yaml:"url"`
+	// ExpectStatus lists accepted status codes. Default: any 2xx
+	ExpectStatus []int `yaml:"expect_status"`
+	// BodyContains and BodyRegex must both match the body when set.
+	BodyContains string `yaml:"body_contains"`
+	BodyRegex    string `yaml:"body_regex"`
+	// MaxBodyBytes fails responses with larger bodies. Default: 1048576
+	MaxBodyBytes int64 `yaml:"max_body_bytes"`
+
+	// MaxLatencyMS fails the probe when it takes longer.
+	// Default: tls_handshake_threshold_seconds
+	MaxLatencyMS int `yaml:"max_latency_ms"`
 }
 
 type PortsConfig struct {
@@ -101,16 +232,132 @@ type AdminAuthConfig struct {
 	AllowUnauthenticatedHealthz *bool `yaml:"allow_unauthenticated_healthz"`
 }
 
+// SnapshotConfig controls the on-disk pool snapshot used for warm restarts. The
+// snapshot is written after every update and on shutdown, and loaded at startup
+// so listeners can serve the last known pool while the first refresh runs.
+type SnapshotConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Path is the snapshot file.
+	// Default: .easyproxypool/snapshot.json
+	Path string `yaml:"path"`
+	// MaxAgeMinutes ignores snapshots older than this at startup. 0 disables the limit.
+	// Default: 0
+	MaxAgeMinutes int `yaml:"max_age_minutes"`
+}
+
+// SourceCacheConfig keeps the last good body of every fetched source URL on disk,
+// used when a later fetch fails (including after a restart). Conditional requests
+// (ETag/If-Modified-Since) are used regardless.
+type SourceCacheConfig struct {
+	// Enabled writes fetched bodies to disk. Off by default: subscription bodies
+	// often carry upstream credentials and tokens. The in-memory fallback works
+	// either way.
+	Enabled bool `yaml:"enabled"`
+	// Dir holds the cached bodies, which may contain upstream credentials (files are
+	// written with mode 0600).
+	// Default: .easyproxypool/sources
+	Dir string `yaml:"dir"`
+}
+
+// GeoIPConfig resolves upstreams to country and ASN using local MaxMind-format
+// (.mmdb) databases, e.g. GeoLite2-Country and GeoLite2-ASN. The egress IP is used
+// when known (health_check.egress_ip_url), otherwise the upstream server address.
+type GeoIPConfig struct {
+	// Path is a Country or City database. Empty disables country lookups.
+	Path string `yaml:"path"`
+	// ASNPath is an optional ASN database.
+	ASNPath string `yaml:"asn_path"`
+	// ReloadOnChange re-reads a database on the next refresh after the file changes.
+	// Default: true
+	ReloadOnChange *bool `yaml:"reload_on_change"`
+}
+
+// Enabled reports whether any GeoIP database is configured.
+func (c GeoIPConfig) Enabled() bool {
+	return strings.TrimSpace(c.Path) != "" || strings.TrimSpace(c.ASNPath) != ""
+}
+
 type SelectionConfig struct {
+	// Strategy supports:
+	// - round_robin: rotate through available upstreams
+	// - random: uniform random pick
+	// - latency_weighted: random pick weighted by inverse health-check latency
+	// - p2c_ewma: power of two choices over the EWMA of latency observed on real traffic
+	// - least_conn: fewest in-flight connections
+	// - quality: random pick weighted by the quality score (see scoring)
 	Strategy              string `yaml:"strategy"`
 	Retries               int    `yaml:"retries"`
 	FailureBackoffSeconds int    `yaml:"failure_backoff_seconds"`
 	MaxBackoffSeconds     int    `yaml:"max_backoff_seconds"`
 	RetryNonIdempotent    bool   `yaml:"retry_non_idempotent"`
 
+	// Tiers lists pool names in order of preference. Requests use the first tier with
+	// an available upstream. Default: [default]
+	Tiers []string `yaml:"tiers"`
+
+	// DedupByEgressIP keeps a single upstream per discovered egress IP (requires
+	// health_check.egress_ip_url).
+	DedupByEgressIP bool `yaml:"dedup_by_egress_ip"`
+
+	// MinAnonymity excludes upstreams classified below this level from the pools
+	// (requires health_check.anonymity_url). Unclassified upstreams are kept.
+	// Supports: transparent, anonymous, elite. Default: "" (no filter)
+	MinAnonymity string `yaml:"min_anonymity"`
+
+	// AllowTainted lets selection use upstreams flagged by
+	// health_check.tls_interception. Default: false
+	AllowTainted bool `yaml:"allow_tainted"`
+
+	// MinThroughputBytesPerSec skips upstreams whose measured download rate is lower
+	// (requires health_check.throughput.url). Unmeasured upstreams are still selected.
+	// 0 disables the threshold.
+	MinThroughputBytesPerSec int64 `yaml:"min_throughput_bytes_per_sec"`
+
+	// MaxConcurrent caps in-flight connections per upstream; saturated upstreams
+	// are skipped by non-sticky selection. 0 disables the cap.
+	MaxConcurrent int `yaml:"max_concurrent"`
+
+	CircuitBreaker CircuitBreakerConfig `yaml:"circuit_breaker"`
+
+	Scoring ScoringConfig `yaml:"scoring"`
+
+	DestinationHealth DestinationHealthConfig `yaml:"destination_health"`
+
 	Sticky StickyConfig `yaml:"sticky"`
 }
 
+// CircuitBreakerConfig controls per-upstream closed/open/half-open state. The open
+// period starts at failure_backoff_seconds and doubles up to max_backoff_seconds.
+type CircuitBreakerConfig struct {
+	// FailureThreshold is the number of consecutive failures that opens the breaker.
+	// Default: 1
+	FailureThreshold int `yaml:"failure_threshold"`
+	// HalfOpenMaxRequests limits concurrent trial requests once the open period expires.
+	// Set to 0 to readmit upstreams only via background probes.
+	// Default: 1
+	HalfOpenMaxRequests *int `yaml:"half_open_max_requests"`
+	// ProbeIntervalSeconds enables background health probes of half-open upstreams.
+	// Default: 0 (disabled)
+	ProbeIntervalSeconds int `yaml:"probe_interval_seconds"`
+}
+
+// ScoringConfig controls the continuous quality score of each upstream, computed
+// from real-traffic outcomes (dial errors, time-to-first-byte, tunnel lifetime)
+// and background re-probes between pool refreshes.
+type ScoringConfig struct {
+	// Enabled turns on background re-probing and score-based ejection.
+	Enabled bool `yaml:"enabled"`
+	// ProbeIntervalSeconds is how often every pooled upstream is re-probed.
+	// Default: 30
+	ProbeIntervalSeconds int `yaml:"probe_interval_seconds"`
+	// EjectBelow skips upstreams whose score (0-100) drops below it until re-probes
+	// or traffic raise it again. 0 disables ejection.
+	EjectBelow float64 `yaml:"eject_below"`
+	// MinSamples is the number of outcomes required before an upstream can be ejected.
+	// Default: 5
+	MinSamples int `yaml:"min_samples"`
+}
+
 type StickyConfig struct {
 	Enabled bool `yaml:"enabled"`
 	// HeaderOverride controls whether request headers can override sticky behavior.
@@ -119,6 +366,15 @@ type StickyConfig struct {
 	// - soft: try the next HRW-ranked upstream
 	// - hard: prefer staying on the top HRW-ranked upstream
 	Failover string `yaml:"failover"`
+
+	// LeaseTTLSeconds pins a session to its upstream for this long, then rotates it
+	// to another one. 0 keeps the HRW mapping until the upstream becomes unavailable.
+	LeaseTTLSeconds int `yaml:"lease_ttl_seconds"`
+	// LeaseMaxUses rotates a session after this many connections (0 = unlimited).
+	LeaseMaxUses int `yaml:"lease_max_uses"`
+	// LeaseMaxSessions bounds the lease table; the least recently used sessions
+	// are evicted first.
+	LeaseMaxSessions int `yaml:"lease_max_sessions"`
 }
 
 type AdaptersConfig struct {
@@ -147,6 +403,17 @@ type XrayConfig struct {
 
 	// If true, updater will fall back to legacy SOCKS5 list mode when xray startup/metrics fail.
 	FallbackToLegacyOnError *bool `yaml:"fallback_to_legacy_on_error"`
+
+	// Pools sets the listen addresses of the xray instances run for named pools
+	// (see sources[].pool). Every pool other than default needs its own addresses.
+	Pools map[string]XrayListenConfig `yaml:"pools"`
+}
+
+type XrayListenConfig struct {
+	SOCKSListenStrict    string `yaml:"socks_listen_strict"`
+	SOCKSListenRelaxed   string `yaml:"socks_listen_relaxed"`
+	MetricsListenStrict  string `yaml:"metrics_listen_strict"`
+	MetricsListenRelaxed string `yaml:"metrics_listen_relaxed"`
 }
 
 type ObservatoryConfig struct {
@@ -163,6 +430,61 @@ type ObservatoryConfig struct {
 	TimeoutSeconds  int `yaml:"timeout_seconds"`
 }
 
+// StrictEnabled reports whether any STRICT listener is configured. When true, a
+// second pool is maintained that only contains upstreams passing certificate-verified
+// TLS checks.
+func (c Config) StrictEnabled() bool {
+	return strings.TrimSpace(c.Ports.SOCKS5Strict) != "" || strings.TrimSpace(c.Ports.HTTPStrict) != ""
+}
+
+// DestinationHealthConfig tracks failures per (upstream, destination host) so an
+// upstream blocked by one site keeps serving others. Failures to connect to the
+// upstream itself still disable it globally.
+type DestinationHealthConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// MaxPairs bounds the (upstream, host) table.
+	// Default: 10000
+	MaxPairs int `yaml:"max_pairs"`
+	// FailureStatusCodes marks plain-HTTP responses with these status codes (e.g. 403, 429)
+	// as per-destination failures. The response is still returned to the client.
+	FailureStatusCodes []int `yaml:"failure_status_codes"`
+}
+
+// RoutingConfig holds ordered rules evaluated by the HTTP and SOCKS5 listeners.
+// The first matching rule decides how a request is served; requests matching no
+// rule use the listener's own pool.
+type RoutingConfig struct {
+	Rules []RoutingRuleConfig `yaml:"rules"`
+}
+
+// RoutingRuleConfig matches when every configured condition matches (any entry of
+// a list suffices). A rule without conditions matches every request.
+type RoutingRuleConfig struct {
+	// Name identifies the rule in logs. Default: rules[<index>]
+	Name string `yaml:"name"`
+
+	DomainSuffix  []string `yaml:"domain_suffix"`
+	DomainKeyword []string `yaml:"domain_keyword"`
+	DomainRegex   []string `yaml:"domain_regex"`
+	// CIDR matches IP destinations (IP literals, or addresses resolved by the SOCKS5 listener).
+	CIDR []string `yaml:"cidr"`
+	// Port entries are single ports ("443") or ranges ("8000-9000").
+	Port []string `yaml:"port"`
+	// Listener supports socks5_relaxed, socks5_strict, http_relaxed, http_strict.
+	Listener []string `yaml:"listener"`
+	// User matches the authenticated proxy username.
+	User []string `yaml:"user"`
+
+	// Action supports:
+	// - pool: select from Pool (default: the listener's pool), optionally limited to Labels
+	// - direct: connect without an upstream
+	// - reject: refuse the request
+	// Default: pool
+	Action string            `yaml:"action"`
+	Pool   string            `yaml:"pool"`
+	Labels map[string]string `yaml:"labels"`
+}
+
 func Load(path string) (Config, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
@@ -192,6 +514,22 @@ func applyDefaults(cfg *Config) {
 	if cfg.HealthCheck.TotalTimeoutSeconds <= 0 {
 		cfg.HealthCheck.TotalTimeoutSeconds = 8
 	}
+	if cfg.HealthCheck.History.Size <= 0 {
+		cfg.HealthCheck.History.Size = 20
+	}
+	if cfg.HealthCheck.History.BackoffAfter == nil {
+		v := 3
+		cfg.HealthCheck.History.BackoffAfter = &v
+	}
+	if cfg.HealthCheck.History.MaxBackoffMinutes <= 0 {
+		cfg.HealthCheck.History.MaxBackoffMinutes = 240
+	}
+	if cfg.HealthCheck.UpstreamBudgetSeconds <= 0 {
+		cfg.HealthCheck.UpstreamBudgetSeconds = 3 * cfg.HealthCheck.TotalTimeoutSeconds
+	}
+	if cfg.HealthCheck.PublishBatchSize <= 0 {
+		cfg.HealthCheck.PublishBatchSize = 100
+	}
 	if cfg.HealthCheck.TLSHandshakeThresholdSeconds <= 0 {
 		cfg.HealthCheck.TLSHandshakeThresholdSeconds = 5
 	}
@@ -201,6 +539,14 @@ func applyDefaults(cfg *Config) {
 	if cfg.HealthCheck.TargetServerName == "" {
 		cfg.HealthCheck.TargetServerName = "www.google.com"
 	}
+	if ti := &cfg.HealthCheck.TLSInterception; ti.Address == "" {
+		ti.Address = cfg.HealthCheck.TargetAddress
+		if ti.ServerName == "" {
+			ti.ServerName = cfg.HealthCheck.TargetServerName
+		}
+	} else if ti.ServerName == "" {
+		ti.ServerName, _, _ = net.SplitHostPort(ti.Address)
+	}
 	if cfg.Ports.SOCKS5Strict == "" {
 		cfg.Ports.SOCKS5Strict = ""
 	}
@@ -260,6 +606,25 @@ func applyDefaults(cfg *Config) {
 	if cfg.Selection.MaxBackoffSeconds <= 0 {
 		cfg.Selection.MaxBackoffSeconds = 600
 	}
+	if cfg.Selection.CircuitBreaker.FailureThreshold <= 0 {
+		cfg.Selection.CircuitBreaker.FailureThreshold = 1
+	}
+	if cfg.Selection.CircuitBreaker.HalfOpenMaxRequests == nil {
+		v := 1
+		cfg.Selection.CircuitBreaker.HalfOpenMaxRequests = &v
+	}
+	if cfg.Selection.Scoring.ProbeIntervalSeconds <= 0 {
+		cfg.Selection.Scoring.ProbeIntervalSeconds = 30
+	}
+	if cfg.Selection.Scoring.MinSamples <= 0 {
+		cfg.Selection.Scoring.MinSamples = 5
+	}
+	if cfg.Selection.DestinationHealth.MaxPairs <= 0 {
+		cfg.Selection.DestinationHealth.MaxPairs = 10000
+	}
+	if cfg.Selection.Sticky.LeaseMaxSessions <= 0 {
+		cfg.Selection.Sticky.LeaseMaxSessions = 10000
+	}
 	if cfg.Selection.Sticky.HeaderOverride == nil {
 		b := true
 		cfg.Selection.Sticky.HeaderOverride = &b
@@ -268,17 +633,35 @@ func applyDefaults(cfg *Config) {
 		cfg.Selection.Sticky.Failover = "soft"
 	}
 
+	for i := range cfg.Routing.Rules {
+		r := &cfg.Routing.Rules[i]
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("rules[%d]", i)
+		}
+		if r.Action == "" {
+			r.Action = "pool"
+		}
+	}
+
+	if cfg.Snapshot.Path == "" {
+		cfg.Snapshot.Path = ".easyproxypool/snapshot.json"
+	}
+
+	if cfg.SourceCache.Dir == "" {
+		cfg.SourceCache.Dir = ".easyproxypool/sources"
+	}
+
 	if cfg.Adapters.Xray.WorkDir == "" {
 		cfg.Adapters.Xray.WorkDir = ".easyproxypool/xray"
 	}
-	if cfg.Adapters.Xray.SOCKSListenStrict == "" {
-		cfg.Adapters.Xray.SOCKSListenStrict = ""
+	if cfg.Adapters.Xray.SOCKSListenStrict == "" && cfg.StrictEnabled() {
+		cfg.Adapters.Xray.SOCKSListenStrict = "127.0.0.1:17384"
 	}
 	if cfg.Adapters.Xray.SOCKSListenRelaxed == "" {
 		cfg.Adapters.Xray.SOCKSListenRelaxed = "127.0.0.1:17383"
 	}
-	if cfg.Adapters.Xray.MetricsListenStrict == "" {
-		cfg.Adapters.Xray.MetricsListenStrict = ""
+	if cfg.Adapters.Xray.MetricsListenStrict == "" && cfg.StrictEnabled() {
+		cfg.Adapters.Xray.MetricsListenStrict = "127.0.0.1:17388"
 	}
 	if cfg.Adapters.Xray.MetricsListenRelaxed == "" {
 		cfg.Adapters.Xray.MetricsListenRelaxed = "127.0.0.1:17387"
@@ -311,6 +694,10 @@ func applyDefaults(cfg *Config) {
 		b := true
 		cfg.Adapters.Xray.FallbackToLegacyOnError = &b
 	}
+	if cfg.GeoIP.ReloadOnChange == nil {
+		b := true
+		cfg.GeoIP.ReloadOnChange = &b
+	}
 }
 
 func validate(cfg Config) error {
@@ -320,9 +707,80 @@ func validate(cfg Config) error {
 	if cfg.HealthCheckConcurrency <= 0 {
 		return fmt.Errorf("health_check_concurrency: must be > 0")
 	}
+	for i, src := range cfg.Sources {
+		if strings.ContainsAny(src.Name, ",=") {
+			return fmt.Errorf("sources[%d].name: must not contain ',' or '='", i)
+		}
+		for k, v := range src.Labels {
+			if strings.TrimSpace(k) == "" || strings.ContainsAny(k, ",=") || strings.ContainsAny(v, ",=") {
+				return fmt.Errorf("sources[%d].labels: keys must be non-empty and keys/values must not contain ',' or '='", i)
+			}
+		}
+		if src.RefreshIntervalMinutes < 0 {
+			return fmt.Errorf("sources[%d].refresh_interval_minutes: must be >= 0", i)
+		}
+	}
 	if cfg.UpdateIntervalMinutes <= 0 {
 		return fmt.Errorf("update_interval_minutes: must be > 0")
 	}
+	if v := strings.TrimSpace(cfg.HealthCheck.EgressIPURL); v != "" {
+		u, err := url.Parse(v)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("health_check.egress_ip_url: must be an http(s) URL")
+		}
+	}
+	if cfg.Selection.DedupByEgressIP && strings.TrimSpace(cfg.HealthCheck.EgressIPURL) == "" {
+		return fmt.Errorf("selection.dedup_by_egress_ip: requires health_check.egress_ip_url")
+	}
+	if v := strings.TrimSpace(cfg.HealthCheck.AnonymityURL); v != "" {
+		u, err := url.Parse(v)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("health_check.anonymity_url: must be an http(s) URL")
+		}
+	}
+	if err := validateProbes(cfg.HealthCheck.Probes); err != nil {
+		return err
+	}
+	if ti := cfg.HealthCheck.TLSInterception; ti.Enabled {
+		if _, _, err := net.SplitHostPort(ti.Address); err != nil {
+			return fmt.Errorf("health_check.tls_interception.address: must be host:port")
+		}
+		for _, pin := range ti.Pins {
+			if _, err := certpin.Parse(pin); err != nil {
+				return fmt.Errorf("health_check.tls_interception.pins: %w", err)
+			}
+		}
+	}
+	if tp := cfg.HealthCheck.Throughput; strings.TrimSpace(tp.URL) != "" {
+		u, err := url.Parse(strings.TrimSpace(tp.URL))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("health_check.throughput.url: must be an http(s) URL")
+		}
+	}
+	if cfg.HealthCheck.Throughput.MaxBytes < 0 {
+		return fmt.Errorf("health_check.throughput.max_bytes: must be >= 0")
+	}
+	if cfg.HealthCheck.Throughput.TimeoutSeconds < 0 {
+		return fmt.Errorf("health_check.throughput.timeout_seconds: must be >= 0")
+	}
+	if b := cfg.HealthCheck.History.BackoffAfter; b != nil && *b < 0 {
+		return fmt.Errorf("health_check.history.backoff_after: must be >= 0")
+	}
+	if cfg.Selection.MinThroughputBytesPerSec < 0 {
+		return fmt.Errorf("selection.min_throughput_bytes_per_sec: must be >= 0")
+	}
+	if cfg.Selection.MinThroughputBytesPerSec > 0 && strings.TrimSpace(cfg.HealthCheck.Throughput.URL) == "" {
+		return fmt.Errorf("selection.min_throughput_bytes_per_sec: requires health_check.throughput.url")
+	}
+	switch strings.ToLower(strings.TrimSpace(cfg.Selection.MinAnonymity)) {
+	case "":
+	case "transparent", "anonymous", "elite":
+		if strings.TrimSpace(cfg.HealthCheck.AnonymityURL) == "" {
+			return fmt.Errorf("selection.min_anonymity: requires health_check.anonymity_url")
+		}
+	default:
+		return fmt.Errorf("selection.min_anonymity: unsupported %q (use transparent, anonymous or elite)", cfg.Selection.MinAnonymity)
+	}
 	switch cfg.Auth.Mode {
 	case "disabled", "basic", "shared_password":
 	default:
@@ -360,15 +818,48 @@ func validate(cfg Config) error {
 		return fmt.Errorf("admin.sse_heartbeat_seconds: must be >= 0")
 	}
 	switch cfg.Selection.Strategy {
-	case "round_robin", "random":
+	case "round_robin", "random", "latency_weighted", "p2c_ewma", "least_conn", "quality":
 	default:
-		return fmt.Errorf("selection.strategy: unsupported %q (use round_robin or random)", cfg.Selection.Strategy)
+		return fmt.Errorf("selection.strategy: unsupported %q (use round_robin, random, latency_weighted, p2c_ewma, least_conn or quality)", cfg.Selection.Strategy)
+	}
+	if cfg.Selection.MaxConcurrent < 0 {
+		return fmt.Errorf("selection.max_concurrent: must be >= 0")
+	}
+	cb := cfg.Selection.CircuitBreaker
+	if cb.HalfOpenMaxRequests != nil && *cb.HalfOpenMaxRequests < 0 {
+		return fmt.Errorf("selection.circuit_breaker.half_open_max_requests: must be >= 0")
+	}
+	if cb.ProbeIntervalSeconds < 0 {
+		return fmt.Errorf("selection.circuit_breaker.probe_interval_seconds: must be >= 0")
+	}
+	if cb.HalfOpenMaxRequests != nil && *cb.HalfOpenMaxRequests == 0 && cb.ProbeIntervalSeconds == 0 {
+		return fmt.Errorf("selection.circuit_breaker: half_open_max_requests=0 requires probe_interval_seconds > 0")
+	}
+	if sc := cfg.Selection.Scoring; sc.EjectBelow < 0 || sc.EjectBelow > 100 {
+		return fmt.Errorf("selection.scoring.eject_below: must be between 0 and 100")
 	}
 	switch cfg.Selection.Sticky.Failover {
 	case "soft", "hard":
 	default:
 		return fmt.Errorf("selection.sticky.failover: unsupported %q (use soft or hard)", cfg.Selection.Sticky.Failover)
 	}
+	if cfg.Selection.Sticky.LeaseTTLSeconds < 0 {
+		return fmt.Errorf("selection.sticky.lease_ttl_seconds: must be >= 0")
+	}
+	if cfg.Selection.Sticky.LeaseMaxUses < 0 {
+		return fmt.Errorf("selection.sticky.lease_max_uses: must be >= 0")
+	}
+	if cfg.Snapshot.MaxAgeMinutes < 0 {
+		return fmt.Errorf("snapshot.max_age_minutes: must be >= 0")
+	}
+	if err := validatePools(cfg); err != nil {
+		return err
+	}
+	for i, r := range cfg.Routing.Rules {
+		if err := validateRoutingRule(cfg, r); err != nil {
+			return fmt.Errorf("routing.rules[%d]: %w", i, err)
+		}
+	}
 
 	if cfg.Adapters.Xray.Enabled {
 		if cfg.Adapters.Xray.BinaryPath == "" {
@@ -380,6 +871,17 @@ func validate(cfg Config) error {
 		if cfg.Adapters.Xray.MetricsListenRelaxed == "" {
 			return fmt.Errorf("adapters.xray.metrics_listen_relaxed: required when adapters.xray.enabled=true")
 		}
+		if cfg.StrictEnabled() {
+			if cfg.Adapters.Xray.SOCKSListenStrict == "" {
+				return fmt.Errorf("adapters.xray.socks_listen_strict: required when strict ports are enabled")
+			}
+			if cfg.Adapters.Xray.MetricsListenStrict == "" {
+				return fmt.Errorf("adapters.xray.metrics_listen_strict: required when strict ports are enabled")
+			}
+			if cfg.Adapters.Xray.SOCKSListenStrict == cfg.Adapters.Xray.SOCKSListenRelaxed || cfg.Adapters.Xray.MetricsListenStrict == cfg.Adapters.Xray.MetricsListenRelaxed {
+				return fmt.Errorf("adapters.xray: strict and relaxed listeners must differ")
+			}
+		}
 		if cfg.Adapters.Xray.UserPassword == "" {
 			return fmt.Errorf("adapters.xray.user_password: required when adapters.xray.enabled=true")
 		}
@@ -397,3 +899,108 @@ func validate(cfg Config) error {
 	}
 	return nil
 }
+
+func validateProbes(pc HealthProbesConfig) error {
+	if pc.Require < 0 || pc.Require > len(pc.Targets) {
+		return fmt.Errorf("health_check.probes.require: must be between 0 and the number of targets")
+	}
+	for i, t := range pc.Targets {
+		field := fmt.Sprintf("health_check.probes.targets[%d]", i)
+		switch strings.ToLower(strings.TrimSpace(t.Type)) {
+		case "tcp", "tls":
+			if _, _, err := net.SplitHostPort(strings.TrimSpace(t.Address)); err != nil {
+				return fmt.Errorf("%s.address: must be host:port", field)
+			}
+		case "http":
+			u, err := url.Parse(strings.TrimSpace(t.URL))
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("%s.url: must be an http(s) URL", field)
+			}
+			if t.BodyRegex != "" {
+				if _, err := regexp.Compile(t.BodyRegex); err != nil {
+					return fmt.Errorf("%s.body_regex: %w", field, err)
+				}
+			}
+			for _, code := range t.ExpectStatus {
+				if code < 100 || code > 599 {
+					return fmt.Errorf("%s.expect_status: invalid status code %d", field, code)
+				}
+			}
+		default:
+			return fmt.Errorf("%s.type: unsupported %q (use tcp, tls or http)", field, t.Type)
+		}
+		if t.MaxBodyBytes < 0 {
+			return fmt.Errorf("%s.max_body_bytes: must be >= 0", field)
+		}
+		if t.MaxLatencyMS < 0 {
+			return fmt.Errorf("%s.max_latency_ms: must be >= 0", field)
+		}
+	}
+	return nil
+}
+
+func validateRoutingRule(cfg Config, r RoutingRuleConfig) error {
+	switch r.Action {
+	case "pool":
+		switch r.Pool {
+		case "", DefaultPool:
+		case "strict":
+			if !cfg.StrictEnabled() {
+				return fmt.Errorf("pool: strict requires a strict listener")
+			}
+		default:
+			if !cfg.hasPool(r.Pool) {
+				return fmt.Errorf("pool: unknown pool %q (use default, strict or a pool named in sources)", r.Pool)
+			}
+		}
+	case "direct", "reject":
+		if r.Pool != "" || len(r.Labels) > 0 {
+			return fmt.Errorf("pool/labels: only allowed with action=pool")
+		}
+	default:
+		return fmt.Errorf("action: unsupported %q (use pool, direct or reject)", r.Action)
+	}
+	for _, re := range r.DomainRegex {
+		if _, err := regexp.Compile(re); err != nil {
+			return fmt.Errorf("domain_regex: %w", err)
+		}
+	}
+	for _, c := range r.CIDR {
+		if _, _, err := net.ParseCIDR(strings.TrimSpace(c)); err != nil {
+			return fmt.Errorf("cidr: %w", err)
+		}
+	}
+	for _, p := range r.Port {
+		if _, _, err := ParsePortRange(p); err != nil {
+			return fmt.Errorf("port: %w", err)
+		}
+	}
+	for _, l := range r.Listener {
+		switch l {
+		case "socks5_relaxed", "socks5_strict", "http_relaxed", "http_strict":
+		default:
+			return fmt.Errorf("listener: unsupported %q (use socks5_relaxed, socks5_strict, http_relaxed or http_strict)", l)
+		}
+	}
+	return nil
+}
+
+// ParsePortRange parses "443" or "8000-9000" into an inclusive range.
+func ParsePortRange(s string) (int, int, error) {
+	s = strings.TrimSpace(s)
+	lo, hi, isRange := strings.Cut(s, "-")
+	from, err := strconv.Atoi(strings.TrimSpace(lo))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid port %q", s)
+	}
+	to := from
+	if isRange {
+		if to, err = strconv.Atoi(strings.TrimSpace(hi)); err != nil {
+			return 0, 0, fmt.Errorf("invalid port range %q", s)
+		}
+	}
+	if from < 1 || to > 65535 || from > to {
+		return 0, 0, fmt.Errorf("invalid port range %q", s)
+	}
+	return from, to, nil
+}
@@ -0,0 +1,129 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultPool receives proxy_list_urls and sources without a pool.
+const DefaultPool = "default"
+
+func sourcePool(src SourceConfig) string {
+	if p := strings.TrimSpace(src.Pool); p != "" {
+		return p
+	}
+	return DefaultPool
+}
+
+// PoolNames returns the default pool followed by the named pools referenced by
+// sources, in order of first appearance.
+func (c Config) PoolNames() []string {
+	names := []string{DefaultPool}
+	seen := map[string]struct{}{DefaultPool: {}}
+	for _, src := range c.Sources {
+		p := sourcePool(src)
+		if _, ok := seen[p]; ok {
+			continue
+		}
+		seen[p] = struct{}{}
+		names = append(names, p)
+	}
+	return names
+}
+
+func (c Config) hasPool(name string) bool {
+	for _, n := range c.PoolNames() {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// HasSources reports whether the config has anything to load.
+func (c Config) HasSources() bool {
+	return len(c.ProxyListURLs) > 0 || len(c.Sources) > 0
+}
+
+// ForPool returns the config seen by the updater of the named pool: only its own
+// sources, and per-pool snapshot path and xray work dir/listeners.
+func (c Config) ForPool(name string) Config {
+	out := c
+	out.Sources = nil
+	for _, src := range c.Sources {
+		if sourcePool(src) == name {
+			out.Sources = append(out.Sources, src)
+		}
+	}
+	if name == DefaultPool {
+		return out
+	}
+
+	out.ProxyListURLs = nil
+	ext := filepath.Ext(c.Snapshot.Path)
+	out.Snapshot.Path = strings.TrimSuffix(c.Snapshot.Path, ext) + "-" + name + ext
+	out.Adapters.Xray.WorkDir = filepath.Join(c.Adapters.Xray.WorkDir, name)
+	if l, ok := c.Adapters.Xray.Pools[name]; ok {
+		out.Adapters.Xray.SOCKSListenRelaxed = l.SOCKSListenRelaxed
+		out.Adapters.Xray.MetricsListenRelaxed = l.MetricsListenRelaxed
+		out.Adapters.Xray.SOCKSListenStrict = l.SOCKSListenStrict
+		out.Adapters.Xray.MetricsListenStrict = l.MetricsListenStrict
+	}
+	return out
+}
+
+func validatePools(cfg Config) error {
+	names := cfg.PoolNames()
+	for _, n := range names {
+		if n == "strict" || strings.ContainsAny(n, " /,=") {
+			return fmt.Errorf("sources[].pool: invalid pool name %q", n)
+		}
+	}
+	for _, t := range cfg.Selection.Tiers {
+		if !cfg.hasPool(t) {
+			return fmt.Errorf("selection.tiers: unknown pool %q (pools: %s)", t, strings.Join(names, ", "))
+		}
+	}
+	if !cfg.ForPool(DefaultPool).HasSources() {
+		inTiers := false
+		for _, t := range cfg.Selection.Tiers {
+			inTiers = inTiers || t != DefaultPool
+		}
+		if !inTiers {
+			return fmt.Errorf("selection.tiers: required when the default pool has no sources")
+		}
+	}
+
+	if !cfg.Adapters.Xray.Enabled {
+		return nil
+	}
+	used := map[string]string{}
+	claim := func(pool, addr string) error {
+		if addr == "" {
+			return nil
+		}
+		if other, ok := used[addr]; ok {
+			return fmt.Errorf("adapters.xray.pools: listener %s used by both %s and %s", addr, other, pool)
+		}
+		used[addr] = pool
+		return nil
+	}
+	for _, n := range names {
+		pc := cfg.ForPool(n).Adapters.Xray
+		if n != DefaultPool {
+			if _, ok := cfg.Adapters.Xray.Pools[n]; !ok || pc.SOCKSListenRelaxed == "" || pc.MetricsListenRelaxed == "" {
+				return fmt.Errorf("adapters.xray.pools.%s: socks_listen_relaxed and metrics_listen_relaxed are required", n)
+			}
+			if cfg.StrictEnabled() && (pc.SOCKSListenStrict == "" || pc.MetricsListenStrict == "") {
+				return fmt.Errorf("adapters.xray.pools.%s: socks_listen_strict and metrics_listen_strict are required when strict ports are enabled", n)
+			}
+		}
+		for _, addr := range []string{pc.SOCKSListenRelaxed, pc.MetricsListenRelaxed, pc.SOCKSListenStrict, pc.MetricsListenStrict} {
+			if err := claim(n, addr); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package fetcher
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// cacheMeta holds the validators of a cached body. It is stored next to the body
+// as <key>.json.
+type cacheMeta struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	FetchedAt    time.Time `json:"fetched_at"`
+}
+
+type cacheEntry struct {
+	meta cacheMeta
+	data []byte
+}
+
+// cached returns the last good body of url from memory, or from the disk cache
+// after a restart; nil when there is none.
+func (f *Fetcher) cached(url string) *cacheEntry {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if e, ok := f.cache[url]; ok {
+		return e
+	}
+	if f.cacheDir == "" {
+		return nil
+	}
+	e, err := readCacheEntry(f.cacheDir, url)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			f.log.Warn("read source cache failed", "url", url, "err", err)
+		}
+		return nil
+	}
+	f.cache[url] = e
+	return e
+}
+
+// store remembers e as the last good body of url and writes it to the disk cache.
+// A revalidated body (304) only rewrites the metadata.
+func (f *Fetcher) store(url string, e *cacheEntry, revalidated bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.cache[url] = e
+	if f.cacheDir == "" {
+		return
+	}
+	var err error
+	if revalidated {
+		err = writeCacheMeta(f.cacheDir, url, e.meta)
+	} else {
+		err = writeCacheEntry(f.cacheDir, url, e)
+	}
+	if err != nil {
+		f.log.Warn("write source cache failed", "url", url, "err", err)
+	}
+}
+
+// cacheKey names the cache files of url.
+func cacheKey(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return hex.EncodeToString(sum[:16])
+}
+
+func readCacheEntry(dir, url string) (*cacheEntry, error) {
+	base := filepath.Join(dir, cacheKey(url))
+	raw, err := os.ReadFile(base + ".json")
+	if err != nil {
+		return nil, err
+	}
+	var meta cacheMeta
+	if err := json.Unmarshal(raw, &meta); err != nil {
+		return nil, err
+	}
+	if meta.URL != url {
+		return nil, fs.ErrNotExist
+	}
+	data, err := os.ReadFile(base + ".body")
+	if err != nil {
+		return nil, err
+	}
+	return &cacheEntry{meta: meta, data: data}, nil
+}
+
+// writeCacheEntry writes the body before its metadata, each via a temporary file
+// and rename, so a crash never pairs metadata with a partial body.
+func writeCacheEntry(dir, url string, e *cacheEntry) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(dir, cacheKey(url))+".body", e.data); err != nil {
+		return err
+	}
+	return writeCacheMeta(dir, url, e.meta)
+}
+
+// writeCacheMeta writes the metadata of url, leaving its body as is.
+func writeCacheMeta(dir, url string, meta cacheMeta) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	raw, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(dir, cacheKey(url))+".json", raw)
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -2,19 +2,40 @@ package fetcher
 
 import (
 	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
+// maxBodyBytes bounds a (decompressed) source body.
+const maxBodyBytes = 64 << 20
+
 type Fetcher struct {
 	log    *slog.Logger
 	client *http.Client
+
+	// cacheDir keeps the last good body per URL on disk; empty disables it.
+	cacheDir string
+
+	mu    sync.Mutex
+	cache map[string]*cacheEntry
+	// lists holds the status of each URL of Fetch; listOrder lists the URLs of
+	// the last call.
+	lists     map[string]ListStatus
+	listOrder []string
 }
 
 func New(log *slog.Logger) *Fetcher {
@@ -26,35 +47,234 @@ func New(log *slog.Logger) *Fetcher {
 				TLSClientConfig: &tls.Config{
 					InsecureSkipVerify: true,
 				},
+				// Compression is negotiated and decoded in Get (gzip and deflate).
+				DisableCompression: true,
 			},
 		},
+		cache: make(map[string]*cacheEntry),
+		lists: make(map[string]ListStatus),
+	}
+}
+
+// SetCacheDir stores the last good body of every URL under dir, so Get can fall
+// back to it after a restart. An empty dir keeps the cache in memory only.
+func (f *Fetcher) SetCacheDir(dir string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.cacheDir = dir
+}
+
+// Body is a fetched response body.
+type Body struct {
+	Data []byte
+	// FetchedAt is when Data was last downloaded or revalidated from the remote.
+	FetchedAt time.Time
+	// Stale is the fetch error when the remote failed and Data is the cached body.
+	Stale error
+
+	meta        cacheMeta
+	revalidated bool
+}
+
+// Get downloads url, sending the validators of the cached body (ETag,
+// Last-Modified) so an unchanged list costs a 304. When the fetch fails, the last
+// good body is returned with Stale set; the error is only returned when nothing
+// is cached.
+//
+// A downloaded body is not cached until the caller has parsed it and passes it to
+// Commit, so an error page served with status 200 cannot replace the last good
+// body.
+func (f *Fetcher) Get(ctx context.Context, url string) (Body, error) {
+	cached := f.cached(url)
+
+	data, meta, err := f.download(ctx, url, cached)
+	if err != nil {
+		return f.Fallback(url, err)
+	}
+	revalidated := data == nil
+	if revalidated {
+		// 304 Not Modified.
+		data = cached.data
+	}
+	meta.FetchedAt = time.Now()
+	return Body{Data: data, FetchedAt: meta.FetchedAt, meta: meta, revalidated: revalidated}, nil
+}
+
+// Commit caches b, a body of url returned by Get that parsed into at least one
+// entry, as the last good body. Cached bodies (Stale set) are left alone.
+func (f *Fetcher) Commit(url string, b Body) {
+	if b.Stale != nil || b.meta.URL == "" {
+		return
+	}
+	f.store(url, &cacheEntry{meta: b.meta, data: b.Data}, b.revalidated)
+}
+
+// Fallback returns the last good body of url with Stale set to err, for a fetch
+// that failed or returned a body that could not be used. err is returned when
+// nothing is cached.
+func (f *Fetcher) Fallback(url string, err error) (Body, error) {
+	cached := f.cached(url)
+	if cached == nil {
+		return Body{}, err
+	}
+	f.log.Warn("fetch failed; using cached body", "url", url, "err", err, "age", time.Since(cached.meta.FetchedAt).Round(time.Second).String())
+	return Body{Data: cached.data, FetchedAt: cached.meta.FetchedAt, Stale: err}, nil
+}
+
+// download fetches url. It returns nil data for a 304 response to the validators
+// of cached.
+func (f *Fetcher) download(ctx context.Context, url string, cached *cacheEntry) ([]byte, cacheMeta, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, cacheMeta{}, fmt.Errorf("build request: %w", err)
 	}
+	req.Header.Set("Accept-Encoding", "gzip, deflate")
+	if cached != nil {
+		if cached.meta.ETag != "" {
+			req.Header.Set("If-None-Match", cached.meta.ETag)
+		}
+		if cached.meta.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.meta.LastModified)
+		}
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, cacheMeta{}, fmt.Errorf("fetch: %w", err)
+	}
+	defer resp.Body.Close()
+
+	meta := cacheMeta{URL: url, ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified")}
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		if meta.ETag == "" {
+			meta.ETag = cached.meta.ETag
+		}
+		if meta.LastModified == "" {
+			meta.LastModified = cached.meta.LastModified
+		}
+		return nil, meta, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, cacheMeta{}, fmt.Errorf("unexpected status: %d", resp.StatusCode)
+	}
+	data, err := readBody(resp)
+	if err != nil {
+		return nil, cacheMeta{}, fmt.Errorf("read body: %w", err)
+	}
+	return data, meta, nil
+}
+
+// readBody reads the response body, decoding gzip or deflate content encodings.
+func readBody(resp *http.Response) ([]byte, error) {
+	var r io.Reader = resp.Body
+	switch enc := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding"))); enc {
+	case "", "identity":
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	case "deflate":
+		// "deflate" is zlib-wrapped per RFC 9110, but some servers send raw DEFLATE.
+		raw, err := io.ReadAll(io.LimitReader(resp.Body, maxBodyBytes))
+		if err != nil {
+			return nil, err
+		}
+		if zr, err := zlib.NewReader(bytes.NewReader(raw)); err == nil {
+			defer zr.Close()
+			r = zr
+		} else {
+			fr := flate.NewReader(bytes.NewReader(raw))
+			defer fr.Close()
+			r = fr
+		}
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %q", enc)
+	}
+	data, err := io.ReadAll(io.LimitReader(r, maxBodyBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxBodyBytes {
+		return nil, fmt.Errorf("body exceeds %d bytes", maxBodyBytes)
+	}
+	return data, nil
+}
+
+// ListStatus reports the last fetch of one URL passed to Fetch.
+type ListStatus struct {
+	URL string
+	// Err is the fetch error; with a cached body CachedAt is set and the cached
+	// body was used.
+	Err         error
+	LastAttempt time.Time
+	LastSuccess time.Time
+	CachedAt    time.Time
+	// Entries is the number of new entries the list contributed.
+	Entries int
+}
+
+// ListStatus returns the status of every URL of the last Fetch, in order.
+func (f *Fetcher) ListStatus() []ListStatus {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := make([]ListStatus, 0, len(f.listOrder))
+	for _, url := range f.listOrder {
+		out = append(out, f.lists[url])
+	}
+	return out
+}
+
+// recordList updates the status of url after a fetch.
+func (f *Fetcher) recordList(st ListStatus) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if st.Err != nil {
+		st.LastSuccess = f.lists[st.URL].LastSuccess
+	}
+	f.lists[st.URL] = st
 }
 
 func (f *Fetcher) Fetch(ctx context.Context, urls []string) ([]string, error) {
 	set := make(map[string]struct{})
 	var out []string
 
+	f.mu.Lock()
+	f.listOrder = append([]string(nil), urls...)
+	f.mu.Unlock()
+
 	f.log.Info("fetching proxy lists", "sources", len(urls))
 	for _, url := range urls {
-		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-		if err != nil {
-			f.log.Warn("build request failed", "url", url, "err", err)
-			continue
-		}
-
-		resp, err := f.client.Do(req)
+		st := ListStatus{URL: url, LastAttempt: time.Now()}
+		body, err := f.Get(ctx, url)
 		if err != nil {
 			f.log.Warn("fetch failed", "url", url, "err", err)
+			st.Err = err
+			f.recordList(st)
 			continue
 		}
-		if resp.StatusCode != http.StatusOK {
-			resp.Body.Close()
-			f.log.Warn("unexpected status", "url", url, "status", resp.StatusCode)
-			continue
+		if body.Stale == nil {
+			if countHostPorts(body.Data) == 0 {
+				// Likely an error page served with status 200; keep the last good body.
+				body, err = f.Fallback(url, errors.New("no host:port entries in the response"))
+				if err != nil {
+					f.log.Warn("fetch failed", "url", url, "err", err)
+					st.Err = err
+					f.recordList(st)
+					continue
+				}
+			} else {
+				f.Commit(url, body)
+			}
+		}
+		st.Err = body.Stale
+		st.CachedAt = body.FetchedAt
+		if body.Stale == nil {
+			st.LastSuccess = body.FetchedAt
 		}
 
-		scanner := bufio.NewScanner(resp.Body)
+		scanner := bufio.NewScanner(bytes.NewReader(body.Data))
 		added := 0
 		for scanner.Scan() {
 			line := strings.TrimSpace(scanner.Text())
@@ -75,8 +295,9 @@ func (f *Fetcher) Fetch(ctx context.Context, urls []string) ([]string, error) {
 		if err := scanner.Err(); err != nil {
 			f.log.Warn("scan failed", "url", url, "err", err)
 		}
-		resp.Body.Close()
-		f.log.Info("fetched entries", "url", url, "added", added)
+		st.Entries = added
+		f.recordList(st)
+		f.log.Info("fetched entries", "url", url, "added", added, "cached", body.Stale != nil)
 	}
 
 	if len(out) == 0 {
@@ -85,22 +306,29 @@ func (f *Fetcher) Fetch(ctx context.Context, urls []string) ([]string, error) {
 	return out, nil
 }
 
+// FetchBytes returns the body of url, or its cached body if the fetch fails
+// (see Get).
 func (f *Fetcher) FetchBytes(ctx context.Context, url string) ([]byte, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	body, err := f.Get(ctx, url)
 	if err != nil {
-		return nil, fmt.Errorf("build request: %w", err)
-	}
-	resp, err := f.client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("fetch: %w", err)
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status: %d", resp.StatusCode)
+		return nil, err
 	}
-	data, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("read body: %w", err)
+	return body.Data, nil
+}
+
+// countHostPorts returns the number of lines of a proxy list that are host:port
+// addresses.
+func countHostPorts(data []byte) int {
+	n := 0
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimPrefix(strings.TrimSpace(line), "socks5://")
+		_, port, err := net.SplitHostPort(line)
+		if err != nil {
+			continue
+		}
+		if _, err := strconv.Atoi(port); err == nil {
+			n++
+		}
 	}
-	return data, nil
+	return n
 }
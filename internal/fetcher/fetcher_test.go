@@ -0,0 +1,206 @@
+package fetcher
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+func TestGet_ConditionalRequests(t *testing.T) {
+	var hits, notModified atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write([]byte("1.1.1.1:1080\n"))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	f := New(nilLogger())
+	f.SetCacheDir(dir)
+	first, err := f.Get(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	f.Commit(srv.URL, first)
+	// A 304 only rewrites the metadata; the body on disk is left as is.
+	bodyPath := filepath.Join(dir, cacheKey(srv.URL)+".body")
+	if err := os.WriteFile(bodyPath, []byte("marker"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	second, err := f.Get(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if notModified.Load() != 1 || hits.Load() != 2 {
+		t.Fatalf("expected the second request to be conditional, got %d hits, %d not modified", hits.Load(), notModified.Load())
+	}
+	if string(second.Data) != "1.1.1.1:1080\n" || second.Stale != nil || second.FetchedAt.Before(first.FetchedAt) {
+		t.Fatalf("expected the cached body to be revalidated, got %+v", second)
+	}
+	f.Commit(srv.URL, second)
+	if b, err := os.ReadFile(bodyPath); err != nil || string(b) != "marker" {
+		t.Fatalf("expected the body file to be left as is, got %q (%v)", b, err)
+	}
+}
+
+func TestGet_DecodesCompressedBodies(t *testing.T) {
+	const body = "1.1.1.1:1080\n2.2.2.2:1080\n"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var buf bytes.Buffer
+		switch r.URL.Path {
+		case "/gzip":
+			zw := gzip.NewWriter(&buf)
+			_, _ = zw.Write([]byte(body))
+			_ = zw.Close()
+			w.Header().Set("Content-Encoding", "gzip")
+		case "/deflate":
+			zw := zlib.NewWriter(&buf)
+			_, _ = zw.Write([]byte(body))
+			_ = zw.Close()
+			w.Header().Set("Content-Encoding", "deflate")
+		}
+		_, _ = w.Write(buf.Bytes())
+	}))
+	defer srv.Close()
+
+	f := New(nilLogger())
+	for _, path := range []string{"/gzip", "/deflate"} {
+		got, err := f.FetchBytes(context.Background(), srv.URL+path)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", path, err)
+		}
+		if string(got) != body {
+			t.Fatalf("%s: expected the decoded body, got %q", path, got)
+		}
+	}
+}
+
+func TestGet_FallsBackToDiskCache(t *testing.T) {
+	var fail atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail.Load() == 1 {
+			http.Error(w, "down", http.StatusBadGateway)
+			return
+		}
+		_, _ = w.Write([]byte("1.1.1.1:1080\n"))
+	}))
+	defer srv.Close()
+
+	dir := filepath.Join(t.TempDir(), "sources")
+	f := New(nilLogger())
+	f.SetCacheDir(dir)
+	first, err := f.Get(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	f.Commit(srv.URL, first)
+	fi, err := os.Stat(filepath.Join(dir, cacheKey(srv.URL)+".body"))
+	if err != nil {
+		t.Fatalf("expected the body on disk: %v", err)
+	}
+	if fi.Mode().Perm() != 0o600 {
+		t.Fatalf("expected mode 0600, got %v", fi.Mode().Perm())
+	}
+
+	// A new fetcher (as after a restart) serves the disk copy while the remote is down.
+	fail.Store(1)
+	f = New(nilLogger())
+	f.SetCacheDir(dir)
+	got, err := f.Get(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(got.Data) != "1.1.1.1:1080\n" || got.Stale == nil || !got.FetchedAt.Equal(first.FetchedAt) {
+		t.Fatalf("expected the stale cached body, got %+v", got)
+	}
+
+	// Without a cache, the failure is returned.
+	if _, err := New(nilLogger()).Get(context.Background(), srv.URL); err == nil {
+		t.Fatalf("expected an error without a cached body")
+	}
+}
+
+func TestFetch_ReportsListStatus(t *testing.T) {
+	var fail atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail.Load() == 1 {
+			http.Error(w, "down", http.StatusBadGateway)
+			return
+		}
+		_, _ = w.Write([]byte("1.1.1.1:1080\n2.2.2.2:1080\n"))
+	}))
+	defer srv.Close()
+
+	f := New(nilLogger())
+	if _, err := f.Fetch(context.Background(), []string{srv.URL}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	st := f.ListStatus()
+	if len(st) != 1 || st[0].Err != nil || st[0].Entries != 2 || st[0].LastSuccess.IsZero() {
+		t.Fatalf("expected a successful fetch, got %+v", st)
+	}
+	ok := st[0].LastSuccess
+
+	// A failure served from the cache is reported with the error and the age of
+	// the cached body.
+	fail.Store(1)
+	addrs, err := f.Fetch(context.Background(), []string{srv.URL})
+	if err != nil || len(addrs) != 2 {
+		t.Fatalf("expected the cached entries, got %v (%v)", addrs, err)
+	}
+	st = f.ListStatus()
+	if len(st) != 1 || st[0].Err == nil || !st[0].LastSuccess.Equal(ok) || st[0].CachedAt.After(ok) || st[0].Entries != 2 {
+		t.Fatalf("expected a stale fetch, got %+v", st)
+	}
+}
+
+func TestFetch_KeepsLastGoodBodyOnUnparseableResponse(t *testing.T) {
+	var portal atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if portal.Load() == 1 {
+			_, _ = w.Write([]byte("<html><body>Sign in to the network</body></html>\n"))
+			return
+		}
+		_, _ = w.Write([]byte("1.1.1.1:1080\n"))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	f := New(nilLogger())
+	f.SetCacheDir(dir)
+	if _, err := f.Fetch(context.Background(), []string{srv.URL}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// A 200 response without entries is served from the cache and not cached.
+	portal.Store(1)
+	addrs, err := f.Fetch(context.Background(), []string{srv.URL})
+	if err != nil || len(addrs) != 1 || addrs[0] != "1.1.1.1:1080" {
+		t.Fatalf("expected the cached entries, got %v (%v)", addrs, err)
+	}
+	if st := f.ListStatus(); len(st) != 1 || st[0].Err == nil {
+		t.Fatalf("expected the list to be reported degraded, got %+v", st)
+	}
+	if b, err := os.ReadFile(filepath.Join(dir, cacheKey(srv.URL)+".body")); err != nil || string(b) != "1.1.1.1:1080\n" {
+		t.Fatalf("expected the last good body on disk, got %q (%v)", b, err)
+	}
+}
+
+func nilLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
@@ -0,0 +1,161 @@
+// Package geoip resolves IP addresses to country and autonomous system using
+// local MaxMind-format (.mmdb) databases, without network access or external
+// dependencies.
+package geoip
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Info is what the databases know about an address. Zero fields are unknown.
+type Info struct {
+	Country string `json:"country,omitempty"`
+	ASN     uint   `json:"asn,omitempty"`
+	ASOrg   string `json:"as_org,omitempty"`
+}
+
+// DB is a set of .mmdb files consulted in order; the first file that knows a
+// field wins. It is safe for concurrent use. A nil *DB resolves nothing.
+type DB struct {
+	mu    sync.RWMutex
+	files []*file
+}
+
+type file struct {
+	path    string
+	modTime time.Time
+	size    int64
+	r       *reader
+}
+
+// Open loads the databases at paths. Empty paths are ignored.
+func Open(paths ...string) (*DB, error) {
+	db := &DB{}
+	for _, p := range paths {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+		f, err := load(p)
+		if err != nil {
+			return nil, err
+		}
+		db.files = append(db.files, f)
+	}
+	return db, nil
+}
+
+func load(path string) (*file, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("geoip: %w", err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("geoip: %w", err)
+	}
+	r, err := newReader(b)
+	if err != nil {
+		return nil, fmt.Errorf("geoip: %s: %w", path, err)
+	}
+	return &file{path: path, modTime: fi.ModTime(), size: fi.Size(), r: r}, nil
+}
+
+// Reload re-reads every database whose modification time or size changed and
+// returns the paths that were reloaded. A file that fails to load keeps its
+// previous contents; the first such error is returned.
+func (db *DB) Reload() ([]string, error) {
+	if db == nil {
+		return nil, nil
+	}
+	db.mu.RLock()
+	files := append([]*file(nil), db.files...)
+	db.mu.RUnlock()
+
+	var (
+		reloaded []string
+		firstErr error
+	)
+	for i, f := range files {
+		fi, err := os.Stat(f.path)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("geoip: %w", err)
+			}
+			continue
+		}
+		if fi.ModTime().Equal(f.modTime) && fi.Size() == f.size {
+			continue
+		}
+		nf, err := load(f.path)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		files[i] = nf
+		reloaded = append(reloaded, f.path)
+	}
+	if len(reloaded) > 0 {
+		db.mu.Lock()
+		db.files = files
+		db.mu.Unlock()
+	}
+	return reloaded, firstErr
+}
+
+// Lookup resolves ip. Lookup errors in one database do not hide answers from
+// the others.
+func (db *DB) Lookup(ip net.IP) Info {
+	var info Info
+	if db == nil || ip == nil {
+		return info
+	}
+	db.mu.RLock()
+	files := db.files
+	db.mu.RUnlock()
+
+	for _, f := range files {
+		v, err := f.r.lookup(ip)
+		if err != nil || v == nil {
+			continue
+		}
+		rec, ok := v.(map[string]any)
+		if !ok {
+			continue
+		}
+		if info.Country == "" {
+			info.Country = countryOf(rec)
+		}
+		if info.ASN == 0 {
+			info.ASN = uint(asUint(rec["autonomous_system_number"]))
+		}
+		if info.ASOrg == "" {
+			info.ASOrg, _ = rec["autonomous_system_organization"].(string)
+		}
+	}
+	return info
+}
+
+// countryOf reads the ISO code from a Country/City style record, preferring
+// the country the address is located in over the one it is registered to.
+func countryOf(rec map[string]any) string {
+	for _, k := range []string{"country", "registered_country"} {
+		m, _ := rec[k].(map[string]any)
+		if code, _ := m["iso_code"].(string); code != "" {
+			return strings.ToUpper(code)
+		}
+	}
+	// Flat layouts (e.g. ipinfo/DB-IP lite exports).
+	for _, k := range []string{"country_code", "country"} {
+		if code, _ := rec[k].(string); code != "" {
+			return strings.ToUpper(code)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,287 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// mmdbWriter builds minimal IPv6 databases for tests.
+type mmdbWriter struct {
+	// recordSize is 24, 28 or 32 bits.
+	recordSize int
+	// nodes hold child references: >0 is a node index, 0 is empty, <0 is
+	// -(data offset + 1).
+	nodes [][2]int
+	data  bytes.Buffer
+}
+
+func newMMDBWriter() *mmdbWriter {
+	return &mmdbWriter{recordSize: 24, nodes: make([][2]int, 1)}
+}
+
+// insert maps cidr to rec. Prefixes must not overlap.
+func (w *mmdbWriter) insert(t *testing.T, cidr string, rec map[string]any) {
+	t.Helper()
+	_, n, err := net.ParseCIDR(cidr)
+	if err != nil {
+		t.Fatalf("ParseCIDR: %v", err)
+	}
+	ones, _ := n.Mask.Size()
+	ip := n.IP.To16()
+	if n.IP.To4() != nil {
+		ip = append(make(net.IP, 12), n.IP.To4()...)
+		ones += 96
+	}
+	off := w.data.Len()
+	writeValue(&w.data, rec)
+
+	node := 0
+	for i := 0; i < ones; i++ {
+		bit := int(ip[i/8]>>(7-uint(i%8))) & 1
+		if i == ones-1 {
+			w.nodes[node][bit] = -(off + 1)
+			break
+		}
+		next := w.nodes[node][bit]
+		if next <= 0 {
+			w.nodes = append(w.nodes, [2]int{})
+			next = len(w.nodes) - 1
+			w.nodes[node][bit] = next
+		}
+		node = next
+	}
+}
+
+func (w *mmdbWriter) bytes() []byte {
+	var out bytes.Buffer
+	count := len(w.nodes)
+	for _, n := range w.nodes {
+		var rec [2]int
+		for i, ref := range n {
+			rec[i] = count
+			switch {
+			case ref > 0:
+				rec[i] = ref
+			case ref < 0:
+				rec[i] = count + dataSectionSeparator + (-ref - 1)
+			}
+		}
+		l, r := rec[0], rec[1]
+		switch w.recordSize {
+		case 24:
+			out.Write([]byte{byte(l >> 16), byte(l >> 8), byte(l), byte(r >> 16), byte(r >> 8), byte(r)})
+		case 28:
+			out.Write([]byte{byte(l >> 16), byte(l >> 8), byte(l), byte(l>>24)<<4 | byte(r>>24)&0x0F, byte(r >> 16), byte(r >> 8), byte(r)})
+		default:
+			_ = binary.Write(&out, binary.BigEndian, [2]uint32{uint32(l), uint32(r)})
+		}
+	}
+	out.Write(make([]byte, dataSectionSeparator))
+	out.Write(w.data.Bytes())
+	out.Write(metadataMarker)
+	writeValue(&out, map[string]any{
+		"node_count":    uint32(count),
+		"record_size":   uint16(w.recordSize),
+		"ip_version":    uint16(6),
+		"database_type": "Test",
+	})
+	return out.Bytes()
+}
+
+func writeCtrl(b *bytes.Buffer, typ, size int) {
+	var extra []byte
+	sizeBits := size
+	switch {
+	case size >= 65821:
+		n := size - 65821
+		sizeBits, extra = 31, []byte{byte(n >> 16), byte(n >> 8), byte(n)}
+	case size >= 285:
+		n := size - 285
+		sizeBits, extra = 30, []byte{byte(n >> 8), byte(n)}
+	case size >= 29:
+		sizeBits, extra = 29, []byte{byte(size - 29)}
+	}
+	if typ > 7 {
+		b.WriteByte(byte(sizeBits))
+		b.WriteByte(byte(typ - 7))
+	} else {
+		b.WriteByte(byte(typ<<5 | sizeBits))
+	}
+	b.Write(extra)
+}
+
+// writeValue encodes strings, uint16/uint32 and maps.
+func writeValue(b *bytes.Buffer, v any) {
+	switch v := v.(type) {
+	case string:
+		writeCtrl(b, typeString, len(v))
+		b.WriteString(v)
+	case uint16:
+		writeCtrl(b, typeUint16, 2)
+		_ = binary.Write(b, binary.BigEndian, v)
+	case uint32:
+		writeCtrl(b, typeUint32, 4)
+		_ = binary.Write(b, binary.BigEndian, v)
+	case map[string]any:
+		writeCtrl(b, typeMap, len(v))
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			writeValue(b, k)
+			writeValue(b, v[k])
+		}
+	default:
+		panic("unsupported test value")
+	}
+}
+
+func writeDB(t *testing.T, path string, w *mmdbWriter) {
+	t.Helper()
+	if err := os.WriteFile(path, w.bytes(), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+}
+
+func TestDB_Lookup(t *testing.T) {
+	dir := t.TempDir()
+
+	country := newMMDBWriter()
+	country.insert(t, "203.0.113.0/24", map[string]any{
+		"country": map[string]any{"iso_code": "us"},
+	})
+	country.insert(t, "198.51.100.0/25", map[string]any{
+		"registered_country": map[string]any{"iso_code": "DE"},
+	})
+	country.insert(t, "2001:db8::/32", map[string]any{
+		"country": map[string]any{"iso_code": "JP"},
+	})
+	asn := newMMDBWriter()
+	asn.insert(t, "203.0.112.0/23", map[string]any{
+		"autonomous_system_number":       uint32(64500),
+		"autonomous_system_organization": "Example Net",
+	})
+	writeDB(t, filepath.Join(dir, "country.mmdb"), country)
+	writeDB(t, filepath.Join(dir, "asn.mmdb"), asn)
+
+	db, err := Open(filepath.Join(dir, "country.mmdb"), "", filepath.Join(dir, "asn.mmdb"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+
+	cases := []struct {
+		ip   string
+		want Info
+	}{
+		{ip: "203.0.113.9", want: Info{Country: "US", ASN: 64500, ASOrg: "Example Net"}},
+		{ip: "203.0.112.1", want: Info{ASN: 64500, ASOrg: "Example Net"}},
+		{ip: "198.51.100.1", want: Info{Country: "DE"}},
+		{ip: "198.51.100.200", want: Info{}},
+		{ip: "2001:db8::1", want: Info{Country: "JP"}},
+		{ip: "2001:db9::1", want: Info{}},
+	}
+	for _, c := range cases {
+		if got := db.Lookup(net.ParseIP(c.ip)); got != c.want {
+			t.Fatalf("%s: got %+v want %+v", c.ip, got, c.want)
+		}
+	}
+
+	var nilDB *DB
+	if got := nilDB.Lookup(net.ParseIP("203.0.113.9")); got != (Info{}) {
+		t.Fatalf("nil db: got %+v", got)
+	}
+}
+
+func TestDB_RecordSizesAndLongStrings(t *testing.T) {
+	// Organization names long enough to need the two- and three-byte size
+	// encodings (285+ and 65821+ bytes).
+	org2 := strings.Repeat("a", 285+0x1234)
+	org3 := strings.Repeat("b", 65821+0x0102)
+
+	for _, size := range []int{24, 28, 32} {
+		t.Run(strconv.Itoa(size), func(t *testing.T) {
+			w := newMMDBWriter()
+			w.recordSize = size
+			w.insert(t, "203.0.113.0/24", map[string]any{
+				"autonomous_system_number":       uint32(64500),
+				"autonomous_system_organization": org2,
+			})
+			w.insert(t, "198.51.100.0/24", map[string]any{
+				"autonomous_system_number":       uint32(64501),
+				"autonomous_system_organization": org3,
+			})
+			path := filepath.Join(t.TempDir(), "asn.mmdb")
+			writeDB(t, path, w)
+
+			db, err := Open("", "", path)
+			if err != nil {
+				t.Fatalf("Open: %v", err)
+			}
+			cases := []struct {
+				ip   string
+				want Info
+			}{
+				{ip: "203.0.113.9", want: Info{ASN: 64500, ASOrg: org2}},
+				{ip: "198.51.100.1", want: Info{ASN: 64501, ASOrg: org3}},
+				{ip: "192.0.2.1", want: Info{}},
+			}
+			for _, c := range cases {
+				got := db.Lookup(net.ParseIP(c.ip))
+				if got != c.want {
+					t.Fatalf("%s: got ASN %d, org of %d bytes; want ASN %d, org of %d bytes",
+						c.ip, got.ASN, len(got.ASOrg), c.want.ASN, len(c.want.ASOrg))
+				}
+			}
+		})
+	}
+}
+
+func TestDB_ReloadOnChange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "country.mmdb")
+	w := newMMDBWriter()
+	w.insert(t, "203.0.113.0/24", map[string]any{"country": map[string]any{"iso_code": "US"}})
+	writeDB(t, path, w)
+
+	db, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if reloaded, err := db.Reload(); err != nil || len(reloaded) != 0 {
+		t.Fatalf("unchanged reload: %v, %v", reloaded, err)
+	}
+
+	w = newMMDBWriter()
+	w.insert(t, "203.0.113.0/24", map[string]any{"country": map[string]any{"iso_code": "NL"}})
+	writeDB(t, path, w)
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, future, future); err != nil {
+		t.Fatalf("Chtimes: %v", err)
+	}
+	if reloaded, err := db.Reload(); err != nil || len(reloaded) != 1 {
+		t.Fatalf("reload: %v, %v", reloaded, err)
+	}
+	if got := db.Lookup(net.ParseIP("203.0.113.9")).Country; got != "NL" {
+		t.Fatalf("country after reload: %q", got)
+	}
+
+	// A broken replacement keeps the previous data.
+	if err := os.WriteFile(path, []byte("garbage"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if _, err := db.Reload(); err == nil {
+		t.Fatalf("expected reload error for a broken file")
+	}
+	if got := db.Lookup(net.ParseIP("203.0.113.9")).Country; got != "NL" {
+		t.Fatalf("country after failed reload: %q", got)
+	}
+}
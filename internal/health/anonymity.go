@@ -0,0 +1,122 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/CodeBoy2006/EasyProxyPool/internal/pool"
+	"golang.org/x/net/proxy"
+)
+
+// forwardingHeaders are request headers that intermediaries add to pass on the
+// client's address; proxyHeaders only announce that a proxy is involved.
+var (
+	forwardingHeaders = []string{"forwarded", "x-forwarded-for", "x-real-ip", "x-client-ip", "client-ip"}
+	proxyHeaders      = []string{"via", "x-proxy-id", "proxy-connection", "x-bluecoat-via", "x-forwarded-host"}
+)
+
+// SetAnonymityURL enables anonymity classification via a header-echo endpoint
+// that returns the request headers it received (e.g. http://httpbin.org/get).
+// A plain-http URL lets intermediaries inject headers. An empty url disables it.
+func (c *Checker) SetAnonymityURL(url string) {
+	c.anonymityURL = strings.TrimSpace(url)
+}
+
+// AnonymityEnabled reports whether a header-echo endpoint is configured.
+func (c *Checker) AnonymityEnabled() bool {
+	return c.anonymityURL != ""
+}
+
+// PublicIP returns this host's own public IP, fetched without an upstream from
+// the egress IP echo endpoint if configured, else from the header-echo endpoint
+// (which must then report the caller's IP as "ip" or "origin").
+func (c *Checker) PublicIP(ctx context.Context) (string, error) {
+	url := c.egressURL
+	if url == "" {
+		url = c.anonymityURL
+	}
+	if url == "" {
+		return "", errors.New("no echo endpoint configured")
+	}
+	body, err := c.fetch(ctx, url, "", nil, false)
+	if err != nil {
+		return "", err
+	}
+	return parseEgressIP(body)
+}
+
+// Anonymity fetches the header-echo endpoint through the upstream and classifies
+// what it reveals. publicIP is this host's own address (see PublicIP); when it is
+// empty, forwarding headers are assumed to leak it.
+func (c *Checker) Anonymity(ctx context.Context, upstreamAddr string, auth *proxy.Auth, strict bool, publicIP string) (pool.Anonymity, error) {
+	if c.anonymityURL == "" {
+		return "", errors.New("anonymity check disabled")
+	}
+	body, err := c.fetch(ctx, c.anonymityURL, upstreamAddr, auth, strict)
+	if err != nil {
+		return "", err
+	}
+	return classifyAnonymity(body, publicIP), nil
+}
+
+// classifyAnonymity classifies a header-echo response: transparent if it contains
+// publicIP (or, with publicIP unknown, a forwarding header), anonymous if it
+// contains any proxy header, elite otherwise.
+func classifyAnonymity(body []byte, publicIP string) pool.Anonymity {
+	if publicIP != "" && containsIP(string(body), publicIP) {
+		return pool.AnonymityTransparent
+	}
+	lower := strings.ToLower(string(body))
+	if hasHeader(lower, forwardingHeaders) {
+		if publicIP == "" {
+			return pool.AnonymityTransparent
+		}
+		return pool.AnonymityAnonymous
+	}
+	if hasHeader(lower, proxyHeaders) {
+		return pool.AnonymityAnonymous
+	}
+	return pool.AnonymityElite
+}
+
+// hasHeader reports whether the lowercased echo response s mentions any of names,
+// either as a JSON key ("via": ...) or as a raw header line (via: ...).
+func hasHeader(s string, names []string) bool {
+	lines := strings.Split(s, "\n")
+	for _, name := range names {
+		if strings.Contains(s, `"`+name+`"`) {
+			return true
+		}
+		for _, line := range lines {
+			if strings.HasPrefix(strings.TrimSpace(line), name+":") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// containsIP reports whether s contains ip as a whole token, so 1.2.3.4 does not
+// match inside 11.2.3.45.
+func containsIP(s, ip string) bool {
+	if net.ParseIP(ip) == nil {
+		return false
+	}
+	for i := 0; ; {
+		j := strings.Index(s[i:], ip)
+		if j < 0 {
+			return false
+		}
+		start, end := i+j, i+j+len(ip)
+		if (start == 0 || !isIPChar(s[start-1])) && (end == len(s) || !isIPChar(s[end])) {
+			return true
+		}
+		i = start + 1
+	}
+}
+
+func isIPChar(c byte) bool {
+	return c == '.' || c == ':' || (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
@@ -0,0 +1,60 @@
+package health
+
+import (
+	"testing"
+
+	"github.com/CodeBoy2006/EasyProxyPool/internal/pool"
+)
+
+func TestClassifyAnonymity(t *testing.T) {
+	cases := []struct {
+		name     string
+		body     string
+		publicIP string
+		want     pool.Anonymity
+	}{
+		{
+			name:     "elite",
+			body:     `{"headers":{"Host":"httpbin.org","User-Agent":"Go-http-client/1.1"},"origin":"203.0.113.7"}`,
+			publicIP: "198.51.100.1",
+			want:     pool.AnonymityElite,
+		},
+		{
+			name:     "via_is_anonymous",
+			body:     `{"headers":{"Host":"httpbin.org","Via":"1.1 squid"},"origin":"203.0.113.7"}`,
+			publicIP: "198.51.100.1",
+			want:     pool.AnonymityAnonymous,
+		},
+		{
+			name:     "forwarded_other_ip_is_anonymous",
+			body:     `{"headers":{"X-Forwarded-For":"10.0.0.1"},"origin":"203.0.113.7"}`,
+			publicIP: "198.51.100.1",
+			want:     pool.AnonymityAnonymous,
+		},
+		{
+			name:     "public_ip_is_transparent",
+			body:     `{"headers":{"Host":"httpbin.org"},"origin":"198.51.100.1, 203.0.113.7"}`,
+			publicIP: "198.51.100.1",
+			want:     pool.AnonymityTransparent,
+		},
+		{
+			name:     "raw_headers",
+			body:     "Host: example.com\nX-Real-IP: 198.51.100.1\n",
+			publicIP: "",
+			want:     pool.AnonymityTransparent,
+		},
+		{
+			name:     "ip_prefix_is_not_a_match",
+			body:     `{"origin":"198.51.100.12"}`,
+			publicIP: "198.51.100.1",
+			want:     pool.AnonymityElite,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := classifyAnonymity([]byte(c.body), c.publicIP); got != c.want {
+				t.Fatalf("got %q want %q", got, c.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/proxy"
+)
+
+// maxEgressBody bounds the echo endpoint response.
+const maxEgressBody = 4 << 10
+
+// SetEgressIPURL enables egress IP discovery via an echo endpoint that returns the
+// caller's IP, either as plain text (e.g. https://api.ipify.org) or as JSON with an
+// "ip" or "origin" field. An empty url disables discovery.
+func (c *Checker) SetEgressIPURL(url string) {
+	c.egressURL = strings.TrimSpace(url)
+}
+
+// EgressIPEnabled reports whether an echo endpoint is configured.
+func (c *Checker) EgressIPEnabled() bool {
+	return c.egressURL != ""
+}
+
+// EgressIP fetches the echo endpoint through the upstream and returns the IP the
+// destination sees. strict enforces certificate verification.
+func (c *Checker) EgressIP(ctx context.Context, upstreamAddr string, auth *proxy.Auth, strict bool) (string, error) {
+	if c.egressURL == "" {
+		return "", errors.New("egress ip discovery disabled")
+	}
+	body, err := c.fetch(ctx, c.egressURL, upstreamAddr, auth, strict)
+	if err != nil {
+		return "", err
+	}
+	return parseEgressIP(body)
+}
+
+// fetch GETs url through the SOCKS5 upstream at upstreamAddr, or directly when
+// upstreamAddr is empty, and returns the first maxEgressBody bytes of a 200
+// response. strict enforces certificate verification.
+func (c *Checker) fetch(ctx context.Context, url, upstreamAddr string, auth *proxy.Auth, strict bool) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.totalTimeout)
+	defer cancel()
+
+	var d proxy.ContextDialer = &net.Dialer{}
+	if upstreamAddr != "" {
+		var err error
+		if d, err = socksDialer(upstreamAddr, auth); err != nil {
+			return nil, err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpClient(d, strict).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("echo endpoint: status %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxEgressBody))
+}
+
+// parseEgressIP extracts the IP from a plain-text or JSON echo response.
+func parseEgressIP(body []byte) (string, error) {
+	s := strings.TrimSpace(string(body))
+	if strings.HasPrefix(s, "{") {
+		var v struct {
+			IP     string `json:"ip"`
+			Origin string `json:"origin"`
+		}
+		if err := json.Unmarshal(body, &v); err != nil {
+			return "", fmt.Errorf("echo endpoint: %w", err)
+		}
+		s = v.IP
+		if s == "" {
+			// httpbin reports "client, proxy" chains in origin; the first hop is the egress.
+			s, _, _ = strings.Cut(v.Origin, ",")
+		}
+		s = strings.TrimSpace(s)
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return "", fmt.Errorf("echo endpoint: no ip in response %q", truncate(s, 64))
+	}
+	return ip.String(), nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
@@ -0,0 +1,23 @@
+package health
+
+import "testing"
+
+func TestParseEgressIP(t *testing.T) {
+	cases := []struct {
+		body string
+		want string
+		ok   bool
+	}{
+		{body: "203.0.113.7\n", want: "203.0.113.7", ok: true},
+		{body: `{"ip":"2001:db8::1"}`, want: "2001:db8::1", ok: true},
+		{body: `{"origin":"203.0.113.7, 198.51.100.1"}`, want: "203.0.113.7", ok: true},
+		{body: "<html>blocked</html>", ok: false},
+		{body: `{"ip":""}`, ok: false},
+	}
+	for _, c := range cases {
+		got, err := parseEgressIP([]byte(c.body))
+		if c.ok != (err == nil) || got != c.want {
+			t.Fatalf("%q: got %q, %v", c.body, got, err)
+		}
+	}
+}
@@ -3,7 +3,9 @@ package health
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"log/slog"
+	"net/http"
 	"time"
 
 	"golang.org/x/net/proxy"
@@ -15,6 +17,16 @@ type Checker struct {
 	serverName   string
 	totalTimeout time.Duration
 	threshold    time.Duration
+
+	egressURL    string
+	anonymityURL string
+	intercept    *interception
+	throughput   *throughputProbe
+
+	// targets and require are set by SetProbes; without targets a TLS handshake
+	// with targetAddr is the only probe.
+	targets []Target
+	require int
 }
 
 func New(log *slog.Logger, targetAddr, serverName string, totalTimeout, threshold time.Duration) *Checker {
@@ -28,52 +40,42 @@ func New(log *slog.Logger, targetAddr, serverName string, totalTimeout, threshol
 }
 
 func (c *Checker) Check(ctx context.Context, upstreamAddr string, strict bool) (bool, time.Duration) {
+	return c.CheckAuth(ctx, upstreamAddr, nil, strict)
+}
+
+// CheckAuth is like Check but authenticates to the upstream (e.g. xray per-node accounts).
+func (c *Checker) CheckAuth(ctx context.Context, upstreamAddr string, auth *proxy.Auth, strict bool) (bool, time.Duration) {
 	ctx, cancel := context.WithTimeout(ctx, c.totalTimeout)
 	defer cancel()
 
-	dialer, err := proxy.SOCKS5("tcp", upstreamAddr, nil, proxy.Direct)
+	d, err := socksDialer(upstreamAddr, auth)
 	if err != nil {
 		return false, 0
 	}
+	return c.runTargets(ctx, d, strict)
+}
 
-	type result struct {
-		ok      bool
-		latency time.Duration
+// socksDialer returns a dialer through the SOCKS5 upstream at upstreamAddr.
+func socksDialer(upstreamAddr string, auth *proxy.Auth) (proxy.ContextDialer, error) {
+	dialer, err := proxy.SOCKS5("tcp", upstreamAddr, auth, proxy.Direct)
+	if err != nil {
+		return nil, err
 	}
-	done := make(chan result, 1)
-
-	go func() {
-		start := time.Now()
-		conn, err := dialer.Dial("tcp", c.targetAddr)
-		if err != nil {
-			done <- result{ok: false}
-			return
-		}
-		defer conn.Close()
-
-		tlsConn := tls.Client(conn, &tls.Config{
-			ServerName:         c.serverName,
-			InsecureSkipVerify: !strict,
-		})
-		if err := tlsConn.Handshake(); err != nil {
-			_ = tlsConn.Close()
-			done <- result{ok: false}
-			return
-		}
-		_ = tlsConn.Close()
-
-		latency := time.Since(start)
-		if latency > c.threshold {
-			done <- result{ok: false, latency: latency}
-			return
-		}
-		done <- result{ok: true, latency: latency}
-	}()
+	cd, ok := dialer.(proxy.ContextDialer)
+	if !ok {
+		return nil, errors.New("socks5 dialer does not support contexts")
+	}
+	return cd, nil
+}
 
-	select {
-	case res := <-done:
-		return res.ok, res.latency
-	case <-ctx.Done():
-		return false, 0
+// httpClient returns a client dialing through d without connection reuse. strict
+// enforces certificate verification.
+func httpClient(d proxy.ContextDialer, strict bool) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext:       d.DialContext,
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: !strict},
+			DisableKeepAlives: true,
+		},
 	}
 }
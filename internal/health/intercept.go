@@ -0,0 +1,133 @@
+package health
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/CodeBoy2006/EasyProxyPool/internal/certpin"
+	"golang.org/x/net/proxy"
+)
+
+// interception holds the TLS interception check settings and the reference
+// certificate hashes.
+type interception struct {
+	addr       string
+	serverName string
+	// pinned reports whether pins were configured; otherwise spki holds the
+	// hashes observed directly by ObserveDirect.
+	pinned bool
+
+	mu   sync.RWMutex
+	spki map[[sha256.Size]byte]struct{}
+}
+
+// SetInterceptionCheck enables TLS interception detection with a handshake to
+// addr (SNI serverName). pins are base64 SHA-256 hashes of a certificate's
+// SubjectPublicKeyInfo, optionally prefixed with "sha256/"; without pins the
+// chain observed directly (see ObserveDirect) is the reference.
+func (c *Checker) SetInterceptionCheck(addr, serverName string, pins []string) error {
+	ic := &interception{addr: addr, serverName: serverName, spki: make(map[[sha256.Size]byte]struct{})}
+	for _, pin := range pins {
+		h, err := certpin.Parse(pin)
+		if err != nil {
+			return err
+		}
+		ic.spki[h] = struct{}{}
+		ic.pinned = true
+	}
+	c.intercept = ic
+	return nil
+}
+
+// InterceptionEnabled reports whether the TLS interception check is configured.
+func (c *Checker) InterceptionEnabled() bool {
+	return c.intercept != nil
+}
+
+// ObserveDirect records the certificate chain presented to a direct connection as
+// the reference for Intercepted. It is a no-op when pins are configured.
+func (c *Checker) ObserveDirect(ctx context.Context) error {
+	ic := c.intercept
+	if ic == nil || ic.pinned {
+		return nil
+	}
+	chain, err := c.peerChain(ctx, &net.Dialer{}, ic)
+	if err != nil {
+		return err
+	}
+	spki := make(map[[sha256.Size]byte]struct{}, len(chain))
+	for _, cert := range chain {
+		spki[spkiHash(cert)] = struct{}{}
+	}
+	ic.mu.Lock()
+	ic.spki = spki
+	ic.mu.Unlock()
+	return nil
+}
+
+// Intercepted handshakes with the check address through the upstream and reports
+// whether none of the presented certificates matches the reference hashes.
+func (c *Checker) Intercepted(ctx context.Context, upstreamAddr string, auth *proxy.Auth) (bool, error) {
+	if c.intercept == nil {
+		return false, errors.New("tls interception check disabled")
+	}
+	d, err := socksDialer(upstreamAddr, auth)
+	if err != nil {
+		return false, err
+	}
+	return c.interceptedVia(ctx, d)
+}
+
+func (c *Checker) interceptedVia(ctx context.Context, d proxy.ContextDialer) (bool, error) {
+	ic := c.intercept
+	ic.mu.RLock()
+	ref := ic.spki
+	ic.mu.RUnlock()
+	if len(ref) == 0 {
+		return false, errors.New("no reference certificate observed")
+	}
+	chain, err := c.peerChain(ctx, d, ic)
+	if err != nil {
+		return false, err
+	}
+	return !matchesSPKI(chain, ref), nil
+}
+
+// peerChain returns the certificates presented by ic.addr, without verifying them.
+func (c *Checker) peerChain(ctx context.Context, d proxy.ContextDialer, ic *interception) ([]*x509.Certificate, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.totalTimeout)
+	defer cancel()
+
+	conn, err := d.DialContext(ctx, "tcp", ic.addr)
+	if err != nil {
+		return nil, err
+	}
+	tlsConn := tls.Client(conn, &tls.Config{ServerName: ic.serverName, InsecureSkipVerify: true})
+	defer tlsConn.Close()
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return nil, err
+	}
+	chain := tlsConn.ConnectionState().PeerCertificates
+	if len(chain) == 0 {
+		return nil, errors.New("no certificate presented")
+	}
+	return chain, nil
+}
+
+func matchesSPKI(chain []*x509.Certificate, ref map[[sha256.Size]byte]struct{}) bool {
+	for _, cert := range chain {
+		if _, ok := ref[spkiHash(cert)]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func spkiHash(cert *x509.Certificate) [sha256.Size]byte {
+	return sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+}
@@ -0,0 +1,101 @@
+package health
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"io"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// redirectDialer connects to addr whatever the requested address, like an
+// upstream that intercepts the connection.
+type redirectDialer struct{ addr string }
+
+func (d redirectDialer) DialContext(ctx context.Context, network, _ string) (net.Conn, error) {
+	var nd net.Dialer
+	return nd.DialContext(ctx, network, d.addr)
+}
+
+func selfSignedCert(t *testing.T) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "mitm"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"example.com"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate: %v", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestInterceptionCheck(t *testing.T) {
+	ok := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+	origin := httptest.NewTLSServer(ok)
+	defer origin.Close()
+	mitm := httptest.NewUnstartedServer(ok)
+	mitm.TLS = &tls.Config{Certificates: []tls.Certificate{selfSignedCert(t)}}
+	mitm.StartTLS()
+	defer mitm.Close()
+
+	originAddr := origin.Listener.Addr().String()
+	mitmAddr := mitm.Listener.Addr().String()
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	t.Run("direct_reference", func(t *testing.T) {
+		c := New(log, "", "", time.Second, time.Second)
+		if err := c.SetInterceptionCheck(originAddr, "example.com", nil); err != nil {
+			t.Fatalf("SetInterceptionCheck: %v", err)
+		}
+		if _, err := c.interceptedVia(context.Background(), redirectDialer{addr: originAddr}); err == nil {
+			t.Fatalf("expected an error before the reference is observed")
+		}
+		if err := c.ObserveDirect(context.Background()); err != nil {
+			t.Fatalf("ObserveDirect: %v", err)
+		}
+		if bad, err := c.interceptedVia(context.Background(), redirectDialer{addr: originAddr}); err != nil || bad {
+			t.Fatalf("clean upstream: intercepted=%v, err=%v", bad, err)
+		}
+		if bad, err := c.interceptedVia(context.Background(), redirectDialer{addr: mitmAddr}); err != nil || !bad {
+			t.Fatalf("intercepting upstream: intercepted=%v, err=%v", bad, err)
+		}
+	})
+
+	t.Run("pins", func(t *testing.T) {
+		sum := sha256.Sum256(origin.Certificate().RawSubjectPublicKeyInfo)
+		c := New(log, "", "", time.Second, time.Second)
+		if err := c.SetInterceptionCheck(originAddr, "example.com", []string{"sha256/" + base64.StdEncoding.EncodeToString(sum[:])}); err != nil {
+			t.Fatalf("SetInterceptionCheck: %v", err)
+		}
+		if bad, err := c.interceptedVia(context.Background(), redirectDialer{addr: originAddr}); err != nil || bad {
+			t.Fatalf("pinned origin: intercepted=%v, err=%v", bad, err)
+		}
+		if bad, err := c.interceptedVia(context.Background(), redirectDialer{addr: mitmAddr}); err != nil || !bad {
+			t.Fatalf("intercepting upstream: intercepted=%v, err=%v", bad, err)
+		}
+	})
+
+	if err := New(log, "", "", time.Second, time.Second).SetInterceptionCheck(originAddr, "example.com", []string{"not-a-pin"}); err == nil {
+		t.Fatalf("expected invalid pin to be rejected")
+	}
+}
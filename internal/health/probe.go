@@ -0,0 +1,199 @@
+package health
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// defaultMaxBodyBytes bounds HTTP probe bodies when max_body_bytes is unset.
+const defaultMaxBodyBytes = 1 << 20
+
+// Probe checks a single target through an upstream. strict enforces certificate
+// verification for probes that use TLS.
+type Probe interface {
+	// Name identifies the probe in logs.
+	Name() string
+	Probe(ctx context.Context, d proxy.ContextDialer, strict bool) error
+}
+
+// TCPProbe passes when a connection to Addr can be established.
+type TCPProbe struct {
+	Addr string
+}
+
+func (p TCPProbe) Name() string { return "tcp:" + p.Addr }
+
+func (p TCPProbe) Probe(ctx context.Context, d proxy.ContextDialer, _ bool) error {
+	conn, err := d.DialContext(ctx, "tcp", p.Addr)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// TLSProbe passes when a TLS handshake with Addr completes.
+type TLSProbe struct {
+	Addr       string
+	ServerName string
+}
+
+func (p TLSProbe) Name() string { return "tls:" + p.Addr }
+
+func (p TLSProbe) Probe(ctx context.Context, d proxy.ContextDialer, strict bool) error {
+	conn, err := d.DialContext(ctx, "tcp", p.Addr)
+	if err != nil {
+		return err
+	}
+	tlsConn := tls.Client(conn, &tls.Config{
+		ServerName:         p.ServerName,
+		InsecureSkipVerify: !strict,
+	})
+	defer tlsConn.Close()
+	return tlsConn.HandshakeContext(ctx)
+}
+
+// HTTPProbe GETs URL and checks the status code and body.
+type HTTPProbe struct {
+	URL string
+	// ExpectStatus lists accepted status codes; empty accepts any 2xx.
+	ExpectStatus []int
+	BodyContains string
+	BodyRegex    *regexp.Regexp
+	// MaxBodyBytes fails responses with larger bodies; 0 uses 1 MiB.
+	MaxBodyBytes int64
+}
+
+func (p HTTPProbe) Name() string { return "http:" + p.URL }
+
+func (p HTTPProbe) Probe(ctx context.Context, d proxy.ContextDialer, strict bool) error {
+	client := httpClient(d, strict)
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.URL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if !p.statusOK(resp.StatusCode) {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	max := p.MaxBodyBytes
+	if max <= 0 {
+		max = defaultMaxBodyBytes
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, max+1))
+	if err != nil {
+		return err
+	}
+	if int64(len(body)) > max {
+		return fmt.Errorf("body exceeds %d bytes", max)
+	}
+	if p.BodyContains != "" && !bytes.Contains(body, []byte(p.BodyContains)) {
+		return errors.New("body does not contain the expected text")
+	}
+	if p.BodyRegex != nil && !p.BodyRegex.Match(body) {
+		return errors.New("body does not match the expected pattern")
+	}
+	return nil
+}
+
+func (p HTTPProbe) statusOK(code int) bool {
+	if len(p.ExpectStatus) == 0 {
+		return code >= 200 && code < 300
+	}
+	for _, c := range p.ExpectStatus {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// Target is a probe with its latency limit (0 = the handshake threshold).
+type Target struct {
+	Probe      Probe
+	MaxLatency time.Duration
+}
+
+// SetProbes replaces the default TLS handshake to the target address with
+// targets. An upstream is healthy when at least require probes pass within their
+// latency limit; require <= 0 or above len(targets) requires all of them. No
+// targets restores the default.
+func (c *Checker) SetProbes(require int, targets []Target) {
+	if require <= 0 || require > len(targets) {
+		require = len(targets)
+	}
+	c.targets = targets
+	c.require = require
+}
+
+// runTargets runs the configured probes (or the default TLS handshake)
+// concurrently through d and reports whether enough passed, with the mean
+// latency of the passing ones.
+func (c *Checker) runTargets(ctx context.Context, d proxy.ContextDialer, strict bool) (bool, time.Duration) {
+	targets, require := c.targets, c.require
+	if len(targets) == 0 {
+		targets = []Target{{Probe: TLSProbe{Addr: c.targetAddr, ServerName: c.serverName}}}
+		require = 1
+	}
+
+	// Probes still running once the outcome is decided are cancelled.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		ok      bool
+		latency time.Duration
+	}
+	results := make(chan result, len(targets))
+	for _, t := range targets {
+		go func(t Target) {
+			limit := t.MaxLatency
+			if limit <= 0 {
+				limit = c.threshold
+			}
+			start := time.Now()
+			err := t.Probe.Probe(ctx, d, strict)
+			latency := time.Since(start)
+			if err == nil && latency > limit {
+				err = fmt.Errorf("took %s (limit %s)", latency, limit)
+			}
+			if err != nil {
+				c.log.Debug("health probe failed", "probe", t.Probe.Name(), "err", err)
+			}
+			results <- result{ok: err == nil, latency: latency}
+		}(t)
+	}
+
+	passed, failed := 0, 0
+	var total time.Duration
+	for range targets {
+		r := <-results
+		if r.ok {
+			passed++
+			total += r.latency
+		} else {
+			failed++
+		}
+		if passed >= require {
+			return true, total / time.Duration(passed)
+		}
+		if len(targets)-failed < require {
+			return false, 0
+		}
+	}
+	return false, 0
+}
@@ -0,0 +1,133 @@
+package health
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+func TestHTTPProbe(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/204":
+			w.WriteHeader(http.StatusNoContent)
+		case "/big":
+			_, _ = io.WriteString(w, strings.Repeat("x", 2048))
+		default:
+			_, _ = io.WriteString(w, "hello probe v2")
+		}
+	}))
+	defer srv.Close()
+
+	d := &net.Dialer{}
+	cases := []struct {
+		name  string
+		probe HTTPProbe
+		ok    bool
+	}{
+		{name: "default_2xx", probe: HTTPProbe{URL: srv.URL}, ok: true},
+		{name: "expect_status", probe: HTTPProbe{URL: srv.URL + "/204", ExpectStatus: []int{204}}, ok: true},
+		{name: "unexpected_status", probe: HTTPProbe{URL: srv.URL, ExpectStatus: []int{204}}, ok: false},
+		{name: "body_contains", probe: HTTPProbe{URL: srv.URL, BodyContains: "probe"}, ok: true},
+		{name: "body_missing", probe: HTTPProbe{URL: srv.URL, BodyContains: "captive"}, ok: false},
+		{name: "body_regex", probe: HTTPProbe{URL: srv.URL, BodyRegex: regexp.MustCompile(`v\d+$`)}, ok: true},
+		{name: "body_regex_mismatch", probe: HTTPProbe{URL: srv.URL, BodyRegex: regexp.MustCompile(`^v\d+`)}, ok: false},
+		{name: "max_body", probe: HTTPProbe{URL: srv.URL + "/big", MaxBodyBytes: 1024}, ok: false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := c.probe.Probe(context.Background(), d, false)
+			if c.ok != (err == nil) {
+				t.Fatalf("ok=%v, err=%v", c.ok, err)
+			}
+		})
+	}
+}
+
+func TestCheckerRunTargets_RequireNofM(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.Close()
+		}
+	}()
+	// A listener that was closed refuses connections.
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	deadAddr := closed.Addr().String()
+	_ = closed.Close()
+
+	c := New(slog.New(slog.NewTextHandler(io.Discard, nil)), "", "", time.Second, time.Second)
+	targets := []Target{
+		{Probe: TCPProbe{Addr: ln.Addr().String()}},
+		{Probe: TCPProbe{Addr: deadAddr}},
+		{Probe: TCPProbe{Addr: ln.Addr().String()}},
+	}
+
+	for _, tc := range []struct {
+		require int
+		ok      bool
+	}{{require: 2, ok: true}, {require: 3, ok: false}, {require: 0, ok: false}} {
+		c.SetProbes(tc.require, targets)
+		if ok, _ := c.runTargets(context.Background(), &net.Dialer{}, false); ok != tc.ok {
+			t.Fatalf("require=%d: got ok=%v", tc.require, ok)
+		}
+	}
+}
+
+// blockingProbe runs until its context is cancelled and reports that on done.
+type blockingProbe struct {
+	done chan error
+}
+
+func (p blockingProbe) Name() string { return "blocking" }
+
+func (p blockingProbe) Probe(ctx context.Context, _ proxy.ContextDialer, _ bool) error {
+	<-ctx.Done()
+	p.done <- ctx.Err()
+	return ctx.Err()
+}
+
+// passProbe passes immediately.
+type passProbe struct{}
+
+func (passProbe) Name() string { return "pass" }
+
+func (passProbe) Probe(context.Context, proxy.ContextDialer, bool) error { return nil }
+
+func TestCheckerRunTargets_CancelsRemainingProbes(t *testing.T) {
+	c := New(slog.New(slog.NewTextHandler(io.Discard, nil)), "", "", time.Second, time.Second)
+	blocked := blockingProbe{done: make(chan error, 1)}
+	c.SetProbes(1, []Target{{Probe: passProbe{}}, {Probe: blocked}})
+
+	if ok, _ := c.runTargets(context.Background(), &net.Dialer{}, false); !ok {
+		t.Fatalf("expected one passing probe to satisfy require=1")
+	}
+	select {
+	case err := <-blocked.done:
+		if err != context.Canceled {
+			t.Fatalf("expected the remaining probe to be cancelled, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("expected the remaining probe to be cancelled once the outcome was decided")
+	}
+}
@@ -0,0 +1,97 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// DefaultThroughputBytes is how much the throughput probe downloads by default.
+const DefaultThroughputBytes = 1 << 20
+
+// minThroughputWindow avoids absurd rates when a download completes almost
+// instantly.
+const minThroughputWindow = time.Millisecond
+
+type throughputProbe struct {
+	url      string
+	maxBytes int64
+	timeout  time.Duration
+}
+
+// SetThroughput enables the bandwidth probe: url is downloaded through each
+// upstream, reading at most maxBytes within timeout (0 uses the total health
+// check timeout). An empty url disables it.
+func (c *Checker) SetThroughput(url string, maxBytes int64, timeout time.Duration) {
+	url = strings.TrimSpace(url)
+	if url == "" {
+		c.throughput = nil
+		return
+	}
+	if maxBytes <= 0 {
+		maxBytes = DefaultThroughputBytes
+	}
+	if timeout <= 0 {
+		timeout = c.totalTimeout
+	}
+	c.throughput = &throughputProbe{url: url, maxBytes: maxBytes, timeout: timeout}
+}
+
+// ThroughputEnabled reports whether the bandwidth probe is configured.
+func (c *Checker) ThroughputEnabled() bool {
+	return c.throughput != nil
+}
+
+// Throughput downloads the configured resource through the upstream and returns
+// the transfer rate of the body in bytes per second.
+func (c *Checker) Throughput(ctx context.Context, upstreamAddr string, auth *proxy.Auth, strict bool) (int64, error) {
+	if c.throughput == nil {
+		return 0, errors.New("throughput probe disabled")
+	}
+	d, err := socksDialer(upstreamAddr, auth)
+	if err != nil {
+		return 0, err
+	}
+	return c.throughputVia(ctx, d, strict)
+}
+
+func (c *Checker) throughputVia(ctx context.Context, d proxy.ContextDialer, strict bool) (int64, error) {
+	tp := c.throughput
+	ctx, cancel := context.WithTimeout(ctx, tp.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, tp.url, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := httpClient(d, strict).Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("throughput endpoint: status %d", resp.StatusCode)
+	}
+
+	// Time the body only, so connection setup latency does not count as bandwidth.
+	// A download cut short by the timeout still yields the rate observed so far.
+	start := time.Now()
+	n, err := io.Copy(io.Discard, io.LimitReader(resp.Body, tp.maxBytes))
+	elapsed := time.Since(start)
+	if err != nil && n == 0 {
+		return 0, err
+	}
+	if n == 0 {
+		return 0, errors.New("throughput endpoint: empty body")
+	}
+	if elapsed < minThroughputWindow {
+		elapsed = minThroughputWindow
+	}
+	return int64(float64(n) / elapsed.Seconds()), nil
+}
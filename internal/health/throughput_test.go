@@ -0,0 +1,40 @@
+package health
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestThroughput(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = io.WriteString(w, strings.Repeat("x", 256<<10))
+	}))
+	defer srv.Close()
+
+	c := New(slog.New(slog.NewTextHandler(io.Discard, nil)), "", "", time.Second, time.Second)
+	if c.ThroughputEnabled() {
+		t.Fatalf("expected throughput probe to be disabled by default")
+	}
+
+	c.SetThroughput(srv.URL, 64<<10, 0)
+	bps, err := c.throughputVia(context.Background(), &net.Dialer{}, false)
+	if err != nil || bps <= 0 {
+		t.Fatalf("expected a positive rate, got %d, %v", bps, err)
+	}
+
+	c.SetThroughput(srv.URL+"/missing", 0, 0)
+	if _, err := c.throughputVia(context.Background(), &net.Dialer{}, false); err == nil {
+		t.Fatalf("expected an error for a non-200 response")
+	}
+}
@@ -0,0 +1,202 @@
+package orchestrator
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// CheckResult is one health-check outcome for an address.
+type CheckResult struct {
+	At        time.Time `json:"at"`
+	OK        bool      `json:"ok"`
+	LatencyMS int64     `json:"latency_ms,omitempty"`
+}
+
+// NodeHistory is the health-check record of one fetched address.
+type NodeHistory struct {
+	Addr        string    `json:"addr"`
+	FirstSeen   time.Time `json:"first_seen"`
+	LastChecked time.Time `json:"last_checked,omitempty"`
+	Checks      int       `json:"checks"`
+	Successes   int       `json:"successes"`
+	// UptimePct is the share of successful checks, 0-100.
+	UptimePct           float64 `json:"uptime_pct"`
+	ConsecutiveFailures int     `json:"consecutive_failures"`
+	// NextCheck is when a backed-off address is checked again; zero when it is
+	// checked on every refresh.
+	NextCheck time.Time     `json:"next_check,omitempty"`
+	Recent    []CheckResult `json:"recent,omitempty"`
+
+	// latency of the last successful check, used to check faster nodes first.
+	latency time.Duration
+}
+
+// HistoryConfig controls how much is remembered per address and how checks of
+// failing addresses back off.
+type HistoryConfig struct {
+	// Size is the number of recent results kept per address.
+	Size int
+	// BackoffAfter is the number of consecutive failures after which an address is
+	// no longer checked on every refresh. 0 disables the backoff.
+	BackoffAfter int
+	// BaseBackoff is the first skip period; each further failure doubles it up to
+	// MaxBackoff.
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+}
+
+// History keeps per-address health-check results across legacy refreshes and
+// decides which addresses to check, and in which order.
+type History struct {
+	mu    sync.RWMutex
+	cfg   HistoryConfig
+	nodes map[string]*NodeHistory
+}
+
+func NewHistory(cfg HistoryConfig) *History {
+	if cfg.Size <= 0 {
+		cfg.Size = 1
+	}
+	return &History{cfg: cfg, nodes: make(map[string]*NodeHistory)}
+}
+
+// Plan returns the addresses to check at now, known-good ones first (fastest
+// first), then new ones, then failing ones (fewest consecutive failures first).
+// Addresses still in their backoff period are left out and counted in skipped.
+// Addresses no longer fetched are forgotten.
+func (h *History) Plan(addrs []string, now time.Time) (due []string, skipped int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	fetched := make(map[string]struct{}, len(addrs))
+	for _, a := range addrs {
+		fetched[a] = struct{}{}
+	}
+	for a := range h.nodes {
+		if _, ok := fetched[a]; !ok {
+			delete(h.nodes, a)
+		}
+	}
+
+	type ranked struct {
+		addr    string
+		tier    int
+		failed  int
+		latency time.Duration
+	}
+	rs := make([]ranked, 0, len(addrs))
+	for _, a := range addrs {
+		n, ok := h.nodes[a]
+		if !ok {
+			h.nodes[a] = &NodeHistory{Addr: a, FirstSeen: now}
+			rs = append(rs, ranked{addr: a, tier: 1})
+			continue
+		}
+		if !n.NextCheck.IsZero() && now.Before(n.NextCheck) {
+			skipped++
+			continue
+		}
+		switch {
+		case len(n.Recent) == 0:
+			rs = append(rs, ranked{addr: a, tier: 1})
+		case n.ConsecutiveFailures == 0:
+			rs = append(rs, ranked{addr: a, tier: 0, latency: n.latency})
+		default:
+			rs = append(rs, ranked{addr: a, tier: 2, failed: n.ConsecutiveFailures})
+		}
+	}
+	sort.SliceStable(rs, func(i, j int) bool {
+		if rs[i].tier != rs[j].tier {
+			return rs[i].tier < rs[j].tier
+		}
+		if rs[i].failed != rs[j].failed {
+			return rs[i].failed < rs[j].failed
+		}
+		return rs[i].latency < rs[j].latency
+	})
+	due = make([]string, 0, len(rs))
+	for _, r := range rs {
+		due = append(due, r.addr)
+	}
+	return due, skipped
+}
+
+// Record adds a check result for addr and schedules its next check.
+func (h *History) Record(addr string, ok bool, latency time.Duration, now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	n, found := h.nodes[addr]
+	if !found {
+		n = &NodeHistory{Addr: addr, FirstSeen: now}
+		h.nodes[addr] = n
+	}
+	r := CheckResult{At: now, OK: ok}
+	if ok {
+		r.LatencyMS = int64(latency / time.Millisecond)
+		n.latency = latency
+	}
+	n.Recent = append(n.Recent, r)
+	if len(n.Recent) > h.cfg.Size {
+		n.Recent = append(n.Recent[:0], n.Recent[len(n.Recent)-h.cfg.Size:]...)
+	}
+	n.LastChecked = now
+	n.Checks++
+	n.NextCheck = time.Time{}
+	if ok {
+		n.Successes++
+		n.ConsecutiveFailures = 0
+	} else {
+		n.ConsecutiveFailures++
+		if b := h.backoff(n.ConsecutiveFailures); b > 0 {
+			n.NextCheck = now.Add(b)
+		}
+	}
+	n.UptimePct = 100 * float64(n.Successes) / float64(n.Checks)
+}
+
+// backoff returns how long to skip an address after failures consecutive failed
+// checks. Callers must hold h.mu.
+func (h *History) backoff(failures int) time.Duration {
+	c := h.cfg
+	if c.BackoffAfter <= 0 || failures < c.BackoffAfter || c.BaseBackoff <= 0 {
+		return 0
+	}
+	d := c.BaseBackoff
+	for i := c.BackoffAfter; i < failures && d < c.MaxBackoff; i++ {
+		d *= 2
+	}
+	if c.MaxBackoff > 0 && d > c.MaxBackoff {
+		d = c.MaxBackoff
+	}
+	return d
+}
+
+// Get returns a copy of addr's history.
+func (h *History) Get(addr string) (NodeHistory, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	n, ok := h.nodes[addr]
+	if !ok {
+		return NodeHistory{}, false
+	}
+	cp := *n
+	cp.Recent = append([]CheckResult(nil), n.Recent...)
+	return cp, true
+}
+
+// List returns every address's history without the recent results, sorted by
+// address.
+func (h *History) List() []NodeHistory {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	out := make([]NodeHistory, 0, len(h.nodes))
+	for _, n := range h.nodes {
+		cp := *n
+		cp.Recent = nil
+		out = append(out, cp)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Addr < out[j].Addr })
+	return out
+}
@@ -0,0 +1,52 @@
+package orchestrator
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestHistory_PlanOrdersAndBacksOff(t *testing.T) {
+	h := NewHistory(HistoryConfig{Size: 3, BackoffAfter: 2, BaseBackoff: time.Minute, MaxBackoff: 4 * time.Minute})
+	now := time.Unix(1000, 0)
+
+	addrs := []string{"dead:1", "slow:1", "new:1", "fast:1", "flaky:1"}
+	h.Record("dead:1", false, 0, now)
+	h.Record("dead:1", false, 0, now)
+	h.Record("slow:1", true, 900*time.Millisecond, now)
+	h.Record("fast:1", true, 100*time.Millisecond, now)
+	h.Record("flaky:1", false, 0, now)
+
+	due, skipped := h.Plan(addrs, now.Add(30*time.Second))
+	if want := []string{"fast:1", "slow:1", "new:1", "flaky:1"}; !reflect.DeepEqual(due, want) || skipped != 1 {
+		t.Fatalf("unexpected plan: due=%v skipped=%d", due, skipped)
+	}
+
+	// The backoff expires, then doubles with each further failure up to the cap.
+	due, _ = h.Plan(addrs, now.Add(time.Minute))
+	if due[len(due)-1] != "dead:1" {
+		t.Fatalf("expected dead:1 to be checked last once its backoff expired, got %v", due)
+	}
+	for i, want := range []time.Duration{2 * time.Minute, 4 * time.Minute, 4 * time.Minute} {
+		h.Record("dead:1", false, 0, now)
+		n, _ := h.Get("dead:1")
+		if got := n.NextCheck.Sub(now); got != want {
+			t.Fatalf("failure %d: expected backoff %v, got %v", i+3, want, got)
+		}
+	}
+
+	h.Record("dead:1", true, time.Second, now)
+	n, _ := h.Get("dead:1")
+	if !n.NextCheck.IsZero() || n.ConsecutiveFailures != 0 || n.Checks != 6 || len(n.Recent) != 3 {
+		t.Fatalf("unexpected history after recovery: %+v", n)
+	}
+	if n.UptimePct < 16.6 || n.UptimePct > 16.7 {
+		t.Fatalf("expected 1/6 uptime, got %v", n.UptimePct)
+	}
+
+	// Addresses that are no longer fetched are forgotten.
+	h.Plan([]string{"fast:1"}, now)
+	if got := h.List(); len(got) != 1 || got[0].Addr != "fast:1" {
+		t.Fatalf("expected only fast:1 to remain, got %+v", got)
+	}
+}
@@ -0,0 +1,50 @@
+package orchestrator
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/CodeBoy2006/EasyProxyPool/internal/config"
+	"github.com/CodeBoy2006/EasyProxyPool/internal/health"
+)
+
+// probeTargets builds the health probes of health_check.probes.
+func probeTargets(cfg config.HealthProbesConfig) ([]health.Target, error) {
+	targets := make([]health.Target, 0, len(cfg.Targets))
+	for i, t := range cfg.Targets {
+		var p health.Probe
+		switch strings.ToLower(strings.TrimSpace(t.Type)) {
+		case "tcp":
+			p = health.TCPProbe{Addr: strings.TrimSpace(t.Address)}
+		case "tls":
+			addr := strings.TrimSpace(t.Address)
+			sni := strings.TrimSpace(t.ServerName)
+			if sni == "" {
+				sni, _, _ = net.SplitHostPort(addr)
+			}
+			p = health.TLSProbe{Addr: addr, ServerName: sni}
+		case "http":
+			hp := health.HTTPProbe{
+				URL:          strings.TrimSpace(t.URL),
+				ExpectStatus: t.ExpectStatus,
+				BodyContains: t.BodyContains,
+				MaxBodyBytes: t.MaxBodyBytes,
+			}
+			if t.BodyRegex != "" {
+				re, err := regexp.Compile(t.BodyRegex)
+				if err != nil {
+					return nil, fmt.Errorf("probes.targets[%d].body_regex: %w", i, err)
+				}
+				hp.BodyRegex = re
+			}
+			p = hp
+		default:
+			return nil, fmt.Errorf("probes.targets[%d].type: unsupported %q", i, t.Type)
+		}
+		targets = append(targets, health.Target{Probe: p, MaxLatency: time.Duration(t.MaxLatencyMS) * time.Millisecond})
+	}
+	return targets, nil
+}
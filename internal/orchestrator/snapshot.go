@@ -0,0 +1,175 @@
+package orchestrator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/CodeBoy2006/EasyProxyPool/internal/pool"
+	"github.com/CodeBoy2006/EasyProxyPool/internal/xray"
+)
+
+const snapshotVersion = 1
+
+// Snapshot is the on-disk state used for warm restarts.
+type Snapshot struct {
+	Version int       `json:"version"`
+	SavedAt time.Time `json:"saved_at"`
+
+	Pool       []pool.EntryState `json:"pool"`
+	PoolStrict []pool.EntryState `json:"pool_strict,omitempty"`
+
+	// XrayRelaxedHash/XrayStrictHash identify the xray configs the pool entries were
+	// routed through; the config files themselves stay in adapters.xray.work_dir.
+	XrayRelaxedHash string `json:"xray_relaxed_hash,omitempty"`
+	XrayStrictHash  string `json:"xray_strict_hash,omitempty"`
+
+	NodeHealthRelaxedAt time.Time                  `json:"node_health_relaxed_at,omitempty"`
+	NodeHealthRelaxed   map[string]xray.NodeHealth `json:"node_health_relaxed,omitempty"`
+	NodeHealthStrictAt  time.Time                  `json:"node_health_strict_at,omitempty"`
+	NodeHealthStrict    map[string]xray.NodeHealth `json:"node_health_strict,omitempty"`
+}
+
+// LoadSnapshot reads a snapshot written by SaveSnapshot.
+func LoadSnapshot(path string) (Snapshot, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	var s Snapshot
+	if err := json.Unmarshal(b, &s); err != nil {
+		return Snapshot{}, fmt.Errorf("parse snapshot: %w", err)
+	}
+	if s.Version != snapshotVersion {
+		return Snapshot{}, fmt.Errorf("unsupported snapshot version %d", s.Version)
+	}
+	return s, nil
+}
+
+// SaveSnapshot atomically replaces the snapshot at path. The file holds upstream
+// credentials, so it is only readable by the owner.
+func SaveSnapshot(path string, s Snapshot) error {
+	s.Version = snapshotVersion
+	b, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("marshal snapshot: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("create snapshot dir: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("create snapshot: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("replace snapshot: %w", err)
+	}
+	return nil
+}
+
+// saveSnapshot persists the current pools. Empty pools are not written so a failed
+// first refresh does not clobber the last good snapshot.
+func (u *Updater) saveSnapshot() {
+	if !u.cfg.Snapshot.Enabled {
+		return
+	}
+	s := Snapshot{
+		SavedAt: time.Now(),
+		Pool:    u.pool.Export(),
+	}
+	if u.poolStrict != nil {
+		s.PoolStrict = u.poolStrict.Export()
+	}
+	if len(s.Pool) == 0 && len(s.PoolStrict) == 0 {
+		return
+	}
+	if u.xrayRelaxed != nil {
+		s.XrayRelaxedHash = u.xrayRelaxed.Hash()
+		s.NodeHealthRelaxed, s.NodeHealthRelaxedAt = u.status.RelaxedNodeHealthSnapshot()
+	}
+	if u.xrayStrict != nil {
+		s.XrayStrictHash = u.xrayStrict.Hash()
+		s.NodeHealthStrict, s.NodeHealthStrictAt = u.status.StrictNodeHealthSnapshot()
+	}
+
+	if err := SaveSnapshot(u.cfg.Snapshot.Path, s); err != nil {
+		u.log.Warn("save snapshot failed", "path", u.cfg.Snapshot.Path, "err", err)
+		return
+	}
+	u.log.Debug("snapshot saved", "path", u.cfg.Snapshot.Path, "pool", len(s.Pool), "strict_pool", len(s.PoolStrict))
+}
+
+// restoreSnapshot loads the last snapshot into the pools and reports whether any
+// upstreams were restored. Entries routed through xray are only restored when the
+// matching xray config could be resumed from work_dir.
+func (u *Updater) restoreSnapshot(ctx context.Context) bool {
+	if !u.cfg.Snapshot.Enabled {
+		return false
+	}
+	path := u.cfg.Snapshot.Path
+	s, err := LoadSnapshot(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			u.log.Warn("load snapshot failed; starting cold", "path", path, "err", err)
+		}
+		return false
+	}
+	if maxAge := time.Duration(u.cfg.Snapshot.MaxAgeMinutes) * time.Minute; maxAge > 0 && time.Since(s.SavedAt) > maxAge {
+		u.log.Info("snapshot too old; starting cold", "path", path, "saved_at", s.SavedAt)
+		return false
+	}
+
+	restored := 0
+	if u.resumeForSnapshot(ctx, s.Pool, u.xrayRelaxed, u.cfg.Adapters.Xray.SOCKSListenRelaxed, s.XrayRelaxedHash) {
+		restored += u.pool.Restore(s.Pool)
+		if s.NodeHealthRelaxed != nil {
+			u.status.SetRelaxedNodeHealth(s.NodeHealthRelaxedAt, s.NodeHealthRelaxed)
+		}
+	}
+	if u.poolStrict != nil && u.resumeForSnapshot(ctx, s.PoolStrict, u.xrayStrict, u.cfg.Adapters.Xray.SOCKSListenStrict, s.XrayStrictHash) {
+		restored += u.poolStrict.Restore(s.PoolStrict)
+		if s.NodeHealthStrict != nil {
+			u.status.SetStrictNodeHealth(s.NodeHealthStrictAt, s.NodeHealthStrict)
+		}
+	}
+
+	u.log.Info("snapshot loaded", "path", path, "saved_at", s.SavedAt, "restored", restored)
+	return restored > 0
+}
+
+// resumeForSnapshot reports whether entries can be served as-is, starting xray
+// from its previous config when they are routed through listen.
+func (u *Updater) resumeForSnapshot(ctx context.Context, entries []pool.EntryState, inst *xray.Instance, listen, hash string) bool {
+	if len(entries) == 0 {
+		return false
+	}
+	viaXray := false
+	for _, e := range entries {
+		if listen != "" && e.Addr == listen {
+			viaXray = true
+			break
+		}
+	}
+	if !viaXray {
+		return true
+	}
+	if inst == nil || hash == "" {
+		return false
+	}
+	if err := inst.Resume(ctx, hash); err != nil {
+		u.log.Warn("resume xray from snapshot failed; skipping its entries", "listen", listen, "err", err)
+		return false
+	}
+	return true
+}
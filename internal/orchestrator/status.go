@@ -4,6 +4,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/CodeBoy2006/EasyProxyPool/internal/sources"
 	"github.com/CodeBoy2006/EasyProxyPool/internal/xray"
 )
 
@@ -18,8 +19,20 @@ type Status struct {
 
 	LastDetails UpdateDetails
 
+	// Progress tracks the health checks of the running (or last) legacy refresh.
+	Progress CheckProgress
+
+	// Sources reports each typed source, including degraded ones (see
+	// sources.SourceStatus).
+	Sources []sources.SourceStatus
+
 	LastNodeHealthRelaxedAt time.Time
 	LastNodeHealthRelaxed   map[string]xray.NodeHealth
+
+	LastNodeHealthStrictAt time.Time
+	LastNodeHealthStrict   map[string]xray.NodeHealth
+
+	history *History
 }
 
 type UpdateDetails struct {
@@ -32,11 +45,28 @@ type UpdateDetails struct {
 	SkippedByType map[string]int
 
 	XrayRelaxedHash string
+	XrayStrictHash  string
+
+	// StrictPool is the number of upstreams published to the STRICT pool
+	// (0 when strict mode is disabled).
+	StrictPool int
+	StrictErr  string
 
 	FallbackUsed bool
 	FallbackErr  string
 }
 
+// CheckProgress counts upstreams health-checked so far out of Total, and how many
+// of them were healthy (and published to the pool). Skipped counts fetched
+// addresses left out because their check is backed off (see History).
+type CheckProgress struct {
+	Running bool
+	Total   int
+	Checked int
+	Healthy int
+	Skipped int
+}
+
 func NewStatus() *Status {
 	return &Status{}
 }
@@ -54,6 +84,7 @@ func (s *Status) SetEnd(t time.Time, fetched, poolSize int, err error, details U
 	s.LastFetched = fetched
 	s.LastPool = poolSize
 	s.LastDetails = cloneDetails(details)
+	s.Progress.Running = false
 	if err != nil {
 		s.LastUpdateErr = err.Error()
 	} else {
@@ -71,12 +102,43 @@ func (s *Status) Snapshot() Status {
 		LastFetched:     s.LastFetched,
 		LastPool:        s.LastPool,
 		LastDetails:     cloneDetails(s.LastDetails),
+		Progress:        s.Progress,
+		Sources:         append([]sources.SourceStatus(nil), s.Sources...),
 
 		LastNodeHealthRelaxedAt: s.LastNodeHealthRelaxedAt,
 		LastNodeHealthRelaxed:   cloneNodeHealth(s.LastNodeHealthRelaxed),
+
+		LastNodeHealthStrictAt: s.LastNodeHealthStrictAt,
+		LastNodeHealthStrict:   cloneNodeHealth(s.LastNodeHealthStrict),
 	}
 }
 
+func (s *Status) SetSources(st []sources.SourceStatus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Sources = st
+}
+
+func (s *Status) SetProgress(p CheckProgress) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Progress = p
+}
+
+// SetHistory publishes the per-address check history of the updater.
+func (s *Status) SetHistory(h *History) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.history = h
+}
+
+// History returns the per-address check history, or nil when there is none.
+func (s *Status) History() *History {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.history
+}
+
 func (s *Status) SetRelaxedNodeHealth(t time.Time, h map[string]xray.NodeHealth) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -90,6 +152,19 @@ func (s *Status) RelaxedNodeHealthSnapshot() (map[string]xray.NodeHealth, time.T
 	return cloneNodeHealth(s.LastNodeHealthRelaxed), s.LastNodeHealthRelaxedAt
 }
 
+func (s *Status) SetStrictNodeHealth(t time.Time, h map[string]xray.NodeHealth) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.LastNodeHealthStrictAt = t
+	s.LastNodeHealthStrict = cloneNodeHealth(h)
+}
+
+func (s *Status) StrictNodeHealthSnapshot() (map[string]xray.NodeHealth, time.Time) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return cloneNodeHealth(s.LastNodeHealthStrict), s.LastNodeHealthStrictAt
+}
+
 func cloneDetails(d UpdateDetails) UpdateDetails {
 	if d.SkippedByType == nil {
 		return d
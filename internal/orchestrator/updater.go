@@ -12,37 +12,50 @@ import (
 
 	"github.com/CodeBoy2006/EasyProxyPool/internal/config"
 	"github.com/CodeBoy2006/EasyProxyPool/internal/fetcher"
+	"github.com/CodeBoy2006/EasyProxyPool/internal/geoip"
 	"github.com/CodeBoy2006/EasyProxyPool/internal/health"
 	"github.com/CodeBoy2006/EasyProxyPool/internal/pool"
 	"github.com/CodeBoy2006/EasyProxyPool/internal/sources"
 	"github.com/CodeBoy2006/EasyProxyPool/internal/upstream"
 	"github.com/CodeBoy2006/EasyProxyPool/internal/xray"
+	"golang.org/x/net/proxy"
 )
 
 type Updater struct {
 	log *slog.Logger
 	cfg config.Config
 
-	pool   *pool.Pool
-	status *Status
+	pool       *pool.Pool
+	poolStrict *pool.Pool
+	status     *Status
 
 	fetcher     *fetcher.Fetcher
+	sources     *sources.Loader
 	checker     *health.Checker
+	geo         *geoip.DB
+	history     *History
 	xrayRelaxed *xray.Instance
+	xrayStrict  *xray.Instance
 
 	metricsRelaxed *xray.MetricsClient
+	metricsStrict  *xray.MetricsClient
 
 	ticker *time.Ticker
 	wg     sync.WaitGroup
 }
 
-func NewUpdater(log *slog.Logger, cfg config.Config, p *pool.Pool, status *Status) *Updater {
+// NewUpdater creates an updater for the relaxed pool p. strict may be nil when no
+// STRICT listener is configured; otherwise it receives only upstreams that pass
+// certificate-verified TLS checks.
+func NewUpdater(log *slog.Logger, cfg config.Config, p, strict *pool.Pool, status *Status) *Updater {
 	u := &Updater{
-		log:     log,
-		cfg:     cfg,
-		pool:    p,
-		status:  status,
-		fetcher: fetcher.New(log),
+		log:        log,
+		cfg:        cfg,
+		pool:       p,
+		poolStrict: strict,
+		status:     status,
+		fetcher:    fetcher.New(log),
+		sources:    sources.New(log),
 		checker: health.New(
 			log,
 			cfg.HealthCheck.TargetAddress,
@@ -51,6 +64,39 @@ func NewUpdater(log *slog.Logger, cfg config.Config, p *pool.Pool, status *Statu
 			time.Duration(cfg.HealthCheck.TLSHandshakeThresholdSeconds)*time.Second,
 		),
 	}
+	if cfg.SourceCache.Enabled {
+		u.fetcher.SetCacheDir(cfg.SourceCache.Dir)
+		u.sources.SetCacheDir(cfg.SourceCache.Dir)
+	}
+
+	hist := HistoryConfig{
+		Size:        cfg.HealthCheck.History.Size,
+		BaseBackoff: time.Duration(cfg.UpdateIntervalMinutes) * time.Minute,
+		MaxBackoff:  time.Duration(cfg.HealthCheck.History.MaxBackoffMinutes) * time.Minute,
+	}
+	if cfg.HealthCheck.History.BackoffAfter != nil {
+		hist.BackoffAfter = *cfg.HealthCheck.History.BackoffAfter
+	}
+	u.history = NewHistory(hist)
+	status.SetHistory(u.history)
+
+	u.checker.SetEgressIPURL(cfg.HealthCheck.EgressIPURL)
+	u.checker.SetAnonymityURL(cfg.HealthCheck.AnonymityURL)
+	if targets, err := probeTargets(cfg.HealthCheck.Probes); err != nil {
+		log.Warn("invalid health_check.probes; using the TLS handshake check", "err", err)
+	} else {
+		u.checker.SetProbes(cfg.HealthCheck.Probes.Require, targets)
+	}
+	u.checker.SetThroughput(
+		cfg.HealthCheck.Throughput.URL,
+		cfg.HealthCheck.Throughput.MaxBytes,
+		time.Duration(cfg.HealthCheck.Throughput.TimeoutSeconds)*time.Second,
+	)
+	if ti := cfg.HealthCheck.TLSInterception; ti.Enabled {
+		if err := u.checker.SetInterceptionCheck(ti.Address, ti.ServerName, ti.Pins); err != nil {
+			log.Warn("invalid health_check.tls_interception; check disabled", "err", err)
+		}
+	}
 
 	if cfg.Adapters.Xray.Enabled {
 		u.xrayRelaxed = xray.NewInstance(
@@ -64,15 +110,70 @@ func NewUpdater(log *slog.Logger, cfg config.Config, p *pool.Pool, status *Statu
 			nil,
 		)
 		u.metricsRelaxed = xray.NewMetricsClient(cfg.Adapters.Xray.MetricsListenRelaxed)
+
+		if strict != nil {
+			u.xrayStrict = xray.NewInstance(
+				log,
+				xray.ModeStrict,
+				cfg.Adapters.Xray.BinaryPath,
+				cfg.Adapters.Xray.WorkDir,
+				cfg.Adapters.Xray.SOCKSListenStrict,
+				cfg.Adapters.Xray.MetricsListenStrict,
+				time.Duration(cfg.Adapters.Xray.StartTimeoutSeconds)*time.Second,
+				nil,
+			)
+			u.metricsStrict = xray.NewMetricsClient(cfg.Adapters.Xray.MetricsListenStrict)
+		}
 	}
 	return u
 }
 
+// SetGeoIP sets the databases used to resolve upstream countries and ASNs. A nil
+// db disables lookups.
+func (u *Updater) SetGeoIP(db *geoip.DB) {
+	u.geo = db
+}
+
 func (u *Updater) Start(ctx context.Context) {
-	u.runOnce(ctx)
+	if u.restoreSnapshot(ctx) {
+		// Serve the restored pool right away; the first refresh runs in the background.
+		u.wg.Add(1)
+		go func() {
+			defer u.wg.Done()
+			u.runOnce(ctx)
+		}()
+	} else {
+		u.runOnce(ctx)
+	}
 
-	interval := time.Duration(u.cfg.UpdateIntervalMinutes) * time.Minute
-	u.ticker = time.NewTicker(interval)
+	if sec := u.cfg.Selection.CircuitBreaker.ProbeIntervalSeconds; sec > 0 {
+		u.wg.Add(1)
+		go func() {
+			defer u.wg.Done()
+			u.probeLoop(ctx, time.Duration(sec)*time.Second)
+		}()
+	}
+
+	if sc := u.cfg.Selection.Scoring; sc.Enabled {
+		u.wg.Add(1)
+		go func() {
+			defer u.wg.Done()
+			u.scoreLoop(ctx, time.Duration(sc.ProbeIntervalSeconds)*time.Second)
+		}()
+	}
+
+	for _, src := range u.cfg.Sources {
+		if src.RefreshIntervalMinutes > 0 {
+			u.wg.Add(1)
+			go func() {
+				defer u.wg.Done()
+				u.sourceLoop(ctx)
+			}()
+			break
+		}
+	}
+
+	u.ticker = time.NewTicker(time.Duration(u.cfg.UpdateIntervalMinutes) * time.Minute)
 
 	u.wg.Add(1)
 	go func() {
@@ -104,9 +205,128 @@ func (u *Updater) Stop(ctx context.Context) {
 	case <-ctx.Done():
 	}
 
+	u.saveSnapshot()
+
 	if u.xrayRelaxed != nil {
 		_ = u.xrayRelaxed.Stop(ctx)
 	}
+	if u.xrayStrict != nil {
+		_ = u.xrayStrict.Stop(ctx)
+	}
+}
+
+// sourceLoop re-fetches sources on their own refresh_interval_minutes and
+// refreshes the pool only when one of them returned different entries.
+func (u *Updater) sourceLoop(ctx context.Context) {
+	t := time.NewTicker(time.Minute)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			changed := u.sources.Refresh(ctx, u.cfg.Sources)
+			u.reportSources()
+			if changed {
+				u.log.Info("source entries changed; refreshing the pool")
+				u.runOnce(ctx)
+			}
+		}
+	}
+}
+
+// probeLoop periodically health-checks half-open upstreams so they can be
+// readmitted (or re-opened) without exposing user traffic to them.
+func (u *Updater) probeLoop(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			u.probeHalfOpen(ctx, u.pool, false)
+			if u.poolStrict != nil {
+				u.probeHalfOpen(ctx, u.poolStrict, true)
+			}
+		}
+	}
+}
+
+func (u *Updater) probeHalfOpen(ctx context.Context, p *pool.Pool, strict bool) {
+	entries := p.HalfOpen(time.Now())
+	if len(entries) == 0 {
+		return
+	}
+
+	base := time.Duration(u.cfg.Selection.FailureBackoffSeconds) * time.Second
+	maxBackoff := time.Duration(u.cfg.Selection.MaxBackoffSeconds) * time.Second
+	u.probeEach(ctx, entries, strict, func(e pool.Entry, ok bool, _ time.Duration) {
+		if ok {
+			p.MarkSuccess(e.Key(), time.Now())
+			return
+		}
+		p.MarkFailure(e.Key(), time.Now(), base, maxBackoff)
+	})
+	u.log.Debug("probed half-open upstreams", "pool", p.Name(), "count", len(entries))
+}
+
+// scoreLoop periodically re-probes every pooled upstream, feeding the outcomes
+// into the quality score so degraded upstreams are noticed (and ejected ones
+// recover) between refreshes.
+func (u *Updater) scoreLoop(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			u.probeScores(ctx, u.pool, false)
+			if u.poolStrict != nil {
+				u.probeScores(ctx, u.poolStrict, true)
+			}
+		}
+	}
+}
+
+func (u *Updater) probeScores(ctx context.Context, p *pool.Pool, strict bool) {
+	entries := p.Entries()
+	if len(entries) == 0 {
+		return
+	}
+
+	u.probeEach(ctx, entries, strict, func(e pool.Entry, ok bool, latency time.Duration) {
+		p.ObserveOutcome(e.Key(), pool.Outcome{OK: ok, TTFB: latency})
+	})
+	u.log.Debug("re-probed upstreams for scoring", "pool", p.Name(), "count", len(entries))
+}
+
+// probeEach health-checks entries concurrently (up to health_check_concurrency)
+// with their credentials and passes each result to done. Results of checks cut
+// short by ctx are dropped.
+func (u *Updater) probeEach(ctx context.Context, entries []pool.Entry, strict bool, done func(e pool.Entry, ok bool, latency time.Duration)) {
+	sem := make(chan struct{}, u.cfg.HealthCheckConcurrency)
+	var wg sync.WaitGroup
+	for _, e := range entries {
+		wg.Add(1)
+		go func(e pool.Entry) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			var auth *proxy.Auth
+			if strings.TrimSpace(e.Username) != "" || strings.TrimSpace(e.Password) != "" {
+				auth = &proxy.Auth{User: e.Username, Password: e.Password}
+			}
+			ok, latency := u.checker.CheckAuth(ctx, e.Addr, auth, strict)
+			if ctx.Err() != nil {
+				return
+			}
+			done(e, ok, latency)
+		}(e)
+	}
+	wg.Wait()
 }
 
 func (u *Updater) runOnce(ctx context.Context) {
@@ -119,13 +339,14 @@ func (u *Updater) runOnce(ctx context.Context) {
 	start := time.Now()
 	u.status.SetStart(start)
 	u.log.Info("updating proxy pools")
+	u.reloadGeoIP()
 
 	if u.cfg.Adapters.Xray.Enabled {
 		u.runOnceXray(ctx, start)
-		return
+	} else {
+		u.runOnceLegacy(ctx, start, UpdateDetails{Adapter: "legacy"})
 	}
-
-	u.runOnceLegacy(ctx, start, UpdateDetails{Adapter: "legacy"})
+	u.saveSnapshot()
 }
 
 func (u *Updater) runOnceXray(ctx context.Context, start time.Time) {
@@ -194,6 +415,7 @@ func (u *Updater) runOnceXray(ctx context.Context, start time.Time) {
 
 	now := time.Now()
 	u.status.SetRelaxedNodeHealth(now, hr)
+	byID := specsByID(specs)
 	entries := make([]pool.Entry, 0, len(genRelaxed.Included))
 
 	for _, id := range genRelaxed.Included {
@@ -205,10 +427,17 @@ func (u *Updater) runOnceXray(ctx context.Context, start time.Time) {
 				Password:      u.cfg.Adapters.Xray.UserPassword,
 				Latency:       h.Delay,
 				LastCheckedAt: now,
+				Labels:        byID[id].LabelSet(),
 			})
 		}
 	}
 
+	u.observeTLS(ctx)
+	u.inspectEntries(ctx, entries, false, u.publicIP(ctx))
+	for i := range entries {
+		u.annotateGeo(&entries[i], byID[entries[i].ID].Server)
+	}
+
 	if len(entries) > 0 {
 		u.pool.Update(entries)
 	} else {
@@ -223,17 +452,86 @@ func (u *Updater) runOnceXray(ctx context.Context, start time.Time) {
 		SkippedByType:   mergeSkipped(genRelaxed.Skipped, res.Skipped),
 		XrayRelaxedHash: genRelaxed.Hash,
 	}
+
+	if u.xrayStrict != nil {
+		hash, n, err := u.refreshXrayStrict(ctx, specs)
+		details.XrayStrictHash = hash
+		details.StrictPool = n
+		if err != nil {
+			details.StrictErr = err.Error()
+			u.log.Warn("xray strict refresh failed; keeping existing strict pool", "err", err)
+		}
+	}
+
 	u.status.SetEnd(time.Now(), len(specs), len(entries), nil, details)
 	u.log.Info("update complete",
 		"adapter", "xray",
 		"nodes", len(specs),
 		"pool", len(entries),
+		"strict_pool", details.StrictPool,
 		"took", time.Since(start).String(),
 	)
 }
 
+// refreshXrayStrict runs the STRICT xray instance (certificate verification enforced
+// on every outbound) and publishes its alive nodes into the strict pool.
+func (u *Updater) refreshXrayStrict(ctx context.Context, specs []upstream.Spec) (string, int, error) {
+	gen, err := xray.Generate(specs, xray.GenerateOptions{
+		Mode:          xray.ModeStrict,
+		SOCKSListen:   u.cfg.Adapters.Xray.SOCKSListenStrict,
+		MetricsListen: u.cfg.Adapters.Xray.MetricsListenStrict,
+		UserPassword:  u.cfg.Adapters.Xray.UserPassword,
+		MaxNodes:      u.cfg.Adapters.Xray.MaxNodes,
+		Observatory:   u.cfg.Adapters.Xray.Observatory,
+	})
+	if err != nil {
+		return "", 0, fmt.Errorf("xray config (strict): %w", err)
+	}
+	if err := u.xrayStrict.Ensure(ctx, gen.ConfigJSON, gen.Hash); err != nil {
+		return gen.Hash, 0, fmt.Errorf("xray ensure strict: %w", err)
+	}
+	hs, err := u.metricsStrict.Fetch(ctx)
+	if err != nil {
+		return gen.Hash, 0, fmt.Errorf("metrics strict: %w", err)
+	}
+
+	now := time.Now()
+	u.status.SetStrictNodeHealth(now, hs)
+	byID := specsByID(specs)
+	entries := make([]pool.Entry, 0, len(gen.Included))
+	for _, id := range gen.Included {
+		if h, ok := hs[id]; ok && h.Alive {
+			entries = append(entries, pool.Entry{
+				ID:            id,
+				Addr:          u.cfg.Adapters.Xray.SOCKSListenStrict,
+				Username:      id,
+				Password:      u.cfg.Adapters.Xray.UserPassword,
+				Latency:       h.Delay,
+				LastCheckedAt: now,
+				Labels:        byID[id].LabelSet(),
+			})
+		}
+	}
+
+	u.inspectEntries(ctx, entries, true, u.publicIP(ctx))
+	for i := range entries {
+		u.annotateGeo(&entries[i], byID[entries[i].ID].Server)
+	}
+
+	if len(entries) > 0 {
+		u.poolStrict.Update(entries)
+	} else {
+		u.log.Warn("strict pool empty; keeping existing")
+	}
+	return gen.Hash, len(entries), nil
+}
+
+// publishInterval bounds how long healthy upstreams wait for a full batch before
+// they are published to the pools.
+const publishInterval = time.Second
+
 func (u *Updater) runOnceLegacy(ctx context.Context, start time.Time, details UpdateDetails) {
-	proxies, err := u.loadSOCKS5Upstreams(ctx)
+	proxies, labels, err := u.loadSOCKS5Upstreams(ctx)
 	if err != nil {
 		u.status.SetEnd(time.Now(), 0, 0, err, details)
 		u.log.Warn("fetch failed", "adapter", details.Adapter, "err", err)
@@ -242,44 +540,131 @@ func (u *Updater) runOnceLegacy(ctx context.Context, start time.Time, details Up
 
 	type hc struct {
 		addr    string
+		healthy bool
 		latency time.Duration
+		strict  bool
+		// attrs holds the fields filled in by inspect.
+		attrs pool.Entry
 	}
 
-	sem := make(chan struct{}, u.cfg.HealthCheckConcurrency)
-	results := make(chan hc, len(proxies))
+	publicIP := u.publicIP(ctx)
+	u.observeTLS(ctx)
 
-	var wg sync.WaitGroup
-	for _, addr := range proxies {
-		wg.Add(1)
-		go func(addr string) {
-			defer wg.Done()
-			sem <- struct{}{}
-			defer func() { <-sem }()
+	// Known-good addresses are checked first and chronically failing ones only
+	// once their backoff expires (see History.Plan).
+	due, skipped := u.history.Plan(proxies, time.Now())
 
-			ok, latency := u.checker.Check(ctx, addr, false)
-			if ok {
-				results <- hc{addr: addr, latency: latency}
+	sem := make(chan struct{}, u.cfg.HealthCheckConcurrency)
+	results := make(chan hc, len(due))
+
+	budget := time.Duration(u.cfg.HealthCheck.UpstreamBudgetSeconds) * time.Second
+	check := func(addr string) hc {
+		ctx, cancel := context.WithTimeout(ctx, budget)
+		defer cancel()
+		inspect := func(r hc) hc {
+			r.attrs.Addr = r.addr
+			u.inspect(ctx, &r.attrs, nil, r.strict, publicIP)
+			return r
+		}
+		// A certificate-verified handshake also satisfies the relaxed check,
+		// so only fall back to the relaxed check when strict fails.
+		if u.poolStrict != nil {
+			if ok, latency := u.checker.Check(ctx, addr, true); ok {
+				return inspect(hc{addr: addr, healthy: true, latency: latency, strict: true})
 			}
-		}(addr)
+		}
+		ok, latency := u.checker.Check(ctx, addr, false)
+		if !ok {
+			return hc{addr: addr}
+		}
+		return inspect(hc{addr: addr, healthy: true, latency: latency})
 	}
 
-	wg.Wait()
-	close(results)
+	// Slots are taken in plan order before each check starts, so the order holds
+	// under the concurrency limit; dispatching runs alongside publishing below.
+	go func() {
+		var wg sync.WaitGroup
+		defer close(results)
+		defer wg.Wait()
+		for _, addr := range due {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			wg.Add(1)
+			go func(addr string) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				results <- check(addr)
+			}(addr)
+		}
+	}()
 
 	entries := make([]pool.Entry, 0)
-	now := time.Now()
+	strictEntries := make([]pool.Entry, 0)
+
+	// Healthy upstreams are merged into the pools in batches as results arrive, so
+	// a cold start or a large refresh serves traffic long before the last check
+	// times out; the final Update below drops upstreams that failed.
+	var pending, pendingStrict []pool.Entry
+	publish := func() {
+		u.pool.Merge(pending)
+		if u.poolStrict != nil {
+			u.poolStrict.Merge(pendingStrict)
+		}
+		pending, pendingStrict = nil, nil
+	}
+	flush := time.NewTicker(publishInterval)
+	defer flush.Stop()
+
+	progress := CheckProgress{Running: true, Total: len(due), Skipped: skipped}
+	u.status.SetProgress(progress)
 
 	seen := make(map[string]struct{})
-	for r := range results {
-		if _, ok := seen[r.addr]; ok {
+collect:
+	for {
+		var r hc
+		select {
+		case res, ok := <-results:
+			if !ok {
+				break collect
+			}
+			r = res
+		case <-flush.C:
+			publish()
+			continue
+		}
+
+		progress.Checked++
+		if ctx.Err() == nil {
+			u.history.Record(r.addr, r.healthy, r.latency, time.Now())
+		}
+		if _, dup := seen[r.addr]; !r.healthy || dup {
+			u.status.SetProgress(progress)
 			continue
 		}
 		seen[r.addr] = struct{}{}
-		entries = append(entries, pool.Entry{
-			Addr:          r.addr,
-			Latency:       r.latency,
-			LastCheckedAt: now,
-		})
+		progress.Healthy++
+		u.status.SetProgress(progress)
+
+		e := r.attrs
+		e.Addr = r.addr
+		e.Latency = r.latency
+		e.LastCheckedAt = time.Now()
+		e.Labels = labels[r.addr]
+		if host, _, err := net.SplitHostPort(r.addr); err == nil {
+			u.annotateGeo(&e, host)
+		}
+		entries = append(entries, e)
+		pending = append(pending, e)
+		if r.strict {
+			strictEntries = append(strictEntries, e)
+			pendingStrict = append(pendingStrict, e)
+		}
+		if len(pending) >= u.cfg.HealthCheck.PublishBatchSize {
+			publish()
+		}
 	}
 
 	if len(entries) > 0 {
@@ -287,16 +672,164 @@ func (u *Updater) runOnceLegacy(ctx context.Context, start time.Time, details Up
 	} else {
 		u.log.Warn("pool empty; keeping existing")
 	}
+	if u.poolStrict != nil {
+		details.StrictPool = len(strictEntries)
+		if len(strictEntries) > 0 {
+			u.poolStrict.Update(strictEntries)
+		} else {
+			u.log.Warn("strict pool empty; keeping existing")
+		}
+	}
 
 	u.status.SetEnd(time.Now(), len(proxies), len(entries), nil, details)
 	u.log.Info("update complete",
 		"adapter", details.Adapter,
 		"fetched", len(proxies),
+		"skipped_backoff", skipped,
 		"pool", len(entries),
+		"strict_pool", len(strictEntries),
 		"took", time.Since(start).String(),
 	)
 }
 
+// publicIP returns this host's public IP for anonymity checks, or "" when the
+// checks are disabled or the IP cannot be determined.
+func (u *Updater) publicIP(ctx context.Context) string {
+	if !u.checker.AnonymityEnabled() {
+		return ""
+	}
+	ip, err := u.checker.PublicIP(ctx)
+	if err != nil {
+		u.log.Warn("public ip discovery failed; forwarding headers count as leaks", "err", err)
+		return ""
+	}
+	return ip
+}
+
+// observeTLS refreshes the reference certificate of the TLS interception check
+// from a direct connection (unless pins are configured).
+func (u *Updater) observeTLS(ctx context.Context) {
+	if !u.checker.InterceptionEnabled() {
+		return
+	}
+	if err := u.checker.ObserveDirect(ctx); err != nil {
+		u.log.Warn("tls interception check: direct handshake failed; keeping previous reference", "err", err)
+	}
+}
+
+// inspect runs the optional checks (egress IP, anonymity, TLS interception and
+// throughput) on a healthy upstream and fills in the matching fields of e. A
+// failed check is logged at debug level and leaves its field unknown, so the pool
+// keeps the previous value.
+func (u *Updater) inspect(ctx context.Context, e *pool.Entry, auth *proxy.Auth, strict bool, publicIP string) {
+	if u.checker.EgressIPEnabled() {
+		if ip, err := u.checker.EgressIP(ctx, e.Addr, auth, strict); err != nil {
+			u.log.Debug("egress ip discovery failed", "addr", e.Addr, "err", err)
+		} else {
+			e.EgressIP = ip
+		}
+	}
+	if u.checker.AnonymityEnabled() {
+		if a, err := u.checker.Anonymity(ctx, e.Addr, auth, strict, publicIP); err != nil {
+			u.log.Debug("anonymity check failed", "addr", e.Addr, "err", err)
+		} else {
+			e.Anonymity = a
+		}
+	}
+	if u.checker.InterceptionEnabled() {
+		if bad, err := u.checker.Intercepted(ctx, e.Addr, auth); err != nil {
+			u.log.Debug("tls interception check failed", "addr", e.Addr, "err", err)
+		} else {
+			e.Tainted, e.TaintChecked = bad, true
+			if bad {
+				args := []any{"addr", e.Addr}
+				if auth != nil {
+					args = append(args, "id", auth.User)
+				}
+				u.log.Warn("upstream intercepts tls; marked tainted", args...)
+			}
+		}
+	}
+	if u.checker.ThroughputEnabled() {
+		if bps, err := u.checker.Throughput(ctx, e.Addr, auth, strict); err != nil {
+			u.log.Debug("throughput probe failed", "addr", e.Addr, "err", err)
+		} else {
+			e.Throughput = bps
+		}
+	}
+}
+
+// inspectEntries fills in EgressIP, Anonymity, Tainted and Throughput for entries
+// routed through xray, which all share the xray listen address and differ by
+// account.
+func (u *Updater) inspectEntries(ctx context.Context, entries []pool.Entry, strict bool, publicIP string) {
+	if !u.checker.EgressIPEnabled() && !u.checker.AnonymityEnabled() && !u.checker.InterceptionEnabled() && !u.checker.ThroughputEnabled() {
+		return
+	}
+	budget := time.Duration(u.cfg.HealthCheck.UpstreamBudgetSeconds) * time.Second
+	sem := make(chan struct{}, u.cfg.HealthCheckConcurrency)
+	var wg sync.WaitGroup
+	for i := range entries {
+		wg.Add(1)
+		go func(e *pool.Entry) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			ctx, cancel := context.WithTimeout(ctx, budget)
+			defer cancel()
+			u.inspect(ctx, e, &proxy.Auth{User: e.Username, Password: e.Password}, strict, publicIP)
+		}(&entries[i])
+	}
+	wg.Wait()
+}
+
+// reloadGeoIP re-reads GeoIP databases that changed on disk, when enabled.
+func (u *Updater) reloadGeoIP() {
+	if u.geo == nil || (u.cfg.GeoIP.ReloadOnChange != nil && !*u.cfg.GeoIP.ReloadOnChange) {
+		return
+	}
+	reloaded, err := u.geo.Reload()
+	if err != nil {
+		u.log.Warn("geoip reload failed; keeping previous database", "err", err)
+	}
+	if len(reloaded) > 0 {
+		u.log.Info("geoip databases reloaded", "paths", reloaded)
+	}
+}
+
+// annotateGeo resolves the country and ASN of e from its egress IP, falling back
+// to server (the upstream's own address; hostnames are not resolved), and exposes
+// them as the country and asn labels.
+func (u *Updater) annotateGeo(e *pool.Entry, server string) {
+	if u.geo == nil {
+		return
+	}
+	ip := net.ParseIP(e.EgressIP)
+	if ip == nil {
+		ip = net.ParseIP(server)
+	}
+	if ip == nil {
+		return
+	}
+	info := u.geo.Lookup(ip)
+	e.Country, e.ASN, e.ASOrg = info.Country, info.ASN, info.ASOrg
+	if info.Country == "" && info.ASN == 0 {
+		return
+	}
+	// Labels may be shared between entries of the same source; copy before adding.
+	labels := make(map[string]string, len(e.Labels)+2)
+	for k, v := range e.Labels {
+		labels[k] = v
+	}
+	if info.Country != "" {
+		labels[upstream.LabelCountry] = info.Country
+	}
+	if info.ASN != 0 {
+		labels[upstream.LabelASN] = strconv.FormatUint(uint64(info.ASN), 10)
+	}
+	e.Labels = labels
+}
+
 func mergeSkipped(mm ...map[string]int) map[string]int {
 	out := make(map[string]int)
 	for _, m := range mm {
@@ -307,13 +840,20 @@ func mergeSkipped(mm ...map[string]int) map[string]int {
 	return out
 }
 
+// reportSources publishes the status of the typed sources followed by the legacy
+// proxy_list_urls.
+func (u *Updater) reportSources() {
+	u.status.SetSources(append(u.sources.Status(), sources.ListStatus(u.fetcher.ListStatus())...))
+}
+
 func (u *Updater) loadUpstreamSpecs(ctx context.Context) ([]upstream.Spec, sources.Result, error) {
 	var res sources.Result
 	var specs []upstream.Spec
 
 	// 1) Typed sources.
 	if len(u.cfg.Sources) > 0 {
-		r, err := sources.New(u.log).Load(ctx, u.cfg.Sources)
+		r, err := u.sources.Load(ctx, u.cfg.Sources)
+		u.reportSources()
 		if err != nil {
 			return nil, sources.Result{}, err
 		}
@@ -321,6 +861,7 @@ func (u *Updater) loadUpstreamSpecs(ctx context.Context) ([]upstream.Spec, sourc
 		specs = append(specs, r.Specs...)
 		for _, a := range r.SOCKS5Addrs {
 			if s, ok := socks5SpecFromAddr(a); ok {
+				s.Labels = r.AddrLabels[a]
 				specs = append(specs, s)
 			}
 		}
@@ -329,6 +870,7 @@ func (u *Updater) loadUpstreamSpecs(ctx context.Context) ([]upstream.Spec, sourc
 	// 2) Legacy URL lists, mapped to SOCKS5 specs.
 	if len(u.cfg.ProxyListURLs) > 0 {
 		addrs, err := u.fetcher.Fetch(ctx, u.cfg.ProxyListURLs)
+		u.reportSources()
 		if err != nil {
 			return nil, res, err
 		}
@@ -360,36 +902,43 @@ func socks5SpecFromAddr(addr string) (upstream.Spec, bool) {
 	}.Normalize(), true
 }
 
-func (u *Updater) loadSOCKS5Upstreams(ctx context.Context) ([]string, error) {
+// loadSOCKS5Upstreams returns the SOCKS5 addresses usable without adapters together
+// with their selection labels.
+func (u *Updater) loadSOCKS5Upstreams(ctx context.Context) ([]string, map[string]map[string]string, error) {
 	set := make(map[string]struct{})
+	labels := make(map[string]map[string]string)
 	var out []string
-	add := func(addr string) {
+	add := func(addr string, l map[string]string) {
 		if _, ok := set[addr]; ok {
 			return
 		}
 		set[addr] = struct{}{}
 		out = append(out, addr)
+		labels[addr] = l
 	}
 
 	// Legacy line-based sources.
 	if len(u.cfg.ProxyListURLs) > 0 {
 		addrs, err := u.fetcher.Fetch(ctx, u.cfg.ProxyListURLs)
+		u.reportSources()
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
+		l := upstream.Spec{Type: upstream.TypeSOCKS5}.LabelSet()
 		for _, a := range addrs {
-			add(a)
+			add(a, l)
 		}
 	}
 
 	// Typed sources (currently only SOCKS5 nodes are usable without adapters).
 	if len(u.cfg.Sources) > 0 {
-		res, err := sources.New(u.log).Load(ctx, u.cfg.Sources)
+		res, err := u.sources.Load(ctx, u.cfg.Sources)
+		u.reportSources()
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		for _, a := range res.SOCKS5Addrs {
-			add(a)
+			add(a, res.AddrLabels[a])
 		}
 		for _, p := range res.Problems {
 			u.log.Warn("source problem", "msg", p)
@@ -397,9 +946,17 @@ func (u *Updater) loadSOCKS5Upstreams(ctx context.Context) ([]string, error) {
 	}
 
 	if len(out) == 0 {
-		return nil, fmt.Errorf("no proxies fetched from any source")
+		return nil, nil, fmt.Errorf("no proxies fetched from any source")
+	}
+	return out, labels, nil
+}
+
+func specsByID(specs []upstream.Spec) map[string]upstream.Spec {
+	out := make(map[string]upstream.Spec, len(specs))
+	for _, s := range specs {
+		out[s.ID] = s
 	}
-	return out, nil
+	return out
 }
 
 func (u *Updater) String() string {
@@ -0,0 +1,44 @@
+package pool
+
+import "strings"
+
+// Anonymity is how much an upstream reveals to destinations, as classified by
+// the anonymity health check. The zero value means the level is unknown.
+type Anonymity string
+
+const (
+	// AnonymityTransparent upstreams forward the client's own IP.
+	AnonymityTransparent Anonymity = "transparent"
+	// AnonymityAnonymous upstreams hide the client's IP but announce a proxy
+	// (e.g. Via or X-Forwarded-For headers).
+	AnonymityAnonymous Anonymity = "anonymous"
+	// AnonymityElite upstreams are indistinguishable from a direct client.
+	AnonymityElite Anonymity = "elite"
+)
+
+// ParseAnonymity parses a level name; the empty string is the unknown level.
+func ParseAnonymity(s string) (Anonymity, bool) {
+	switch a := Anonymity(strings.ToLower(strings.TrimSpace(s))); a {
+	case "", AnonymityTransparent, AnonymityAnonymous, AnonymityElite:
+		return a, true
+	}
+	return "", false
+}
+
+func (a Anonymity) rank() int {
+	switch a {
+	case AnonymityTransparent:
+		return 1
+	case AnonymityAnonymous:
+		return 2
+	case AnonymityElite:
+		return 3
+	}
+	return 0
+}
+
+// Admits reports whether an upstream with level a satisfies the minimum level
+// min. Unknown levels are admitted: only upstreams known to leak are excluded.
+func (a Anonymity) Admits(min Anonymity) bool {
+	return a == "" || a.rank() >= min.rank()
+}
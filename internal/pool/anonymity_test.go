@@ -0,0 +1,44 @@
+package pool
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUpdate_MinAnonymity(t *testing.T) {
+	p := newTestPool(t)
+	p.SetAttributeFilter(AttributeFilter{MinAnonymity: AnonymityAnonymous})
+	p.Update([]Entry{
+		{Addr: "leak:1080", Anonymity: AnonymityTransparent},
+		{Addr: "anon:1080", Anonymity: AnonymityAnonymous},
+		{Addr: "elite:1080", Anonymity: AnonymityElite},
+		{Addr: "unknown:1080"},
+	})
+
+	got := map[string]bool{}
+	for _, e := range p.Active(time.Now()) {
+		got[e.Addr] = true
+	}
+	if len(got) != 3 || got["leak:1080"] {
+		t.Fatalf("expected the transparent upstream to be excluded, got %v", got)
+	}
+
+	// A level learned earlier still applies when this round could not classify.
+	p.SetAttributeFilter(AttributeFilter{MinAnonymity: AnonymityElite})
+	p.Update([]Entry{{Addr: "anon:1080"}, {Addr: "elite:1080"}})
+	active := p.Active(time.Now())
+	if len(active) != 1 || active[0].Addr != "elite:1080" {
+		t.Fatalf("expected only the elite upstream, got %+v", active)
+	}
+}
+
+func TestParseAnonymity(t *testing.T) {
+	for in, want := range map[string]Anonymity{"": "", "Elite": AnonymityElite, " anonymous ": AnonymityAnonymous} {
+		if got, ok := ParseAnonymity(in); !ok || got != want {
+			t.Fatalf("%q: got %q, %v", in, got, ok)
+		}
+	}
+	if _, ok := ParseAnonymity("high"); ok {
+		t.Fatalf("expected unknown level to be rejected")
+	}
+}
@@ -0,0 +1,43 @@
+package pool
+
+// AttributeFilter holds the thresholds applied to the attributes the health checks
+// attach to entries: egress IP, anonymity, taint and throughput.
+type AttributeFilter struct {
+	// DedupByEgressIP makes Update keep a single entry per egress IP (the one with
+	// the lowest health-check latency), so selection rotates across distinct IPs.
+	// Entries with an unknown egress IP are always kept.
+	DedupByEgressIP bool
+	// MinAnonymity makes Update drop entries classified below it. The empty level
+	// disables the filter.
+	MinAnonymity Anonymity
+	// AllowTainted lets selection use entries flagged as intercepting TLS. By
+	// default tainted entries stay in the pool (and the admin API) but are never
+	// handed out.
+	AllowTainted bool
+	// MinThroughput makes selection skip entries measured below it, in bytes per
+	// second. Entries that were never measured are still selected; 0 disables the
+	// threshold.
+	MinThroughput int64
+}
+
+// SetAttributeFilter configures the attribute thresholds of the pool.
+func (p *Pool) SetAttributeFilter(f AttributeFilter) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.attrs = f
+}
+
+// keeps reports whether Update and Merge keep e in the pool.
+func (f AttributeFilter) keeps(e Entry) bool {
+	return e.Anonymity.Admits(f.MinAnonymity)
+}
+
+// trusts reports whether e may be handed out given its taint.
+func (f AttributeFilter) trusts(e Entry) bool {
+	return !e.Tainted || f.AllowTainted
+}
+
+// selects reports whether selection may hand out e.
+func (f AttributeFilter) selects(e Entry) bool {
+	return f.trusts(e) && (f.MinThroughput <= 0 || e.Throughput == 0 || e.Throughput >= f.MinThroughput)
+}
@@ -0,0 +1,173 @@
+package pool
+
+import "time"
+
+// BreakerState is the circuit breaker state of a pool entry.
+type BreakerState string
+
+const (
+	// BreakerClosed admits all traffic.
+	BreakerClosed BreakerState = "closed"
+	// BreakerOpen rejects all traffic until the open period expires.
+	BreakerOpen BreakerState = "open"
+	// BreakerHalfOpen admits a limited number of trial requests (or background
+	// probes) whose outcome decides between closing and re-opening.
+	BreakerHalfOpen BreakerState = "half_open"
+)
+
+type BreakerConfig struct {
+	// FailureThreshold is the number of consecutive failures that trips a closed breaker.
+	FailureThreshold int
+	// HalfOpenMaxRequests is the number of concurrent trial requests admitted while
+	// half-open. 0 means only background probes may close the breaker.
+	HalfOpenMaxRequests int
+}
+
+func DefaultBreakerConfig() BreakerConfig {
+	return BreakerConfig{FailureThreshold: 1, HalfOpenMaxRequests: 1}
+}
+
+// SetBreaker configures the per-entry circuit breaker.
+func (p *Pool) SetBreaker(cfg BreakerConfig) {
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = 1
+	}
+	if cfg.HalfOpenMaxRequests < 0 {
+		cfg.HalfOpenMaxRequests = 0
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.breaker = cfg
+}
+
+// BreakerState derives the entry's breaker state at now. An entry whose open
+// period has expired stays half-open until a success or failure resolves it.
+func (e Entry) BreakerState(now time.Time) BreakerState {
+	if e.disabledUntil.IsZero() {
+		return BreakerClosed
+	}
+	if now.Before(e.disabledUntil) {
+		return BreakerOpen
+	}
+	return BreakerHalfOpen
+}
+
+// DisabledUntil returns the end of the current (or last) open period; zero when closed.
+func (e Entry) DisabledUntil() time.Time { return e.disabledUntil }
+
+// trialKey identifies the half-open period of an entry: each trip sets a new
+// disabledUntil, so trials of an earlier period never count against a later one.
+type trialKey struct {
+	key    string
+	period time.Time
+}
+
+// admits reports whether the breaker lets traffic through e. Half-open entries
+// admit at most HalfOpenMaxRequests concurrent trials, reserved by AcquireNext and
+// AcquireKey; connections opened before the trip are not trials.
+// Callers must hold p.mu.
+func (p *Pool) admits(e Entry, now time.Time) bool {
+	switch e.BreakerState(now) {
+	case BreakerClosed:
+		return true
+	case BreakerHalfOpen:
+		return p.trials[trialKey{key: e.Key(), period: e.disabledUntil}] < p.breaker.HalfOpenMaxRequests
+	default:
+		return false
+	}
+}
+
+// reserveTrialLocked counts a connection through e as a trial if e is half-open
+// and returns the func that ends it; nil otherwise. Callers must hold p.mu.
+func (p *Pool) reserveTrialLocked(e Entry, now time.Time) func() {
+	if e.BreakerState(now) != BreakerHalfOpen {
+		return nil
+	}
+	tk := trialKey{key: e.Key(), period: e.disabledUntil}
+	p.trials[tk]++
+	return func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if p.trials[tk] <= 1 {
+			delete(p.trials, tk)
+			return
+		}
+		p.trials[tk]--
+	}
+}
+
+// HalfOpen returns entries whose open period has expired and that are waiting for
+// a trial request or background probe.
+func (p *Pool) HalfOpen(now time.Time) []Entry {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	var out []Entry
+	for i := range p.entries {
+		if p.entries[i].BreakerState(now) == BreakerHalfOpen {
+			out = append(out, p.entries[i])
+		}
+	}
+	return out
+}
+
+// MarkSuccess records a successful dial through key at now and closes its
+// breaker. A success while the breaker is open comes from a connection opened
+// before the trip and leaves the breaker alone: only a half-open trial or probe
+// closes it.
+func (p *Pool) MarkSuccess(key string, now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	idx, ok := p.index[key]
+	if !ok {
+		return
+	}
+	e := &p.entries[idx]
+	e.successTotal++
+	if e.BreakerState(now) == BreakerOpen {
+		return
+	}
+	e.failures = 0
+	e.opens = 0
+	e.disabledUntil = time.Time{}
+}
+
+// MarkFailure records a failed dial through key. A closed breaker trips after
+// FailureThreshold consecutive failures; a failed half-open trial re-opens it
+// immediately. Each consecutive trip doubles the open period, starting at
+// baseBackoff and capped at maxBackoff.
+func (p *Pool) MarkFailure(key string, now time.Time, baseBackoff, maxBackoff time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	idx, ok := p.index[key]
+	if !ok {
+		return
+	}
+	e := &p.entries[idx]
+	e.failureTotal++
+
+	switch e.BreakerState(now) {
+	case BreakerOpen:
+		// Already open (e.g. a straggler from before the trip); keep the period.
+		return
+	case BreakerClosed:
+		e.failures++
+		if e.failures < p.breaker.FailureThreshold {
+			return
+		}
+	}
+
+	e.opens++
+	e.disabledUntil = now.Add(backoffFor(e.opens, baseBackoff, maxBackoff))
+}
+
+func backoffFor(opens int, base, maxBackoff time.Duration) time.Duration {
+	backoff := base
+	for i := 1; i < opens; i++ {
+		backoff *= 2
+		if backoff >= maxBackoff {
+			return maxBackoff
+		}
+	}
+	return backoff
+}
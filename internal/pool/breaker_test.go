@@ -0,0 +1,128 @@
+package pool
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBreaker_HalfOpenLimitsTrials(t *testing.T) {
+	p := newTestPool(t, Entry{Addr: "a:1080"})
+	p.SetBreaker(BreakerConfig{FailureThreshold: 2, HalfOpenMaxRequests: 1})
+
+	now := time.Now()
+	p.MarkFailure("a:1080", now, time.Minute, time.Hour)
+	if _, ok := p.Next("round_robin", now); !ok {
+		t.Fatalf("expected breaker closed below threshold")
+	}
+	p.MarkFailure("a:1080", now, time.Minute, time.Hour)
+	if _, ok := p.Next("round_robin", now); ok {
+		t.Fatalf("expected breaker open at threshold")
+	}
+
+	later := now.Add(2 * time.Minute)
+	e, release, ok := p.AcquireNext("round_robin", Query{}, later)
+	if !ok || e.BreakerState(later) != BreakerHalfOpen {
+		t.Fatalf("expected half-open trial, got ok=%v", ok)
+	}
+	if _, _, ok := p.AcquireNext("round_robin", Query{}, later); ok {
+		t.Fatalf("expected only one concurrent trial while half-open")
+	}
+	if _, _, ok := p.AcquireKey(e.Key(), later); ok {
+		t.Fatalf("expected a forced pick to respect the trial limit")
+	}
+	release()
+
+	// Failed trial re-opens with a doubled period.
+	p.MarkFailure("a:1080", later, time.Minute, time.Hour)
+	if _, ok := p.Next("round_robin", later.Add(90*time.Second)); ok {
+		t.Fatalf("expected breaker re-opened for 2m")
+	}
+	e, ok = p.Get("a:1080", later.Add(3*time.Minute))
+	if !ok {
+		t.Fatalf("expected half-open after doubled period")
+	}
+	if got := e.DisabledUntil().Sub(later); got != 2*time.Minute {
+		t.Fatalf("expected 2m open period, got %v", got)
+	}
+
+	// Successful trial closes the breaker.
+	p.MarkSuccess("a:1080", later.Add(3*time.Minute))
+	if st := p.Stats(later); st.Disabled != 0 || st.HalfOpen != 0 {
+		t.Fatalf("expected closed breaker, got %+v", st)
+	}
+}
+
+func TestBreaker_ProbeOnlyReadmission(t *testing.T) {
+	p := newTestPool(t, Entry{Addr: "a:1080"})
+	p.SetBreaker(BreakerConfig{FailureThreshold: 1, HalfOpenMaxRequests: 0})
+
+	now := time.Now()
+	p.MarkFailure("a:1080", now, time.Minute, time.Hour)
+
+	later := now.Add(2 * time.Minute)
+	if _, ok := p.Next("round_robin", later); ok {
+		t.Fatalf("expected no user traffic while half-open without trials")
+	}
+	if got := p.HalfOpen(later); len(got) != 1 {
+		t.Fatalf("expected 1 half-open entry for probing, got %d", len(got))
+	}
+	p.MarkSuccess("a:1080", later)
+	if _, ok := p.Next("round_robin", later); !ok {
+		t.Fatalf("expected readmitted after probe success")
+	}
+}
+
+func TestBreaker_SuccessWhileOpenDoesNotClose(t *testing.T) {
+	p := newTestPool(t, Entry{Addr: "a:1080"})
+	p.SetBreaker(BreakerConfig{FailureThreshold: 1, HalfOpenMaxRequests: 1})
+
+	// A connection opened before the trip succeeds while the breaker is open.
+	now := time.Now()
+	p.MarkFailure("a:1080", now, time.Minute, time.Hour)
+	p.MarkSuccess("a:1080", now.Add(time.Second))
+	if _, ok := p.Next("round_robin", now.Add(2*time.Second)); ok {
+		t.Fatalf("expected the breaker to stay open")
+	}
+	e := p.Entries()[0]
+	if got := e.DisabledUntil().Sub(now); got != time.Minute {
+		t.Fatalf("expected the open period to be kept, got %v", got)
+	}
+	if s, _ := e.Usage(); s != 1 {
+		t.Fatalf("expected the success to be counted, got %d", s)
+	}
+
+	// The next trip still doubles the period: the straggler did not reset it.
+	later := now.Add(2 * time.Minute)
+	p.MarkFailure("a:1080", later, time.Minute, time.Hour)
+	if got := p.Entries()[0].DisabledUntil().Sub(later); got != 2*time.Minute {
+		t.Fatalf("expected a doubled open period, got %v", got)
+	}
+}
+
+func TestBreaker_PreTripConnectionsAreNotTrials(t *testing.T) {
+	p := newTestPool(t, Entry{Addr: "a:1080"})
+	p.SetBreaker(BreakerConfig{FailureThreshold: 1, HalfOpenMaxRequests: 1})
+
+	now := time.Now()
+	_, releaseTunnel, ok := p.AcquireNext("round_robin", Query{}, now)
+	if !ok {
+		t.Fatalf("expected an upstream")
+	}
+	defer releaseTunnel()
+	p.MarkFailure("a:1080", now, time.Minute, time.Hour)
+
+	// A long-lived tunnel from before the trip does not use up the trial.
+	later := now.Add(2 * time.Minute)
+	_, release, ok := p.AcquireNext("round_robin", Query{}, later)
+	if !ok {
+		t.Fatalf("expected a half-open trial despite the pre-trip tunnel")
+	}
+
+	// A trial still open when the breaker trips again does not count against the
+	// next half-open period.
+	p.MarkFailure("a:1080", later, time.Minute, time.Hour)
+	if _, _, ok := p.AcquireNext("round_robin", Query{}, later.Add(3*time.Minute)); !ok {
+		t.Fatalf("expected a trial in the next half-open period")
+	}
+	release()
+}
@@ -0,0 +1,141 @@
+package pool
+
+import (
+	"net"
+	"strings"
+	"time"
+)
+
+// Query narrows selection to upstreams suitable for one request.
+type Query struct {
+	// Host is the destination host (without port). Upstreams with an active
+	// per-destination failure for Host are skipped.
+	Host string
+	// Labels restricts selection to entries carrying all of these labels.
+	Labels map[string]string
+}
+
+// DefaultMaxDestinationPairs bounds the (upstream, destination) failure table.
+const DefaultMaxDestinationPairs = 10000
+
+type destKey struct {
+	key  string
+	host string
+}
+
+type destState struct {
+	failures      int
+	disabledUntil time.Time
+	updatedAt     time.Time
+}
+
+// NormalizeHost lowercases host and strips any port so that "Example.com:443" and
+// "example.com" share per-destination state.
+func NormalizeHost(host string) string {
+	host = strings.TrimSpace(host)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+// SetMaxDestinationPairs bounds the per-destination failure table. When full, expired
+// pairs are dropped first and then the least recently updated ones.
+func (p *Pool) SetMaxDestinationPairs(n int) {
+	if n <= 0 {
+		n = DefaultMaxDestinationPairs
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.maxDestPairs = n
+	p.evictDestLocked(time.Now())
+}
+
+// MarkDestFailure records that key failed to reach host. Only this pair is backed
+// off; the upstream stays selectable for other destinations.
+func (p *Pool) MarkDestFailure(key, host string, now time.Time, baseBackoff, maxBackoff time.Duration) {
+	host = NormalizeHost(host)
+	if host == "" {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.index[key]; !ok {
+		return
+	}
+
+	dk := destKey{key: key, host: host}
+	st, ok := p.dest[dk]
+	if !ok {
+		if len(p.dest) >= p.maxDestPairs {
+			p.evictDestLocked(now)
+		}
+		st = &destState{}
+		p.dest[dk] = st
+	}
+	st.failures++
+	st.updatedAt = now
+	st.disabledUntil = now.Add(backoffFor(st.failures, baseBackoff, maxBackoff))
+}
+
+// MarkDestSuccess clears any per-destination failure state for (key, host).
+func (p *Pool) MarkDestSuccess(key, host string) {
+	host = NormalizeHost(host)
+	if host == "" {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.dest, destKey{key: key, host: host})
+}
+
+// destBlocked reports whether (key, host) is backed off. Callers must hold p.mu.
+func (p *Pool) destBlocked(key, host string, now time.Time) bool {
+	if host == "" || len(p.dest) == 0 {
+		return false
+	}
+	st, ok := p.dest[destKey{key: key, host: host}]
+	return ok && now.Before(st.disabledUntil)
+}
+
+// evictDestLocked makes room in the pair table. Callers must hold p.mu.
+func (p *Pool) evictDestLocked(now time.Time) {
+	for k, st := range p.dest {
+		if !now.Before(st.disabledUntil) {
+			delete(p.dest, k)
+		}
+	}
+	for len(p.dest) >= p.maxDestPairs {
+		var oldest destKey
+		var oldestAt time.Time
+		first := true
+		for k, st := range p.dest {
+			if first || st.updatedAt.Before(oldestAt) {
+				oldest, oldestAt, first = k, st.updatedAt, false
+			}
+		}
+		delete(p.dest, oldest)
+	}
+}
+
+// pruneDestLocked drops pairs whose upstream is no longer in the pool.
+// Callers must hold p.mu.
+func (p *Pool) pruneDestLocked() {
+	for k := range p.dest {
+		if _, ok := p.index[k.key]; !ok {
+			delete(p.dest, k)
+		}
+	}
+}
+
+// destBlockedCount returns the number of currently backed-off pairs.
+// Callers must hold p.mu.
+func (p *Pool) destBlockedCount(now time.Time) int {
+	n := 0
+	for _, st := range p.dest {
+		if now.Before(st.disabledUntil) {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,60 @@
+package pool
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDestFailure_OnlyBlocksThatHost(t *testing.T) {
+	p := newTestPool(t, Entry{Addr: "a:1080"})
+	now := time.Now()
+
+	p.MarkDestFailure("a:1080", "Example.com:443", now, time.Minute, time.Hour)
+
+	if _, ok := p.NextFor("round_robin", Query{Host: "example.com"}, now); ok {
+		t.Fatalf("expected upstream to be skipped for example.com")
+	}
+	if _, ok := p.NextFor("round_robin", Query{Host: "other.org"}, now); !ok {
+		t.Fatalf("expected upstream to stay selectable for other.org")
+	}
+	if _, ok := p.Next("round_robin", now); !ok {
+		t.Fatalf("expected upstream to stay selectable without a host")
+	}
+	if _, ok := p.NextFor("round_robin", Query{Host: "example.com"}, now.Add(2*time.Minute)); !ok {
+		t.Fatalf("expected pair to recover after backoff")
+	}
+
+	p.MarkDestFailure("a:1080", "example.com", now, time.Minute, time.Hour)
+	p.MarkDestSuccess("a:1080", "example.com")
+	if _, ok := p.NextFor("round_robin", Query{Host: "example.com"}, now); !ok {
+		t.Fatalf("expected success to clear pair state")
+	}
+}
+
+func TestDestFailure_BoundedTable(t *testing.T) {
+	p := newTestPool(t, Entry{Addr: "a:1080"})
+	p.SetMaxDestinationPairs(2)
+	now := time.Now()
+
+	p.MarkDestFailure("a:1080", "h1", now, time.Minute, time.Hour)
+	p.MarkDestFailure("a:1080", "h2", now.Add(time.Second), time.Minute, time.Hour)
+	p.MarkDestFailure("a:1080", "h3", now.Add(2*time.Second), time.Minute, time.Hour)
+
+	if got := p.Stats(now.Add(3 * time.Second)).DestinationBlocks; got != 2 {
+		t.Fatalf("expected 2 blocked pairs, got %d", got)
+	}
+	if _, ok := p.NextFor("round_robin", Query{Host: "h1"}, now.Add(3*time.Second)); !ok {
+		t.Fatalf("expected oldest pair h1 to be evicted")
+	}
+}
+
+func TestDestFailure_PrunedOnUpdate(t *testing.T) {
+	p := newTestPool(t, Entry{Addr: "a:1080"}, Entry{Addr: "b:1080"})
+	now := time.Now()
+	p.MarkDestFailure("a:1080", "h", now, time.Minute, time.Hour)
+
+	p.Update([]Entry{{Addr: "b:1080"}})
+	if got := p.Stats(now).DestinationBlocks; got != 0 {
+		t.Fatalf("expected pairs of removed upstreams to be pruned, got %d", got)
+	}
+}
@@ -0,0 +1,39 @@
+package pool
+
+// collapseEgressLocked drops entries sharing an egress IP with a faster one and
+// returns the remaining entries in their original order. An IP known only from
+// the current pool (see carryState) counts as well. Callers must hold p.mu.
+func (p *Pool) collapseEgressLocked(entries []Entry) ([]Entry, int) {
+	best := make(map[string]int, len(entries))
+	for i := range entries {
+		ip := p.egressIPLocked(entries[i])
+		if ip == "" {
+			continue
+		}
+		j, ok := best[ip]
+		if !ok || latencyOrDefault(entries[i].Latency) < latencyOrDefault(entries[j].Latency) {
+			best[ip] = i
+		}
+	}
+
+	out := make([]Entry, 0, len(entries))
+	for i := range entries {
+		if ip := p.egressIPLocked(entries[i]); ip != "" && best[ip] != i {
+			continue
+		}
+		out = append(out, entries[i])
+	}
+	return out, len(entries) - len(out)
+}
+
+// egressIPLocked returns e's egress IP, falling back to the one recorded for the
+// same key in the pool. Callers must hold p.mu.
+func (p *Pool) egressIPLocked(e Entry) string {
+	if e.EgressIP != "" {
+		return e.EgressIP
+	}
+	if idx, ok := p.index[e.Key()]; ok {
+		return p.entries[idx].EgressIP
+	}
+	return ""
+}
@@ -0,0 +1,50 @@
+package pool
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUpdate_DedupByEgressIP(t *testing.T) {
+	p := newTestPool(t)
+	p.SetAttributeFilter(AttributeFilter{DedupByEgressIP: true})
+	p.Update([]Entry{
+		{Addr: "a:1080", EgressIP: "203.0.113.1", Latency: 300 * time.Millisecond},
+		{Addr: "b:1080", EgressIP: "203.0.113.1", Latency: 100 * time.Millisecond},
+		{Addr: "c:1080", EgressIP: "203.0.113.2"},
+		{Addr: "d:1080"},
+		{Addr: "e:1080"},
+	})
+
+	got := map[string]bool{}
+	for _, e := range p.Active(time.Now()) {
+		got[e.Addr] = true
+	}
+	if len(got) != 4 || got["a:1080"] || !got["b:1080"] || !got["c:1080"] || !got["d:1080"] || !got["e:1080"] {
+		t.Fatalf("expected the slower duplicate to be collapsed, got %v", got)
+	}
+
+	// An IP that could not be re-discovered is carried over from the previous round.
+	p.Update([]Entry{
+		{Addr: "b:1080", Latency: 100 * time.Millisecond},
+		{Addr: "f:1080", EgressIP: "203.0.113.1", Latency: 200 * time.Millisecond},
+	})
+	active := p.Active(time.Now())
+	if len(active) != 1 || active[0].Addr != "b:1080" || active[0].EgressIP != "203.0.113.1" {
+		t.Fatalf("expected b to keep its egress IP and win, got %+v", active)
+	}
+}
+
+func TestUpdate_AnonymityFilterBeforeEgressCollapse(t *testing.T) {
+	p := newTestPool(t)
+	p.SetAttributeFilter(AttributeFilter{DedupByEgressIP: true, MinAnonymity: AnonymityAnonymous})
+	p.Update([]Entry{
+		{Addr: "leaky:1080", EgressIP: "203.0.113.1", Anonymity: AnonymityTransparent, Latency: 50 * time.Millisecond},
+		{Addr: "elite:1080", EgressIP: "203.0.113.1", Anonymity: AnonymityElite, Latency: 300 * time.Millisecond},
+	})
+
+	active := p.Active(time.Now())
+	if len(active) != 1 || active[0].Addr != "elite:1080" {
+		t.Fatalf("expected the admissible upstream to survive the collapse, got %+v", active)
+	}
+}
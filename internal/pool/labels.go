@@ -0,0 +1,46 @@
+package pool
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseLabelSelector parses a selector of the form "key=value[,key=value...]",
+// e.g. "type=vless,source=premium". Keys are lowercased; an empty string yields
+// a nil selector.
+func ParseLabelSelector(s string) (map[string]string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	out := make(map[string]string)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(part, "=")
+		k = strings.ToLower(strings.TrimSpace(k))
+		v = strings.TrimSpace(v)
+		if !ok || k == "" || v == "" {
+			return nil, fmt.Errorf("invalid label selector %q (use key=value[,key=value])", part)
+		}
+		out[k] = v
+	}
+	if len(out) == 0 {
+		return nil, nil
+	}
+	return out, nil
+}
+
+// MatchLabels reports whether e carries every label in sel. Values are compared
+// case-insensitively. An empty selector matches every entry.
+func (e Entry) MatchLabels(sel map[string]string) bool {
+	for k, want := range sel {
+		got, ok := e.Labels[k]
+		if !ok || !strings.EqualFold(got, want) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,51 @@
+package pool
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseLabelSelector(t *testing.T) {
+	sel, err := ParseLabelSelector(" Type=vless , source=premium,")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(sel) != 2 || sel["type"] != "vless" || sel["source"] != "premium" {
+		t.Fatalf("unexpected selector: %v", sel)
+	}
+
+	if sel, err := ParseLabelSelector(""); err != nil || sel != nil {
+		t.Fatalf("expected nil selector for empty input, got %v, %v", sel, err)
+	}
+	for _, bad := range []string{"type", "=vless", "type="} {
+		if _, err := ParseLabelSelector(bad); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestNextFor_FiltersByLabels(t *testing.T) {
+	p := newTestPool(t,
+		Entry{ID: "a", Addr: "x:1", Labels: map[string]string{"type": "vmess", "source": "free"}},
+		Entry{ID: "b", Addr: "x:1", Labels: map[string]string{"type": "vless", "source": "premium"}},
+		Entry{ID: "c", Addr: "x:1", Labels: map[string]string{"type": "vless", "source": "free"}},
+	)
+	now := time.Now()
+	q := Query{Labels: map[string]string{"type": "VLESS", "source": "premium"}}
+
+	for _, strategy := range []string{"round_robin", "random", "latency_weighted", "p2c_ewma", "least_conn"} {
+		for i := 0; i < 10; i++ {
+			e, ok := p.NextFor(strategy, q, now)
+			if !ok || e.ID != "b" {
+				t.Fatalf("%s: expected b, got %q (ok=%v)", strategy, e.ID, ok)
+			}
+		}
+	}
+
+	if got := p.ActiveFor(Query{Labels: map[string]string{"type": "vless"}}, now); len(got) != 2 {
+		t.Fatalf("expected 2 vless entries, got %d", len(got))
+	}
+	if _, ok := p.NextFor("round_robin", Query{Labels: map[string]string{"type": "trojan"}}, now); ok {
+		t.Fatalf("expected no match for type=trojan")
+	}
+}
@@ -0,0 +1,348 @@
+package pool
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// LeaseConfig bounds how long a sticky session stays on one upstream.
+type LeaseConfig struct {
+	// TTL rotates a session to another upstream after this long (0 = no limit).
+	TTL time.Duration
+	// MaxUses rotates a session after this many picks (0 = no limit).
+	MaxUses int
+	// MaxSessions bounds the table; the least recently used leases are evicted
+	// first (0 = defaultMaxLeases).
+	MaxSessions int
+}
+
+// defaultMaxLeases is the table size used when LeaseConfig.MaxSessions is unset.
+const defaultMaxLeases = 10000
+
+// leaseIdleTimeout is how long an unused lease is kept at least.
+const leaseIdleTimeout = time.Hour
+
+// leaseKey identifies a session within one pool: the same session key routed to
+// different pools (by routing rules or tiers) holds independent leases. An empty
+// pool holds a rotation requested for every pool of the session.
+type leaseKey struct {
+	pool    string
+	session string
+}
+
+type lease struct {
+	// gen is bumped on every rotation and mixed into the HRW key, so a rotated
+	// session gets a fresh (but still deterministic) ranking.
+	gen int
+	// prev is the upstream the session was rotated away from; it is skipped
+	// while others are available.
+	prev string
+	// pending defers a rotation requested via Rotate to the next pick, when the
+	// current upstream is known.
+	pending bool
+
+	upstream  string
+	expiresAt time.Time
+	uses      int
+	lastUsed  time.Time
+}
+
+// Lease describes a sticky session, as reported by Leases.List.
+type Lease struct {
+	Session    string    `json:"session"`
+	Generation int       `json:"generation"`
+	Previous   string    `json:"previous,omitempty"`
+	Pool       string    `json:"pool,omitempty"`
+	Upstream   string    `json:"upstream,omitempty"`
+	Uses       int       `json:"uses"`
+	ExpiresAt  time.Time `json:"expires_at,omitempty"`
+	LastUsedAt time.Time `json:"last_used_at"`
+}
+
+// Leases tracks sticky sessions. Without a TTL or max uses it only records
+// rotations, and sessions map to upstreams purely by HRW. A nil *Leases picks
+// by HRW and cannot rotate.
+type Leases struct {
+	cfg LeaseConfig
+
+	mu        sync.Mutex
+	m         map[leaseKey]*lease
+	lastPrune time.Time
+}
+
+func NewLeases(cfg LeaseConfig) *Leases {
+	if cfg.MaxSessions <= 0 {
+		cfg.MaxSessions = defaultMaxLeases
+	}
+	return &Leases{cfg: cfg, m: make(map[leaseKey]*lease)}
+}
+
+// pinning reports whether sessions are pinned to their upstream for a bounded time or use count.
+func (l *Leases) pinning() bool {
+	return l.cfg.TTL > 0 || l.cfg.MaxUses > 0
+}
+
+// Pick returns the upstream for sessionKey among candidates from pool p, skipping
+// keys in exclude. A valid lease keeps its upstream; otherwise the session is
+// (re)assigned by HRW. rotate forces the session onto another upstream.
+func (l *Leases) Pick(p *Pool, sessionKey string, candidates []Entry, exclude map[string]struct{}, rotate bool, now time.Time) (Entry, bool) {
+	if l == nil {
+		return PickRendezvous(candidates, sessionKey, exclude)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.pruneLocked(now)
+
+	k := leaseKey{pool: p.Name(), session: sessionKey}
+	e, ok, ls := l.choose(copyLease(l.lookupLocked(k)), sessionKey, candidates, exclude, rotate, now)
+	if ls != nil {
+		l.storeLocked(k, ls, now)
+	}
+	return e, ok
+}
+
+// lookupLocked returns the lease of k, falling back to a rotation requested for
+// every pool of the session. Callers must hold l.mu.
+func (l *Leases) lookupLocked(k leaseKey) *lease {
+	if ls := l.m[k]; ls != nil {
+		return ls
+	}
+	return l.m[leaseKey{session: k.session}]
+}
+
+// storeLocked records ls under k, evicting the least recently used leases if
+// the table is full. Callers must hold l.mu.
+func (l *Leases) storeLocked(k leaseKey, ls *lease, now time.Time) {
+	if _, ok := l.m[k]; !ok {
+		for len(l.m) >= l.cfg.MaxSessions {
+			var oldest leaseKey
+			var oldestAt time.Time
+			first := true
+			for lk, v := range l.m {
+				if first || v.lastUsed.Before(oldestAt) {
+					oldest, oldestAt, first = lk, v.lastUsed, false
+				}
+			}
+			delete(l.m, oldest)
+		}
+	}
+	l.m[k] = ls
+}
+
+// Explain reports what Pick would return for sessionKey right now without
+// recording the use. key is the HRW key the session is ranked by and info its
+// lease, if any.
+func (l *Leases) Explain(p *Pool, sessionKey string, candidates []Entry, now time.Time) (e Entry, ok bool, key string, info *Lease) {
+	if l == nil {
+		e, ok = PickRendezvous(candidates, sessionKey, nil)
+		return e, ok, sessionKey, nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	k := leaseKey{pool: p.Name(), session: sessionKey}
+	cur := l.lookupLocked(k)
+	if cur != nil {
+		v := cur.view(k)
+		info = &v
+	}
+	e, ok, ls := l.choose(copyLease(cur), sessionKey, candidates, nil, false, now)
+	key = sessionKey
+	if ls != nil {
+		key = hrwKey(sessionKey, ls.gen)
+	}
+	return e, ok, key, info
+}
+
+// choose applies the lease logic to ls, a copy of the session's lease (nil if
+// none), and returns the pick along with the lease to store (nil if none).
+func (l *Leases) choose(ls *lease, sessionKey string, candidates []Entry, exclude map[string]struct{}, rotate bool, now time.Time) (Entry, bool, *lease) {
+	if rotate || (ls != nil && (ls.pending || (ls.upstream != "" && l.expired(ls, now)))) {
+		cur := ""
+		if ls != nil && ls.upstream != "" {
+			cur = ls.upstream
+		} else if e, ok := pickForLease(ls, sessionKey, candidates, exclude); ok {
+			cur = e.Key()
+		}
+		if ls == nil {
+			ls = &lease{}
+		}
+		ls.rotate(cur)
+	}
+	if ls != nil && ls.upstream != "" {
+		if _, skip := exclude[ls.upstream]; !skip {
+			for _, e := range candidates {
+				if e.Key() == ls.upstream {
+					ls.uses++
+					ls.lastUsed = now
+					return e, true, ls
+				}
+			}
+		}
+	}
+
+	e, ok := pickForLease(ls, sessionKey, candidates, exclude)
+	if !ok {
+		return Entry{}, false, ls
+	}
+
+	if l.pinning() {
+		if ls == nil {
+			ls = &lease{}
+		}
+		ls.upstream = e.Key()
+		ls.uses = 1
+		ls.expiresAt = time.Time{}
+		if l.cfg.TTL > 0 {
+			ls.expiresAt = now.Add(l.cfg.TTL)
+		}
+	}
+	if ls != nil {
+		ls.lastUsed = now
+	}
+	return e, true, ls
+}
+
+// Rotate moves sessionKey to another upstream on its next pick from pool, or
+// from every pool if pool is empty.
+func (l *Leases) Rotate(pool, sessionKey string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if pool == "" {
+		for k, ls := range l.m {
+			if k.session == sessionKey {
+				ls.pending = true
+			}
+		}
+	}
+	k := leaseKey{pool: pool, session: sessionKey}
+	ls := l.m[k]
+	if ls == nil {
+		ls = &lease{lastUsed: now}
+		l.storeLocked(k, ls, now)
+	}
+	ls.pending = true
+}
+
+// Drop forgets sessionKey in pool, or in every pool if pool is empty, returning
+// it to its original HRW mapping. It reports whether any lease was dropped.
+func (l *Leases) Drop(pool, sessionKey string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	dropped := false
+	for k := range l.m {
+		if k.session == sessionKey && (pool == "" || k.pool == pool) {
+			delete(l.m, k)
+			dropped = true
+		}
+	}
+	return dropped
+}
+
+// List returns the tracked sessions, most recently used first.
+func (l *Leases) List() []Lease {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	out := make([]Lease, 0, len(l.m))
+	for k, ls := range l.m {
+		out = append(out, ls.view(k))
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].LastUsedAt.After(out[j].LastUsedAt) })
+	return out
+}
+
+// expired reports whether the lease's TTL or use count is exhausted.
+func (l *Leases) expired(ls *lease, now time.Time) bool {
+	if l.cfg.TTL > 0 && !now.Before(ls.expiresAt) {
+		return true
+	}
+	return l.cfg.MaxUses > 0 && ls.uses >= l.cfg.MaxUses
+}
+
+// rotate bumps the generation and moves the session off cur, its current upstream.
+func (ls *lease) rotate(cur string) {
+	ls.gen++
+	if cur != "" {
+		ls.prev = cur
+	}
+	ls.pending = false
+	ls.upstream = ""
+	ls.uses = 0
+	ls.expiresAt = time.Time{}
+}
+
+func (ls *lease) view(k leaseKey) Lease {
+	return Lease{
+		Session:    k.session,
+		Generation: ls.gen,
+		Previous:   ls.prev,
+		Pool:       k.pool,
+		Upstream:   ls.upstream,
+		Uses:       ls.uses,
+		ExpiresAt:  ls.expiresAt,
+		LastUsedAt: ls.lastUsed,
+	}
+}
+
+func copyLease(ls *lease) *lease {
+	if ls == nil {
+		return nil
+	}
+	cp := *ls
+	return &cp
+}
+
+// pickForLease ranks candidates by HRW for the session's current generation,
+// avoiding the upstream it was rotated away from unless nothing else is left.
+func pickForLease(ls *lease, sessionKey string, candidates []Entry, exclude map[string]struct{}) (Entry, bool) {
+	if ls == nil {
+		return PickRendezvous(candidates, sessionKey, exclude)
+	}
+	key := hrwKey(sessionKey, ls.gen)
+	if e, ok := PickRendezvous(candidates, key, withKey(exclude, ls.prev)); ok || ls.prev == "" {
+		return e, ok
+	}
+	return PickRendezvous(candidates, key, exclude)
+}
+
+// pruneLocked drops idle leases, at most once a minute. Callers must hold l.mu.
+func (l *Leases) pruneLocked(now time.Time) {
+	if now.Sub(l.lastPrune) < time.Minute {
+		return
+	}
+	l.lastPrune = now
+	idle := leaseIdleTimeout
+	if l.cfg.TTL > idle {
+		idle = l.cfg.TTL
+	}
+	for k, ls := range l.m {
+		if now.Sub(ls.lastUsed) > idle {
+			delete(l.m, k)
+		}
+	}
+}
+
+func hrwKey(sessionKey string, gen int) string {
+	if gen == 0 {
+		return sessionKey
+	}
+	return sessionKey + "#" + strconv.Itoa(gen)
+}
+
+// withKey returns exclude plus key, leaving exclude unmodified.
+func withKey(exclude map[string]struct{}, key string) map[string]struct{} {
+	if key == "" {
+		return exclude
+	}
+	out := make(map[string]struct{}, len(exclude)+1)
+	for k := range exclude {
+		out[k] = struct{}{}
+	}
+	out[key] = struct{}{}
+	return out
+}
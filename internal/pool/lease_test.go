@@ -0,0 +1,143 @@
+package pool
+
+import (
+	"testing"
+	"time"
+)
+
+func leaseTestPool(t *testing.T) *Pool {
+	return newTestPool(t, Entry{ID: "n1"}, Entry{ID: "n2"}, Entry{ID: "n3"}, Entry{ID: "n4"})
+}
+
+func TestLeases_NoTTLMatchesHRW(t *testing.T) {
+	p := leaseTestPool(t)
+	l := NewLeases(LeaseConfig{})
+	now := time.Now()
+
+	want, _ := PickRendezvous(p.Active(now), "sess", nil)
+	for i := 0; i < 3; i++ {
+		got, ok := l.Pick(p, "sess", p.Active(now), nil, false, now)
+		if !ok || got.Key() != want.Key() {
+			t.Fatalf("expected HRW pick %q, got %q", want.Key(), got.Key())
+		}
+	}
+	if len(l.List()) != 0 {
+		t.Fatalf("expected no leases without TTL, got %v", l.List())
+	}
+
+	rotated, _ := l.Pick(p, "sess", p.Active(now), nil, true, now)
+	if rotated.Key() == want.Key() {
+		t.Fatalf("expected rotation to move the session off %q", want.Key())
+	}
+	again, _ := l.Pick(p, "sess", p.Active(now), nil, false, now)
+	if again.Key() != rotated.Key() {
+		t.Fatalf("expected rotated mapping to be stable, got %q then %q", rotated.Key(), again.Key())
+	}
+
+	l.Rotate("", "sess")
+	if got, _ := l.Pick(p, "sess", p.Active(now), nil, false, now); got.Key() == rotated.Key() {
+		t.Fatalf("expected admin rotation to move the session off %q", rotated.Key())
+	}
+
+	if !l.Drop("", "sess") {
+		t.Fatalf("expected session to be tracked after rotation")
+	}
+	if got, _ := l.Pick(p, "sess", p.Active(now), nil, false, now); got.Key() != want.Key() {
+		t.Fatalf("expected drop to restore HRW pick %q, got %q", want.Key(), got.Key())
+	}
+}
+
+func TestLeases_TTLAndMaxUses(t *testing.T) {
+	p := leaseTestPool(t)
+	now := time.Now()
+
+	t.Run("ttl", func(t *testing.T) {
+		l := NewLeases(LeaseConfig{TTL: 10 * time.Minute})
+		first, _ := l.Pick(p, "sess", p.Active(now), nil, false, now)
+		if got, _ := l.Pick(p, "sess", p.Active(now), nil, false, now.Add(9*time.Minute)); got.Key() != first.Key() {
+			t.Fatalf("expected lease to hold within TTL, got %q want %q", got.Key(), first.Key())
+		}
+		if got, _ := l.Pick(p, "sess", p.Active(now), nil, false, now.Add(11*time.Minute)); got.Key() == first.Key() {
+			t.Fatalf("expected rotation after TTL, still on %q", got.Key())
+		}
+	})
+
+	t.Run("max_uses", func(t *testing.T) {
+		l := NewLeases(LeaseConfig{MaxUses: 2})
+		first, _ := l.Pick(p, "sess", p.Active(now), nil, false, now)
+		if got, _ := l.Pick(p, "sess", p.Active(now), nil, false, now); got.Key() != first.Key() {
+			t.Fatalf("expected second use on %q, got %q", first.Key(), got.Key())
+		}
+		if got, _ := l.Pick(p, "sess", p.Active(now), nil, false, now); got.Key() == first.Key() {
+			t.Fatalf("expected rotation after max uses, still on %q", got.Key())
+		}
+	})
+
+	t.Run("admin_rotate", func(t *testing.T) {
+		l := NewLeases(LeaseConfig{TTL: time.Hour})
+		first, _ := l.Pick(p, "sess", p.Active(now), nil, false, now)
+		l.Rotate("", "sess")
+		if got, _ := l.Pick(p, "sess", p.Active(now), nil, false, now); got.Key() == first.Key() {
+			t.Fatalf("expected rotation, still on %q", got.Key())
+		}
+	})
+}
+
+func TestLeases_NilFallsBackToHRW(t *testing.T) {
+	p := leaseTestPool(t)
+	now := time.Now()
+	var l *Leases
+	want, _ := PickRendezvous(p.Active(now), "sess", nil)
+	if got, ok := l.Pick(p, "sess", p.Active(now), nil, true, now); !ok || got.Key() != want.Key() {
+		t.Fatalf("expected HRW pick %q, got %q", want.Key(), got.Key())
+	}
+}
+
+func TestLeases_KeyedByPool(t *testing.T) {
+	a := newTestPool(t, Entry{ID: "n1"}, Entry{ID: "n2"}, Entry{ID: "n3"})
+	a.name = "a"
+	b := newTestPool(t, Entry{ID: "n1"}, Entry{ID: "n2"}, Entry{ID: "n3"})
+	b.name = "b"
+	l := NewLeases(LeaseConfig{TTL: time.Hour})
+	now := time.Now()
+
+	inA, _ := l.Pick(a, "sess", a.Active(now), nil, false, now)
+	inB, _ := l.Pick(b, "sess", b.Active(now), nil, false, now)
+	if len(l.List()) != 2 {
+		t.Fatalf("expected one lease per pool, got %v", l.List())
+	}
+
+	l.Rotate("a", "sess")
+	if got, _ := l.Pick(a, "sess", a.Active(now), nil, false, now); got.Key() == inA.Key() {
+		t.Fatalf("expected rotation in pool a, still on %q", got.Key())
+	}
+	if got, _ := l.Pick(b, "sess", b.Active(now), nil, false, now); got.Key() != inB.Key() {
+		t.Fatalf("expected pool b to keep %q, got %q", inB.Key(), got.Key())
+	}
+
+	if !l.Drop("b", "sess") || l.Drop("b", "sess") {
+		t.Fatalf("expected exactly one drop in pool b")
+	}
+	if len(l.List()) != 1 || l.List()[0].Pool != "a" {
+		t.Fatalf("expected only the pool a lease, got %v", l.List())
+	}
+}
+
+func TestLeases_MaxSessionsEvictsLeastRecentlyUsed(t *testing.T) {
+	p := leaseTestPool(t)
+	l := NewLeases(LeaseConfig{TTL: time.Hour, MaxSessions: 2})
+	now := time.Now()
+
+	l.Pick(p, "s1", p.Active(now), nil, false, now)
+	l.Pick(p, "s2", p.Active(now), nil, false, now.Add(time.Second))
+	l.Pick(p, "s1", p.Active(now), nil, false, now.Add(2*time.Second))
+	l.Pick(p, "s3", p.Active(now), nil, false, now.Add(3*time.Second))
+
+	got := map[string]bool{}
+	for _, ls := range l.List() {
+		got[ls.Session] = true
+	}
+	if len(got) != 2 || !got["s1"] || !got["s3"] {
+		t.Fatalf("expected s2 to be evicted, got %v", got)
+	}
+}
@@ -1,6 +1,7 @@
 package pool
 
 import (
+	"context"
 	"log/slog"
 	"math/rand"
 	"strings"
@@ -17,8 +18,94 @@ type Entry struct {
 	Latency       time.Duration
 	LastCheckedAt time.Time
 
+	// Labels describe the upstream (type, name, source and user-defined labels)
+	// and can be used to narrow selection via Query.Labels.
+	Labels map[string]string
+
+	// EgressIP is the address destinations see when connecting through the upstream,
+	// when egress IP discovery is enabled. Empty when unknown.
+	EgressIP string
+
+	// Country (ISO 3166-1 alpha-2 code), ASN and ASOrg are resolved from the GeoIP
+	// databases for the egress IP, or the server address when that is unknown.
+	Country string
+	ASN     uint
+	ASOrg   string
+
+	// Anonymity is the level reported by the anonymity health check; empty when
+	// unknown.
+	Anonymity Anonymity
+
+	// Tainted marks upstreams caught intercepting TLS: the certificate seen through
+	// them matches neither the configured pins nor the one observed directly.
+	// TaintChecked is set when the check reached a verdict; without one the
+	// previous verdict is kept.
+	Tainted      bool
+	TaintChecked bool
+
+	// Throughput is the download rate in bytes per second measured by the
+	// throughput probe; 0 when unknown.
+	Throughput int64
+
+	// Circuit breaker state (see breaker.go). failures counts consecutive failures
+	// while closed; disabledUntil is the end of the open period; opens counts
+	// consecutive trips and drives the exponential backoff.
 	failures      int
 	disabledUntil time.Time
+	opens         int
+
+	// ewma is the exponentially weighted moving average of latency observed on
+	// real traffic. Zero means no observation yet (Latency is used instead).
+	ewma time.Duration
+
+	// Lifetime usage counters, carried across Update.
+	successTotal uint64
+	failureTotal uint64
+
+	// quality tracks traffic and probe outcomes behind Score (see score.go).
+	quality quality
+}
+
+// Usage returns the lifetime number of successful and failed dials through the entry.
+func (e Entry) Usage() (successes, failures uint64) {
+	return e.successTotal, e.failureTotal
+}
+
+// carryState copies runtime state (failure/backoff, EWMA, usage, quality) from
+// old into e.
+// Health-check fields on e are kept as they are fresher; a previously discovered
+// egress IP, anonymity level or throughput is kept if this round could not
+// determine it.
+func (e *Entry) carryState(old Entry) {
+	if e.EgressIP == "" {
+		e.EgressIP = old.EgressIP
+	}
+	if e.Anonymity == "" {
+		e.Anonymity = old.Anonymity
+	}
+	if !e.TaintChecked {
+		e.Tainted, e.TaintChecked = old.Tainted, old.TaintChecked
+	}
+	if e.Throughput == 0 {
+		e.Throughput = old.Throughput
+	}
+	e.failures = old.failures
+	e.disabledUntil = old.disabledUntil
+	e.opens = old.opens
+	e.ewma = old.ewma
+	e.successTotal = old.successTotal
+	e.failureTotal = old.failureTotal
+	e.quality = old.quality
+}
+
+// EWMA returns the latency estimate used by the p2c_ewma strategy: the moving
+// average of observed traffic latency, or the health-check latency if nothing
+// has been observed yet.
+func (e Entry) EWMA() time.Duration {
+	if e.ewma > 0 {
+		return e.ewma
+	}
+	return e.Latency
 }
 
 func (e Entry) Key() string {
@@ -40,6 +127,22 @@ type Pool struct {
 	index   map[string]int
 	rr      uint64
 
+	// inflight counts open connections per entry key. It is keyed independently of
+	// entries so counts survive Update while connections are still open.
+	inflight      map[string]int
+	maxConcurrent int
+
+	breaker BreakerConfig
+	// trials counts the half-open trials in flight per entry and open period.
+	trials map[trialKey]int
+
+	dest         map[destKey]*destState
+	maxDestPairs int
+
+	attrs AttributeFilter
+
+	scoring ScoringConfig
+
 	updating int32
 
 	rng *rand.Rand
@@ -47,15 +150,100 @@ type Pool struct {
 
 func New(name string, log *slog.Logger) *Pool {
 	return &Pool{
-		name:  name,
-		log:   log,
-		index: make(map[string]int),
-		rng:   rand.New(rand.NewSource(time.Now().UnixNano())),
+		name:     name,
+		log:      log,
+		index:    make(map[string]int),
+		inflight: make(map[string]int),
+		breaker:  DefaultBreakerConfig(),
+		trials:   make(map[trialKey]int),
+		rng:      rand.New(rand.NewSource(time.Now().UnixNano())),
+
+		dest:         make(map[destKey]*destState),
+		maxDestPairs: DefaultMaxDestinationPairs,
 	}
 }
 
 func (p *Pool) Name() string { return p.name }
 
+// SetMaxConcurrent caps the number of in-flight connections per upstream.
+// Next skips saturated entries. n <= 0 disables the cap.
+func (p *Pool) SetMaxConcurrent(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.maxConcurrent = n
+}
+
+// Acquire records a new in-flight connection through the upstream key.
+// Every Acquire must be paired with a Release.
+func (p *Pool) Acquire(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.inflight[key]++
+}
+
+// Release ends an in-flight connection previously recorded by Acquire.
+func (p *Pool) Release(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.inflight[key] <= 1 {
+		delete(p.inflight, key)
+		return
+	}
+	p.inflight[key]--
+}
+
+// AcquireNext picks an upstream like NextFor and records the connection as in
+// flight under the same lock, so concurrent callers cannot exceed max_concurrent.
+// release must be called once when the connection ends.
+func (p *Pool) AcquireNext(strategy string, q Query, now time.Time) (e Entry, release func(), ok bool) {
+	q.Host = NormalizeHost(q.Host)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	e, ok = p.nextLocked(strategy, q, now)
+	if !ok {
+		return Entry{}, nil, false
+	}
+	return e, p.acquireLocked(e, now), true
+}
+
+// AcquireKey is Get for an upstream picked outside the pool (a sticky lease or a
+// forced key), recording the connection as in flight under the same lock.
+// release must be called once when the connection ends.
+func (p *Pool) AcquireKey(key string, now time.Time) (e Entry, release func(), ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	e, ok = p.getLocked(key, now)
+	if !ok {
+		return Entry{}, nil, false
+	}
+	return e, p.acquireLocked(e, now), true
+}
+
+// acquireLocked records an in-flight connection through e, reserving a half-open
+// trial if needed, and returns its release func. Callers must hold p.mu.
+func (p *Pool) acquireLocked(e Entry, now time.Time) func() {
+	key := e.Key()
+	p.inflight[key]++
+	endTrial := p.reserveTrialLocked(e, now)
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			p.Release(key)
+			if endTrial != nil {
+				endTrial()
+			}
+		})
+	}
+}
+
+// InFlight returns the number of open connections through the upstream key.
+func (p *Pool) InFlight(key string) int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.inflight[key]
+}
+
 func (p *Pool) UpdatingCAS() bool {
 	return atomic.CompareAndSwapInt32(&p.updating, 0, 1)
 }
@@ -64,44 +252,198 @@ func (p *Pool) UpdatingClear() {
 	atomic.StoreInt32(&p.updating, 0)
 }
 
+// Update replaces the pool contents with entries, merging by Entry.Key(): entries
+// that survive the refresh keep their failure/backoff state and usage statistics,
+// new entries start fresh and missing ones are dropped.
 func (p *Pool) Update(entries []Entry) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
+	p.replaceLocked(entries, slog.LevelInfo, "pool updated")
+}
+
+// Merge upserts entries, so health-check results can be published while a refresh
+// is still running; the refresh ends with Update, which drops the upstreams that
+// did not pass. Existing entries are updated in place and new ones appended; the
+// round-robin cursor and per-destination state are left alone. Entries below the
+// minimum anonymity, and entries sharing an egress IP with another one in the
+// pool, are not merged; if they were in the pool already they are removed.
+func (p *Pool) Merge(entries []Entry) {
+	if len(entries) == 0 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// egress maps each egress IP in the pool to the key of its entry.
+	var egress map[string]string
+	if p.attrs.DedupByEgressIP {
+		egress = make(map[string]string, len(p.entries))
+		for _, e := range p.entries {
+			if e.EgressIP != "" {
+				egress[e.EgressIP] = e.Key()
+			}
+		}
+	}
+	updated, added, removed := 0, 0, 0
+	for _, e := range entries {
+		k := e.Key()
+		idx, ok := p.index[k]
+		if ok {
+			e.carryState(p.entries[idx])
+		}
+		rejected := !p.attrs.keeps(e)
+		if !rejected && egress != nil && e.EgressIP != "" {
+			owner, dup := egress[e.EgressIP]
+			rejected = dup && owner != k
+		}
+		if rejected {
+			if ok {
+				if old := p.entries[idx].EgressIP; egress != nil && egress[old] == k {
+					delete(egress, old)
+				}
+				p.removeLocked(k)
+				removed++
+			}
+			continue
+		}
+		if egress != nil {
+			if ok {
+				if old := p.entries[idx].EgressIP; egress[old] == k {
+					delete(egress, old)
+				}
+			}
+			if e.EgressIP != "" {
+				egress[e.EgressIP] = k
+			}
+		}
+		if ok {
+			p.entries[idx] = e
+			updated++
+			continue
+		}
+		p.index[k] = len(p.entries)
+		p.entries = append(p.entries, e)
+		added++
+	}
+	if removed > 0 {
+		p.pruneDestLocked()
+	}
+
+	p.log.Debug("pool merged", "pool", p.name, "new", len(p.entries), "added", added, "updated", updated, "removed", removed)
+}
+
+// removeLocked drops the entry with key and reindexes the ones after it. Callers
+// must hold p.mu.
+func (p *Pool) removeLocked(key string) {
+	idx, ok := p.index[key]
+	if !ok {
+		return
+	}
+	p.entries = append(p.entries[:idx], p.entries[idx+1:]...)
+	delete(p.index, key)
+	for i := idx; i < len(p.entries); i++ {
+		p.index[p.entries[i].Key()] = i
+	}
+}
 
+// replaceLocked implements Update and logs the outcome at level. Callers must hold
+// p.mu.
+func (p *Pool) replaceLocked(entries []Entry, level slog.Level, msg string) {
 	oldCount := len(p.entries)
-	p.entries = entries
-	p.index = make(map[string]int, len(entries))
-	for i := range entries {
-		p.index[entries[i].Key()] = i
+
+	unique := make([]Entry, 0, len(entries))
+	seen := make(map[string]struct{}, len(entries))
+	for _, e := range entries {
+		k := e.Key()
+		if _, dup := seen[k]; dup {
+			continue
+		}
+		seen[k] = struct{}{}
+		if oldIdx, ok := p.index[k]; ok {
+			e.carryState(p.entries[oldIdx])
+		}
+		unique = append(unique, e)
+	}
+	admitted, leaking, collapsed := p.admitLocked(unique)
+
+	index := make(map[string]int, len(admitted))
+	kept := 0
+	for i, e := range admitted {
+		if _, ok := p.index[e.Key()]; ok {
+			kept++
+		}
+		index[e.Key()] = i
 	}
+	added := len(admitted) - kept
+	removed := oldCount - kept
+
+	p.entries = admitted
+	p.index = index
+	p.pruneDestLocked()
 	atomic.StoreUint64(&p.rr, 0)
 
-	p.log.Info("pool updated", "pool", p.name, "old", oldCount, "new", len(entries))
+	p.log.Log(context.Background(), level, msg, "pool", p.name, "old", oldCount, "new", len(admitted), "added", added, "removed", removed, "kept", kept, "collapsed", collapsed, "below_min_anonymity", leaking)
+}
+
+// admitLocked drops entries below the minimum anonymity and then, with
+// DedupByEgressIP, collapses the rest by egress IP. Anonymity goes first so a
+// leaking upstream cannot win the collapse and take an admissible one down with
+// it. Callers must hold p.mu.
+func (p *Pool) admitLocked(entries []Entry) (admitted []Entry, leaking, collapsed int) {
+	admitted = make([]Entry, 0, len(entries))
+	for _, e := range entries {
+		if !p.attrs.keeps(e) {
+			leaking++
+			continue
+		}
+		admitted = append(admitted, e)
+	}
+	if p.attrs.DedupByEgressIP {
+		admitted, collapsed = p.collapseEgressLocked(admitted)
+	}
+	return admitted, leaking, collapsed
 }
 
 func (p *Pool) Next(strategy string, now time.Time) (Entry, bool) {
+	return p.NextFor(strategy, Query{}, now)
+}
+
+// NextFor picks an upstream with strategy, skipping entries unsuitable for q.
+func (p *Pool) NextFor(strategy string, q Query, now time.Time) (Entry, bool) {
+	q.Host = NormalizeHost(q.Host)
+
 	p.mu.Lock()
 	defer p.mu.Unlock()
+	return p.nextLocked(strategy, q, now)
+}
 
+// nextLocked implements NextFor. Callers must hold p.mu.
+func (p *Pool) nextLocked(strategy string, q Query, now time.Time) (Entry, bool) {
 	if len(p.entries) == 0 {
 		return Entry{}, false
 	}
 
 	switch strategy {
+	case "latency_weighted":
+		return p.nextLatencyWeighted(q, now)
+	case "p2c_ewma":
+		return p.nextP2C(q, now)
+	case "least_conn":
+		return p.nextLeastConn(q, now)
+	case "quality":
+		return p.nextWeighted(q, now, qualityWeight)
 	case "random":
-		for i := 0; i < len(p.entries); i++ {
-			e := p.entries[p.rng.Intn(len(p.entries))]
-			if e.disabledUntil.IsZero() || now.After(e.disabledUntil) {
-				return e, true
-			}
+		avail := p.availableIndexes(q, now)
+		if len(avail) == 0 {
+			return Entry{}, false
 		}
-		return Entry{}, false
+		return p.entries[avail[p.rng.Intn(len(avail))]], true
 	default: // round_robin
 		start := int(atomic.AddUint64(&p.rr, 1) % uint64(len(p.entries)))
 		for i := 0; i < len(p.entries); i++ {
 			idx := (start + i) % len(p.entries)
 			e := p.entries[idx]
-			if e.disabledUntil.IsZero() || now.After(e.disabledUntil) {
+			if p.selectable(e, q, now) {
 				return e, true
 			}
 		}
@@ -109,29 +451,219 @@ func (p *Pool) Next(strategy string, now time.Time) (Entry, bool) {
 	}
 }
 
+// saturated reports whether key has reached the max_concurrent cap.
+// Callers must hold p.mu.
+func (p *Pool) saturated(key string) bool {
+	return p.maxConcurrent > 0 && p.inflight[key] >= p.maxConcurrent
+}
+
+// selectable reports whether e may be handed out by Next: it matches q and is
+// below the max_concurrent cap. Callers must hold p.mu.
+func (p *Pool) selectable(e Entry, q Query, now time.Time) bool {
+	return p.matches(e, q, now) && !p.saturated(e.Key())
+}
+
+// matches reports whether e's breaker admits traffic, it passes the attribute
+// filter (see SetAttributeFilter), it is not ejected for a low score, it carries
+// q.Labels and it is not backed off for q.Host. Callers must hold p.mu.
+func (p *Pool) matches(e Entry, q Query, now time.Time) bool {
+	return p.admits(e, now) && p.attrs.selects(e) && p.scoredEnough(e) && e.MatchLabels(q.Labels) && !p.destBlocked(e.Key(), q.Host, now)
+}
+
+// availableIndexes returns the indexes of selectable entries.
+// Callers must hold p.mu.
+func (p *Pool) availableIndexes(q Query, now time.Time) []int {
+	avail := make([]int, 0, len(p.entries))
+	for i := range p.entries {
+		if p.selectable(p.entries[i], q, now) {
+			avail = append(avail, i)
+		}
+	}
+	return avail
+}
+
+// nextLatencyWeighted picks a random available entry with probability proportional
+// to the inverse of its health-check latency. Callers must hold p.mu.
+func (p *Pool) nextLatencyWeighted(q Query, now time.Time) (Entry, bool) {
+	return p.nextWeighted(q, now, func(e Entry) float64 {
+		return 1 / float64(latencyOrDefault(e.Latency))
+	})
+}
+
+// minQualityWeight keeps zero-score entries selectable now and then so traffic can
+// show they have recovered.
+const minQualityWeight = 1
+
+// qualityWeight weights entries by their quality score.
+func qualityWeight(e Entry) float64 {
+	if s := e.Score(); s > minQualityWeight {
+		return s
+	}
+	return minQualityWeight
+}
+
+// nextWeighted picks a random available entry with probability proportional to
+// weight. Callers must hold p.mu.
+func (p *Pool) nextWeighted(q Query, now time.Time, weight func(Entry) float64) (Entry, bool) {
+	weights := make([]float64, len(p.entries))
+	total := 0.0
+	for i := range p.entries {
+		if !p.selectable(p.entries[i], q, now) {
+			continue
+		}
+		weights[i] = weight(p.entries[i])
+		total += weights[i]
+	}
+	if total == 0 {
+		return Entry{}, false
+	}
+
+	r := p.rng.Float64() * total
+	for i, w := range weights {
+		if w == 0 {
+			continue
+		}
+		r -= w
+		if r <= 0 {
+			return p.entries[i], true
+		}
+	}
+	// Floating point rounding: fall back to the last available entry.
+	for i := len(weights) - 1; i >= 0; i-- {
+		if weights[i] > 0 {
+			return p.entries[i], true
+		}
+	}
+	return Entry{}, false
+}
+
+// nextP2C implements "power of two choices": sample two distinct available entries
+// and return the one with the lower EWMA latency. Callers must hold p.mu.
+func (p *Pool) nextP2C(q Query, now time.Time) (Entry, bool) {
+	avail := p.availableIndexes(q, now)
+	switch len(avail) {
+	case 0:
+		return Entry{}, false
+	case 1:
+		return p.entries[avail[0]], true
+	}
+
+	i := p.rng.Intn(len(avail))
+	j := p.rng.Intn(len(avail) - 1)
+	if j >= i {
+		j++
+	}
+	a, b := p.entries[avail[i]], p.entries[avail[j]]
+	if latencyOrDefault(b.EWMA()) < latencyOrDefault(a.EWMA()) {
+		return b, true
+	}
+	return a, true
+}
+
+// nextLeastConn returns the available entry with the fewest in-flight connections.
+// Ties are broken in round-robin order so idle upstreams share load evenly.
+// Callers must hold p.mu.
+func (p *Pool) nextLeastConn(q Query, now time.Time) (Entry, bool) {
+	start := int(atomic.AddUint64(&p.rr, 1) % uint64(len(p.entries)))
+	best := -1
+	bestCount := 0
+	for i := 0; i < len(p.entries); i++ {
+		idx := (start + i) % len(p.entries)
+		e := p.entries[idx]
+		if !p.selectable(e, q, now) {
+			continue
+		}
+		n := p.inflight[e.Key()]
+		if best < 0 || n < bestCount {
+			best = idx
+			bestCount = n
+		}
+	}
+	if best < 0 {
+		return Entry{}, false
+	}
+	return p.entries[best], true
+}
+
+// unknownLatency is assumed for entries without any latency information so they
+// are neither strongly preferred nor starved.
+const unknownLatency = time.Second
+
+func latencyOrDefault(d time.Duration) time.Duration {
+	if d <= 0 {
+		return unknownLatency
+	}
+	if d < time.Millisecond {
+		return time.Millisecond
+	}
+	return d
+}
+
+// ewmaAlpha is the weight of the newest observation in the latency EWMA.
+const ewmaAlpha = 0.3
+
+// ObserveLatency feeds a latency measured on real traffic into the entry's EWMA.
+func (p *Pool) ObserveLatency(key string, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	idx, ok := p.index[key]
+	if !ok {
+		return
+	}
+	prev := p.entries[idx].ewma
+	if prev <= 0 {
+		p.entries[idx].ewma = d
+		return
+	}
+	p.entries[idx].ewma = time.Duration(ewmaAlpha*float64(d) + (1-ewmaAlpha)*float64(prev))
+}
+
 func (p *Pool) Get(key string, now time.Time) (Entry, bool) {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
+	return p.getLocked(key, now)
+}
 
+// getLocked implements Get. Callers must hold p.mu.
+func (p *Pool) getLocked(key string, now time.Time) (Entry, bool) {
 	idx, ok := p.index[key]
 	if !ok {
 		return Entry{}, false
 	}
 	e := p.entries[idx]
-	if !e.disabledUntil.IsZero() && now.Before(e.disabledUntil) {
+	if !p.admits(e, now) || !p.attrs.trusts(e) {
 		return Entry{}, false
 	}
 	return e, true
 }
 
+// Entries returns all entries regardless of their state.
+func (p *Pool) Entries() []Entry {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return append([]Entry(nil), p.entries...)
+}
+
 func (p *Pool) Active(now time.Time) []Entry {
+	return p.ActiveFor(Query{}, now)
+}
+
+// ActiveFor returns untainted entries admitted by their breaker, matching q.Labels
+// and not backed off for q.Host.
+// Unlike NextFor it ignores the max_concurrent cap, so sticky rankings stay stable.
+func (p *Pool) ActiveFor(q Query, now time.Time) []Entry {
+	q.Host = NormalizeHost(q.Host)
+
 	p.mu.RLock()
 	defer p.mu.RUnlock()
 
 	out := make([]Entry, 0, len(p.entries))
 	for i := range p.entries {
 		e := p.entries[i]
-		if !e.disabledUntil.IsZero() && now.Before(e.disabledUntil) {
+		if !p.matches(e, q, now) {
 			continue
 		}
 		out = append(out, e)
@@ -139,44 +671,16 @@ func (p *Pool) Active(now time.Time) []Entry {
 	return out
 }
 
-func (p *Pool) MarkSuccess(addr string) {
-	p.mu.Lock()
-	defer p.mu.Unlock()
-	idx, ok := p.index[addr]
-	if !ok {
-		return
-	}
-	p.entries[idx].failures = 0
-	p.entries[idx].disabledUntil = time.Time{}
-}
-
-func (p *Pool) MarkFailure(addr string, now time.Time, baseBackoff, maxBackoff time.Duration) {
-	p.mu.Lock()
-	defer p.mu.Unlock()
-	idx, ok := p.index[addr]
-	if !ok {
-		return
-	}
-
-	p.entries[idx].failures++
-	failures := p.entries[idx].failures
-
-	backoff := baseBackoff
-	for i := 1; i < failures; i++ {
-		backoff *= 2
-		if backoff >= maxBackoff {
-			backoff = maxBackoff
-			break
-		}
-	}
-	p.entries[idx].disabledUntil = now.Add(backoff)
-}
-
 type Stats struct {
 	Total        int
 	Disabled     int
+	HalfOpen     int
+	InFlight     int
 	LastChecked  time.Time
 	HasAnyActive bool
+
+	// DestinationBlocks is the number of (upstream, destination) pairs currently backed off.
+	DestinationBlocks int
 }
 
 func (p *Pool) Stats(now time.Time) Stats {
@@ -184,22 +688,35 @@ func (p *Pool) Stats(now time.Time) Stats {
 	defer p.mu.RUnlock()
 
 	disabled := 0
+	halfOpen := 0
 	active := 0
 	var last time.Time
 	for i := range p.entries {
 		if p.entries[i].LastCheckedAt.After(last) {
 			last = p.entries[i].LastCheckedAt
 		}
-		if !p.entries[i].disabledUntil.IsZero() && now.Before(p.entries[i].disabledUntil) {
+		switch p.entries[i].BreakerState(now) {
+		case BreakerOpen:
 			disabled++
-		} else {
+		case BreakerHalfOpen:
+			halfOpen++
+			active++
+		default:
 			active++
 		}
 	}
+	inflight := 0
+	for _, n := range p.inflight {
+		inflight += n
+	}
 	return Stats{
 		Total:        len(p.entries),
 		Disabled:     disabled,
+		HalfOpen:     halfOpen,
+		InFlight:     inflight,
 		LastChecked:  last,
 		HasAnyActive: active > 0,
+
+		DestinationBlocks: p.destBlockedCount(now),
 	}
 }
@@ -0,0 +1,293 @@
+package pool
+
+import (
+	"io"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestPool(t *testing.T, entries ...Entry) *Pool {
+	t.Helper()
+	p := New("test", slog.New(slog.NewTextHandler(io.Discard, nil)))
+	p.Update(entries)
+	return p
+}
+
+func TestNext_LatencyWeightedPrefersFastUpstreams(t *testing.T) {
+	p := newTestPool(t,
+		Entry{Addr: "fast:1080", Latency: 100 * time.Millisecond},
+		Entry{Addr: "slow:1080", Latency: 4 * time.Second},
+	)
+
+	now := time.Now()
+	counts := map[string]int{}
+	for i := 0; i < 2000; i++ {
+		e, ok := p.Next("latency_weighted", now)
+		if !ok {
+			t.Fatalf("expected ok")
+		}
+		counts[e.Addr]++
+	}
+	if counts["fast:1080"] < 10*counts["slow:1080"] {
+		t.Fatalf("expected fast upstream to dominate, got %v", counts)
+	}
+}
+
+func TestNext_P2CUsesObservedLatency(t *testing.T) {
+	p := newTestPool(t,
+		Entry{Addr: "a:1080", Latency: 100 * time.Millisecond},
+		Entry{Addr: "b:1080", Latency: 200 * time.Millisecond},
+	)
+
+	// Real traffic says "a" is actually slow.
+	for i := 0; i < 5; i++ {
+		p.ObserveLatency("a:1080", 3*time.Second)
+	}
+
+	now := time.Now()
+	for i := 0; i < 50; i++ {
+		e, ok := p.Next("p2c_ewma", now)
+		if !ok {
+			t.Fatalf("expected ok")
+		}
+		if e.Addr != "b:1080" {
+			t.Fatalf("expected b (lower EWMA), got %s", e.Addr)
+		}
+	}
+}
+
+func TestNext_SkipsDisabled(t *testing.T) {
+	p := newTestPool(t,
+		Entry{Addr: "a:1080", Latency: 100 * time.Millisecond},
+		Entry{Addr: "b:1080", Latency: 100 * time.Millisecond},
+	)
+	now := time.Now()
+	p.MarkFailure("a:1080", now, time.Minute, time.Hour)
+
+	for _, strategy := range []string{"round_robin", "random", "latency_weighted", "p2c_ewma"} {
+		for i := 0; i < 20; i++ {
+			e, ok := p.Next(strategy, now)
+			if !ok || e.Addr != "b:1080" {
+				t.Fatalf("%s: expected b, got %q ok=%v", strategy, e.Addr, ok)
+			}
+		}
+	}
+}
+
+func TestNext_LeastConn(t *testing.T) {
+	p := newTestPool(t,
+		Entry{Addr: "a:1080"},
+		Entry{Addr: "b:1080"},
+		Entry{Addr: "c:1080"},
+	)
+	p.Acquire("a:1080")
+	p.Acquire("a:1080")
+	p.Acquire("b:1080")
+
+	now := time.Now()
+	e, ok := p.Next("least_conn", now)
+	if !ok || e.Addr != "c:1080" {
+		t.Fatalf("expected c, got %q ok=%v", e.Addr, ok)
+	}
+
+	p.Release("a:1080")
+	p.Release("a:1080")
+	p.Acquire("c:1080")
+	e, ok = p.Next("least_conn", now)
+	if !ok || e.Addr != "a:1080" {
+		t.Fatalf("expected a after release, got %q ok=%v", e.Addr, ok)
+	}
+	if got := p.Stats(now).InFlight; got != 2 {
+		t.Fatalf("expected 2 in-flight, got %d", got)
+	}
+}
+
+func TestNext_MaxConcurrentSkipsSaturated(t *testing.T) {
+	p := newTestPool(t,
+		Entry{Addr: "a:1080"},
+		Entry{Addr: "b:1080"},
+	)
+	p.SetMaxConcurrent(1)
+	p.Acquire("a:1080")
+
+	now := time.Now()
+	for _, strategy := range []string{"round_robin", "random", "latency_weighted", "p2c_ewma", "least_conn"} {
+		e, ok := p.Next(strategy, now)
+		if !ok || e.Addr != "b:1080" {
+			t.Fatalf("%s: expected b, got %q ok=%v", strategy, e.Addr, ok)
+		}
+	}
+
+	p.Acquire("b:1080")
+	if _, ok := p.Next("round_robin", now); ok {
+		t.Fatalf("expected no upstream when all are saturated")
+	}
+}
+
+func TestAcquireNext_ReservesUnderSelectionLock(t *testing.T) {
+	p := newTestPool(t,
+		Entry{Addr: "a:1080"},
+		Entry{Addr: "b:1080"},
+	)
+	p.SetMaxConcurrent(2)
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		releases []func()
+	)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, release, ok := p.AcquireNext("least_conn", Query{}, time.Now()); ok {
+				mu.Lock()
+				releases = append(releases, release)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if len(releases) != 4 || p.InFlight("a:1080") != 2 || p.InFlight("b:1080") != 2 {
+		t.Fatalf("expected 4 reservations capped at 2 per upstream, got %d (a=%d b=%d)", len(releases), p.InFlight("a:1080"), p.InFlight("b:1080"))
+	}
+
+	releases[0]()
+	releases[0]()
+	if got := p.Stats(time.Now()).InFlight; got != 3 {
+		t.Fatalf("expected release to be idempotent, got %d in flight", got)
+	}
+}
+
+func TestUpdate_PreservesStateForSurvivingEntries(t *testing.T) {
+	p := newTestPool(t,
+		Entry{Addr: "a:1080", Latency: 100 * time.Millisecond},
+		Entry{Addr: "b:1080", Latency: 100 * time.Millisecond},
+	)
+	now := time.Now()
+	p.MarkFailure("a:1080", now, time.Minute, time.Hour)
+	p.MarkSuccess("b:1080", now)
+	p.ObserveLatency("b:1080", 300*time.Millisecond)
+
+	p.Update([]Entry{
+		{Addr: "a:1080", Latency: 50 * time.Millisecond},
+		{Addr: "b:1080", Latency: 60 * time.Millisecond},
+		{Addr: "c:1080", Latency: 70 * time.Millisecond},
+	})
+
+	if _, ok := p.Get("a:1080", now); ok {
+		t.Fatalf("expected a to stay disabled after refresh")
+	}
+	b, ok := p.Get("b:1080", now)
+	if !ok {
+		t.Fatalf("expected b")
+	}
+	if b.Latency != 60*time.Millisecond {
+		t.Fatalf("expected fresh health-check latency, got %v", b.Latency)
+	}
+	if b.EWMA() != 300*time.Millisecond {
+		t.Fatalf("expected EWMA carried over, got %v", b.EWMA())
+	}
+	if succ, _ := b.Usage(); succ != 1 {
+		t.Fatalf("expected usage carried over, got %d", succ)
+	}
+	if st := p.Stats(now); st.Total != 3 || st.Disabled != 1 {
+		t.Fatalf("unexpected stats: %+v", st)
+	}
+
+	// Removed entries lose their state; re-adding starts fresh.
+	p.Update([]Entry{{Addr: "b:1080"}})
+	p.Update([]Entry{{Addr: "a:1080"}, {Addr: "b:1080"}})
+	if _, ok := p.Get("a:1080", now); !ok {
+		t.Fatalf("expected a re-admitted after being removed")
+	}
+}
+
+func TestMerge_AppendsWithoutResettingState(t *testing.T) {
+	p := newTestPool(t,
+		Entry{Addr: "a:1080", EgressIP: "203.0.113.1"},
+		Entry{Addr: "b:1080", EgressIP: "203.0.113.2"},
+	)
+	p.SetAttributeFilter(AttributeFilter{DedupByEgressIP: true})
+	now := time.Now()
+	p.Next("round_robin", now)
+	p.Next("round_robin", now)
+	p.MarkDestFailure("b:1080", "example.com", now, time.Minute, time.Hour)
+	rr := atomic.LoadUint64(&p.rr)
+
+	p.Merge([]Entry{
+		{Addr: "c:1080", EgressIP: "203.0.113.1"},
+		{Addr: "d:1080", EgressIP: "203.0.113.3"},
+	})
+
+	if got := atomic.LoadUint64(&p.rr); got != rr {
+		t.Fatalf("expected Merge to keep the round-robin cursor at %d, got %d", rr, got)
+	}
+	if len(p.dest) != 1 {
+		t.Fatalf("expected Merge to keep destination state, got %v", p.dest)
+	}
+	got := p.Entries()
+	if len(got) != 3 || got[2].Addr != "d:1080" {
+		t.Fatalf("expected only d appended (c shares a's egress IP), got %+v", got)
+	}
+}
+
+func TestMerge_RemovesEntriesThatNoLongerQualify(t *testing.T) {
+	p := newTestPool(t,
+		Entry{Addr: "a:1080", EgressIP: "203.0.113.1", Anonymity: AnonymityElite},
+		Entry{Addr: "b:1080", EgressIP: "203.0.113.2", Anonymity: AnonymityElite},
+		Entry{Addr: "c:1080", EgressIP: "203.0.113.3", Anonymity: AnonymityElite},
+	)
+	p.SetAttributeFilter(AttributeFilter{DedupByEgressIP: true, MinAnonymity: AnonymityAnonymous})
+
+	p.Merge([]Entry{
+		// a now leaks the client IP.
+		{Addr: "a:1080", EgressIP: "203.0.113.1", Anonymity: AnonymityTransparent},
+		// b now exits through c's IP.
+		{Addr: "b:1080", EgressIP: "203.0.113.3"},
+		// d takes over b's former IP.
+		{Addr: "d:1080", EgressIP: "203.0.113.2"},
+	})
+
+	got := p.Entries()
+	if len(got) != 2 || got[0].Addr != "c:1080" || got[1].Addr != "d:1080" {
+		t.Fatalf("expected only c and d to remain, got %+v", got)
+	}
+	if e, ok := p.Get("d:1080", time.Now()); !ok || e.Addr != "d:1080" {
+		t.Fatalf("expected the index to follow the removals, got %+v, %v", e, ok)
+	}
+}
+
+func TestMerge_UpsertsWithoutDropping(t *testing.T) {
+	p := newTestPool(t,
+		Entry{Addr: "a:1080", Latency: 100 * time.Millisecond},
+		Entry{Addr: "b:1080", Latency: 100 * time.Millisecond},
+	)
+	now := time.Now()
+	p.MarkFailure("a:1080", now, time.Minute, time.Hour)
+
+	p.Merge([]Entry{
+		{Addr: "a:1080", Latency: 50 * time.Millisecond},
+		{Addr: "c:1080", Latency: 70 * time.Millisecond},
+	})
+
+	got := p.Entries()
+	if len(got) != 3 || got[0].Addr != "a:1080" || got[1].Addr != "b:1080" || got[2].Addr != "c:1080" {
+		t.Fatalf("expected existing entries in place and c appended, got %+v", got)
+	}
+	if got[0].Latency != 50*time.Millisecond {
+		t.Fatalf("expected merged health-check latency, got %v", got[0].Latency)
+	}
+	if _, ok := p.Get("a:1080", now); ok {
+		t.Fatalf("expected a to keep its breaker state across Merge")
+	}
+
+	// The refresh ends with Update, which drops what was not merged again.
+	p.Update([]Entry{{Addr: "a:1080"}, {Addr: "c:1080"}})
+	if st := p.Stats(now); st.Total != 2 {
+		t.Fatalf("expected b dropped by Update, got %+v", st)
+	}
+}
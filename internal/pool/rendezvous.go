@@ -0,0 +1,90 @@
+package pool
+
+import (
+	"sort"
+	"time"
+)
+
+// HRWScore is the rendezvous (highest random weight) score of nodeKey for
+// sessionKey: FNV-1a over both keys, separated by a zero byte.
+func HRWScore(sessionKey, nodeKey string) uint64 {
+	const (
+		offset64 = 14695981039346656037
+		prime64  = 1099511628211
+	)
+	var h uint64 = offset64
+	for i := 0; i < len(sessionKey); i++ {
+		h ^= uint64(sessionKey[i])
+		h *= prime64
+	}
+	h ^= 0
+	h *= prime64
+	for i := 0; i < len(nodeKey); i++ {
+		h ^= uint64(nodeKey[i])
+		h *= prime64
+	}
+	return h
+}
+
+// PickRendezvous returns the candidate with the highest HRWScore for sessionKey,
+// skipping keys in exclude. A session keeps its upstream as long as it stays a
+// candidate, and only sessions mapped to a removed upstream move.
+func PickRendezvous(candidates []Entry, sessionKey string, exclude map[string]struct{}) (Entry, bool) {
+	var best Entry
+	var bestScore uint64
+	found := false
+
+	for i := range candidates {
+		k := candidates[i].Key()
+		if exclude != nil {
+			if _, ok := exclude[k]; ok {
+				continue
+			}
+		}
+		score := HRWScore(sessionKey, k)
+		if !found || score > bestScore {
+			best = candidates[i]
+			bestScore = score
+			found = true
+		}
+	}
+
+	return best, found
+}
+
+// Candidate is a pool entry ranked for a session, as reported by Rank.
+type Candidate struct {
+	Key   string `json:"key"`
+	Addr  string `json:"addr"`
+	Score uint64 `json:"score"`
+	// Available reports whether the entry can be picked for the query: its breaker
+	// admits traffic, it carries the labels and it is not backed off for the host.
+	Available     bool         `json:"available"`
+	State         BreakerState `json:"state"`
+	DisabledUntil time.Time    `json:"disabled_until,omitempty"`
+}
+
+// Rank returns every entry with its HRW score for sessionKey, highest first.
+func (p *Pool) Rank(sessionKey string, q Query, now time.Time) []Candidate {
+	q.Host = NormalizeHost(q.Host)
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	out := make([]Candidate, 0, len(p.entries))
+	for _, e := range p.entries {
+		c := Candidate{
+			Key:       e.Key(),
+			Addr:      e.Addr,
+			Score:     HRWScore(sessionKey, e.Key()),
+			Available: p.matches(e, q, now),
+			State:     e.BreakerState(now),
+		}
+		if c.State != BreakerClosed {
+			c.DisabledUntil = e.disabledUntil
+		}
+		out = append(out, c)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Score > out[j].Score })
+	return out
+}
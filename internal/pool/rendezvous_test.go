@@ -0,0 +1,67 @@
+package pool
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPickRendezvous_StableAndExclude(t *testing.T) {
+	candidates := []Entry{
+		{ID: "n1"},
+		{ID: "n2"},
+		{ID: "n3"},
+	}
+
+	best1, ok := PickRendezvous(candidates, "sess", nil)
+	if !ok {
+		t.Fatalf("expected ok")
+	}
+	best2, ok := PickRendezvous(candidates, "sess", nil)
+	if !ok {
+		t.Fatalf("expected ok")
+	}
+	if best1.Key() != best2.Key() {
+		t.Fatalf("expected stable pick, got %q vs %q", best1.Key(), best2.Key())
+	}
+
+	exclude := map[string]struct{}{best1.Key(): {}}
+	second, ok := PickRendezvous(candidates, "sess", exclude)
+	if !ok {
+		t.Fatalf("expected ok")
+	}
+	if second.Key() == best1.Key() {
+		t.Fatalf("expected different pick when excluding best")
+	}
+}
+
+func TestRank_OrdersByScoreAndReportsDisabled(t *testing.T) {
+	p := newTestPool(t, Entry{ID: "n1"}, Entry{ID: "n2"}, Entry{ID: "n3"})
+	now := time.Now()
+	p.MarkFailure("n2", now, time.Minute, time.Hour)
+
+	ranked := p.Rank("sess", Query{}, now)
+	if len(ranked) != 3 {
+		t.Fatalf("expected all entries, got %d", len(ranked))
+	}
+	for i := 1; i < len(ranked); i++ {
+		if ranked[i].Score > ranked[i-1].Score {
+			t.Fatalf("expected descending scores: %+v", ranked)
+		}
+	}
+	best, _ := PickRendezvous(p.Active(now), "sess", nil)
+	for _, c := range ranked {
+		if c.Key == "n2" {
+			if c.Available || c.State != BreakerOpen || c.DisabledUntil.IsZero() {
+				t.Fatalf("expected n2 to be reported open: %+v", c)
+			}
+			continue
+		}
+		if !c.Available {
+			t.Fatalf("expected %s to be available", c.Key)
+		}
+		if c.Key == best.Key() {
+			return
+		}
+		t.Fatalf("expected first available candidate to be the HRW pick %q, got %q", best.Key(), c.Key)
+	}
+}
@@ -0,0 +1,116 @@
+package pool
+
+import "time"
+
+// ScoringConfig controls how quality scores affect selection.
+type ScoringConfig struct {
+	// Enabled turns on ejection: entries scoring below EjectBelow after at least
+	// MinSamples outcomes are skipped until their score recovers.
+	Enabled bool
+	// EjectBelow is the score threshold (0-100). 0 disables ejection.
+	EjectBelow float64
+	// MinSamples is the number of outcomes required before an entry can be ejected.
+	MinSamples int
+}
+
+// Outcome is the result of one use of an upstream, either real traffic or an
+// active probe.
+type Outcome struct {
+	OK bool
+	// TTFB is the time from dialing to the first response byte (or the probe
+	// latency). Zero when unknown.
+	TTFB time.Duration
+	// Lifetime is how long a tunnel stayed open. Zero when not applicable.
+	Lifetime time.Duration
+}
+
+// scoreAlpha is the weight of the newest outcome in the quality EWMAs.
+const scoreAlpha = 0.2
+
+// scoreRefLatency is the latency at which the latency factor of the score is 0.5.
+const scoreRefLatency = time.Second
+
+// quality is the per-entry state behind Entry.Score, carried across Update.
+type quality struct {
+	// failRate is the EWMA of failed outcomes (0 = none failed). Starting at zero
+	// keeps new entries at full score until they prove otherwise.
+	failRate float64
+	ttfb     time.Duration
+	lifetime time.Duration
+	samples  int
+}
+
+func ewmaDuration(prev, d time.Duration) time.Duration {
+	if prev <= 0 {
+		return d
+	}
+	return time.Duration(scoreAlpha*float64(d) + (1-scoreAlpha)*float64(prev))
+}
+
+// SetScoring configures score-based ejection.
+func (p *Pool) SetScoring(cfg ScoringConfig) {
+	if cfg.MinSamples < 0 {
+		cfg.MinSamples = 0
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.scoring = cfg
+}
+
+// ObserveOutcome feeds a traffic or probe outcome into key's quality score.
+func (p *Pool) ObserveOutcome(key string, o Outcome) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	idx, ok := p.index[key]
+	if !ok {
+		return
+	}
+	q := &p.entries[idx].quality
+	fail := 0.0
+	if !o.OK {
+		fail = 1
+	}
+	q.failRate = scoreAlpha*fail + (1-scoreAlpha)*q.failRate
+	q.samples++
+	if o.TTFB > 0 {
+		q.ttfb = ewmaDuration(q.ttfb, o.TTFB)
+	}
+	if o.Lifetime > 0 {
+		q.lifetime = ewmaDuration(q.lifetime, o.Lifetime)
+	}
+}
+
+// Score returns the entry's quality score between 0 and 100: the success rate of
+// recent outcomes scaled by a latency factor that halves at one second of
+// time-to-first-byte (the health-check latency until traffic has been seen).
+func (e Entry) Score() float64 {
+	lat := e.quality.ttfb
+	if lat <= 0 {
+		lat = e.Latency
+	}
+	lat = latencyOrDefault(lat)
+	return 100 * (1 - e.quality.failRate) * float64(scoreRefLatency) / float64(scoreRefLatency+lat)
+}
+
+// QualityStats returns the inputs of Score: the EWMA success rate, time-to-first-byte
+// and tunnel lifetime, and the number of outcomes observed.
+func (e Entry) QualityStats() (okRate float64, ttfb, lifetime time.Duration, samples int) {
+	q := e.quality
+	return 1 - q.failRate, q.ttfb, q.lifetime, q.samples
+}
+
+// Ejected reports whether the pool currently skips e for its low score.
+func (p *Pool) Ejected(e Entry) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return !p.scoredEnough(e)
+}
+
+// scoredEnough reports whether e escapes score-based ejection. Callers must hold p.mu.
+func (p *Pool) scoredEnough(e Entry) bool {
+	s := p.scoring
+	if !s.Enabled || s.EjectBelow <= 0 || e.quality.samples < s.MinSamples {
+		return true
+	}
+	return e.Score() >= s.EjectBelow
+}
@@ -0,0 +1,107 @@
+package pool
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScore(t *testing.T) {
+	p := newTestPool(t,
+		Entry{Addr: "a:1080", Latency: 100 * time.Millisecond},
+		Entry{Addr: "b:1080", Latency: 100 * time.Millisecond},
+	)
+
+	score := func(addr string) float64 {
+		e, _ := p.Get(addr, time.Now())
+		return e.Score()
+	}
+	if s := score("a:1080"); s < 90 || s > 91 {
+		t.Fatalf("expected a fresh 100ms upstream to score ~90.9, got %v", s)
+	}
+
+	p.ObserveOutcome("a:1080", Outcome{OK: true, TTFB: 200 * time.Millisecond, Lifetime: time.Minute})
+	p.ObserveOutcome("b:1080", Outcome{})
+	if a, b := score("a:1080"), score("b:1080"); a <= b {
+		t.Fatalf("expected the failing upstream to score lower, got a=%v b=%v", a, b)
+	}
+
+	e, _ := p.Get("a:1080", time.Now())
+	okRate, ttfb, lifetime, samples := e.QualityStats()
+	if okRate != 1 || ttfb != 200*time.Millisecond || lifetime != time.Minute || samples != 1 {
+		t.Fatalf("unexpected quality stats: ok=%v ttfb=%v lifetime=%v samples=%d", okRate, ttfb, lifetime, samples)
+	}
+
+	// Quality survives a refresh.
+	p.Update([]Entry{{Addr: "a:1080", Latency: time.Second}})
+	e, _ = p.Get("a:1080", time.Now())
+	if _, ttfb, _, samples := e.QualityStats(); ttfb != 200*time.Millisecond || samples != 1 {
+		t.Fatalf("expected quality to be carried across Update, got ttfb=%v samples=%d", ttfb, samples)
+	}
+}
+
+func TestScoringEjection(t *testing.T) {
+	p := newTestPool(t,
+		Entry{Addr: "good:1080", Latency: 50 * time.Millisecond},
+		Entry{Addr: "bad:1080", Latency: 50 * time.Millisecond},
+	)
+	p.SetScoring(ScoringConfig{Enabled: true, EjectBelow: 40, MinSamples: 3})
+
+	fail := func(n int) {
+		for i := 0; i < n; i++ {
+			p.ObserveOutcome("bad:1080", Outcome{})
+		}
+	}
+	active := func() map[string]bool {
+		got := map[string]bool{}
+		for _, e := range p.Active(time.Now()) {
+			got[e.Addr] = true
+		}
+		return got
+	}
+
+	fail(2)
+	if got := active(); !got["bad:1080"] {
+		t.Fatalf("expected no ejection below min_samples, got %v", got)
+	}
+	fail(3)
+	if got := active(); len(got) != 1 || !got["good:1080"] {
+		t.Fatalf("expected the failing upstream to be ejected, got %v", got)
+	}
+	bad, _ := p.Get("bad:1080", time.Now())
+	if !p.Ejected(bad) {
+		t.Fatalf("expected Ejected to report the failing upstream")
+	}
+
+	// Successful re-probes bring it back.
+	for i := 0; i < 10; i++ {
+		p.ObserveOutcome("bad:1080", Outcome{OK: true, TTFB: 50 * time.Millisecond})
+	}
+	if got := active(); !got["bad:1080"] {
+		t.Fatalf("expected the recovered upstream to be readmitted, got %v", got)
+	}
+}
+
+func TestNext_QualityPrefersHealthyUpstreams(t *testing.T) {
+	p := newTestPool(t,
+		Entry{Addr: "good:1080", Latency: 100 * time.Millisecond},
+		Entry{Addr: "flaky:1080", Latency: 100 * time.Millisecond},
+	)
+	for i := 0; i < 10; i++ {
+		p.ObserveOutcome("flaky:1080", Outcome{})
+	}
+
+	counts := map[string]int{}
+	for i := 0; i < 1000; i++ {
+		e, ok := p.Next("quality", time.Now())
+		if !ok {
+			t.Fatalf("expected an upstream")
+		}
+		counts[e.Addr]++
+	}
+	if counts["good:1080"] < 800 {
+		t.Fatalf("expected the healthy upstream to dominate, got %v", counts)
+	}
+	if counts["flaky:1080"] == 0 {
+		t.Fatalf("expected the flaky upstream to still get occasional traffic, got %v", counts)
+	}
+}
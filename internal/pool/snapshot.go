@@ -0,0 +1,88 @@
+package pool
+
+import "time"
+
+// EntryState is the serializable form of an Entry, including the runtime state
+// (breaker, EWMA, usage, quality) that is otherwise unexported.
+type EntryState struct {
+	Entry
+
+	BreakerFailures      int           `json:"breaker_failures,omitempty"`
+	BreakerDisabledUntil time.Time     `json:"breaker_disabled_until,omitempty"`
+	BreakerOpens         int           `json:"breaker_opens,omitempty"`
+	ObservedEWMA         time.Duration `json:"observed_ewma,omitempty"`
+	SuccessTotal         uint64        `json:"success_total,omitempty"`
+	FailureTotal         uint64        `json:"failure_total,omitempty"`
+	QualityFailRate      float64       `json:"quality_fail_rate,omitempty"`
+	QualityTTFB          time.Duration `json:"quality_ttfb,omitempty"`
+	QualityLifetime      time.Duration `json:"quality_lifetime,omitempty"`
+	QualitySamples       int           `json:"quality_samples,omitempty"`
+}
+
+func (s EntryState) entry() Entry {
+	e := s.Entry
+	e.failures = s.BreakerFailures
+	e.disabledUntil = s.BreakerDisabledUntil
+	e.opens = s.BreakerOpens
+	e.ewma = s.ObservedEWMA
+	e.successTotal = s.SuccessTotal
+	e.failureTotal = s.FailureTotal
+	e.quality = quality{failRate: s.QualityFailRate, ttfb: s.QualityTTFB, lifetime: s.QualityLifetime, samples: s.QualitySamples}
+	return e
+}
+
+// Export returns the pool contents with their runtime state, for persisting.
+func (p *Pool) Export() []EntryState {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	out := make([]EntryState, 0, len(p.entries))
+	for _, e := range p.entries {
+		out = append(out, EntryState{
+			Entry:                e,
+			BreakerFailures:      e.failures,
+			BreakerDisabledUntil: e.disabledUntil,
+			BreakerOpens:         e.opens,
+			ObservedEWMA:         e.ewma,
+			SuccessTotal:         e.successTotal,
+			FailureTotal:         e.failureTotal,
+			QualityFailRate:      e.quality.failRate,
+			QualityTTFB:          e.quality.ttfb,
+			QualityLifetime:      e.quality.lifetime,
+			QualitySamples:       e.quality.samples,
+		})
+	}
+	return out
+}
+
+// Restore replaces the pool contents with previously exported entries, including
+// their runtime state. It is meant for warm starts before the first Update. The
+// attribute filter applies as in Update, so entries that no longer qualify (e.g.
+// after raising min_anonymity) are not restored. It returns the number of entries
+// restored.
+func (p *Pool) Restore(states []EntryState) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	unique := make([]Entry, 0, len(states))
+	seen := make(map[string]struct{}, len(states))
+	for _, s := range states {
+		e := s.entry()
+		k := e.Key()
+		if _, dup := seen[k]; dup {
+			continue
+		}
+		seen[k] = struct{}{}
+		unique = append(unique, e)
+	}
+	entries, leaking, collapsed := p.admitLocked(unique)
+	index := make(map[string]int, len(entries))
+	for i, e := range entries {
+		index[e.Key()] = i
+	}
+	p.entries = entries
+	p.index = index
+	p.pruneDestLocked()
+
+	p.log.Info("pool restored", "pool", p.name, "entries", len(entries), "collapsed", collapsed, "below_min_anonymity", leaking)
+	return len(entries)
+}
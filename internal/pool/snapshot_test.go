@@ -0,0 +1,73 @@
+package pool
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestExportRestore_RoundTripsRuntimeState(t *testing.T) {
+	src := newTestPool(t,
+		Entry{ID: "n1", Addr: "127.0.0.1:1080", Username: "n1", Password: "pw", Latency: 120 * time.Millisecond},
+		Entry{Addr: "b:1080"},
+	)
+	now := time.Now()
+	src.ObserveLatency("n1", 80*time.Millisecond)
+	src.MarkSuccess("n1", now)
+	src.MarkFailure("b:1080", now, time.Minute, time.Hour)
+
+	b, err := json.Marshal(src.Export())
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var states []EntryState
+	if err := json.Unmarshal(b, &states); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	dst := newTestPool(t)
+	dst.Restore(states)
+
+	n1, ok := dst.Get("n1", now)
+	if !ok {
+		t.Fatalf("expected n1 to be restored and selectable")
+	}
+	if n1.Password != "pw" || n1.Latency != 120*time.Millisecond || n1.EWMA() != 80*time.Millisecond {
+		t.Fatalf("unexpected restored entry: %+v", n1)
+	}
+	if s, _ := n1.Usage(); s != 1 {
+		t.Fatalf("expected usage to be restored, got %d successes", s)
+	}
+	if _, ok := dst.Get("b:1080", now); ok {
+		t.Fatalf("expected b:1080 to stay open after restore")
+	}
+	if st := dst.Stats(now); st.Total != 2 || st.Disabled != 1 {
+		t.Fatalf("unexpected stats after restore: %+v", st)
+	}
+}
+
+func TestRestore_AppliesAttributeFilter(t *testing.T) {
+	src := newTestPool(t,
+		Entry{Addr: "leaky:1080", Anonymity: AnonymityTransparent},
+		Entry{Addr: "slow:1080", EgressIP: "203.0.113.1", Latency: 300 * time.Millisecond},
+		Entry{Addr: "fast:1080", EgressIP: "203.0.113.1", Latency: 100 * time.Millisecond},
+		Entry{Addr: "other:1080", EgressIP: "203.0.113.2"},
+	)
+
+	// Restarted with stricter settings than the snapshot was taken with.
+	dst := newTestPool(t)
+	dst.SetAttributeFilter(AttributeFilter{DedupByEgressIP: true, MinAnonymity: AnonymityAnonymous})
+	if n := dst.Restore(src.Export()); n != 2 {
+		t.Fatalf("expected 2 entries restored, got %d", n)
+	}
+	got := map[string]bool{}
+	for _, e := range dst.Entries() {
+		got[e.Addr] = true
+	}
+	if !got["fast:1080"] || !got["other:1080"] {
+		t.Fatalf("expected the leaking and duplicate entries to be dropped, got %v", got)
+	}
+	if _, ok := dst.Get("fast:1080", time.Now()); !ok {
+		t.Fatalf("expected the index to be rebuilt")
+	}
+}
@@ -0,0 +1,48 @@
+package pool
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTaintedEntriesAreNotSelected(t *testing.T) {
+	p := newTestPool(t,
+		Entry{Addr: "mitm:1080", Tainted: true},
+		Entry{Addr: "ok:1080"},
+	)
+	now := time.Now()
+
+	for i := 0; i < 10; i++ {
+		e, ok := p.Next("round_robin", now)
+		if !ok || e.Addr != "ok:1080" {
+			t.Fatalf("expected only the untainted upstream, got %+v, %v", e, ok)
+		}
+	}
+	if _, ok := p.Get("mitm:1080", now); ok {
+		t.Fatalf("expected Get to refuse a tainted upstream")
+	}
+	if n := len(p.Entries()); n != 2 {
+		t.Fatalf("expected tainted upstream to stay in the pool, got %d entries", n)
+	}
+
+	p.SetAttributeFilter(AttributeFilter{AllowTainted: true})
+	if len(p.Active(now)) != 2 {
+		t.Fatalf("expected tainted upstream to be selectable when allowed")
+	}
+}
+
+func TestTaintCarriedWithoutVerdict(t *testing.T) {
+	p := newTestPool(t, Entry{Addr: "mitm:1080", Tainted: true, TaintChecked: true})
+
+	// A refresh whose interception check failed keeps the previous verdict.
+	p.Update([]Entry{{Addr: "mitm:1080"}})
+	if got := p.Entries()[0]; !got.Tainted || !got.TaintChecked {
+		t.Fatalf("expected taint to be carried over, got %+v", got)
+	}
+
+	// A new verdict replaces it.
+	p.Update([]Entry{{Addr: "mitm:1080", TaintChecked: true}})
+	if got := p.Entries()[0]; got.Tainted {
+		t.Fatalf("expected a clean verdict to clear the taint, got %+v", got)
+	}
+}
@@ -0,0 +1,30 @@
+package pool
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMinThroughput(t *testing.T) {
+	p := newTestPool(t,
+		Entry{Addr: "slow:1080", Throughput: 10 << 10},
+		Entry{Addr: "fast:1080", Throughput: 5 << 20},
+		Entry{Addr: "unmeasured:1080"},
+	)
+	p.SetAttributeFilter(AttributeFilter{MinThroughput: 1 << 20})
+
+	got := map[string]bool{}
+	for _, e := range p.Active(time.Now()) {
+		got[e.Addr] = true
+	}
+	if len(got) != 2 || got["slow:1080"] {
+		t.Fatalf("expected the slow upstream to be skipped, got %v", got)
+	}
+
+	// A failed measurement keeps the previous rate.
+	p.Update([]Entry{{Addr: "slow:1080"}, {Addr: "fast:1080"}})
+	active := p.Active(time.Now())
+	if len(active) != 1 || active[0].Addr != "fast:1080" || active[0].Throughput != 5<<20 {
+		t.Fatalf("expected only the fast upstream with its carried rate, got %+v", active)
+	}
+}
@@ -0,0 +1,238 @@
+// Package routing decides per request whether traffic goes through a pool (or a
+// labeled subset of it), directly to the destination, or is rejected.
+package routing
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/CodeBoy2006/EasyProxyPool/internal/config"
+)
+
+type Action string
+
+const (
+	ActionPool   Action = "pool"
+	ActionDirect Action = "direct"
+	ActionReject Action = "reject"
+)
+
+// Listener names as used by routing rules.
+const (
+	ListenerSOCKS5Relaxed = "socks5_relaxed"
+	ListenerSOCKS5Strict  = "socks5_strict"
+	ListenerHTTPRelaxed   = "http_relaxed"
+	ListenerHTTPStrict    = "http_strict"
+)
+
+// Request describes the request being routed.
+type Request struct {
+	// Host is the destination host without port (domain name or IP literal).
+	Host string
+	// IP is the destination address when known (IP literal or resolved by the listener).
+	IP       net.IP
+	Port     int
+	Listener string
+	User     string
+}
+
+// Decision is the outcome of the first matching rule.
+type Decision struct {
+	Rule   string
+	Action Action
+	// Pool is the named pool to select from; empty means the listener's pool.
+	Pool   string
+	Labels map[string]string
+}
+
+type portRange struct{ from, to int }
+
+type rule struct {
+	name string
+
+	suffixes []string
+	keywords []string
+	regexes  []*regexp.Regexp
+	nets     []*net.IPNet
+	ports    []portRange
+	listener map[string]struct{}
+	users    map[string]struct{}
+
+	decision Decision
+}
+
+// Router evaluates rules in order. A nil Router matches nothing.
+type Router struct {
+	rules []rule
+}
+
+// New compiles routing rules. cfg is expected to be validated by config.Load,
+// which also names unnamed rules and defaults their action to pool.
+func New(cfg config.RoutingConfig) (*Router, error) {
+	r := &Router{}
+	for _, rc := range cfg.Rules {
+		ru := rule{
+			name: rc.Name,
+			decision: Decision{
+				Rule:   rc.Name,
+				Action: Action(rc.Action),
+				Pool:   rc.Pool,
+				Labels: rc.Labels,
+			},
+		}
+		if ru.decision.Pool == "default" {
+			ru.decision.Pool = ""
+		}
+		for _, s := range rc.DomainSuffix {
+			if s = normalizeHost(s); s != "" {
+				ru.suffixes = append(ru.suffixes, strings.TrimPrefix(s, "."))
+			}
+		}
+		for _, k := range rc.DomainKeyword {
+			if k = strings.ToLower(strings.TrimSpace(k)); k != "" {
+				ru.keywords = append(ru.keywords, k)
+			}
+		}
+		for _, s := range rc.DomainRegex {
+			re, err := regexp.Compile(s)
+			if err != nil {
+				return nil, fmt.Errorf("%s: domain_regex: %w", ru.name, err)
+			}
+			ru.regexes = append(ru.regexes, re)
+		}
+		for _, c := range rc.CIDR {
+			_, n, err := net.ParseCIDR(strings.TrimSpace(c))
+			if err != nil {
+				return nil, fmt.Errorf("%s: cidr: %w", ru.name, err)
+			}
+			ru.nets = append(ru.nets, n)
+		}
+		for _, p := range rc.Port {
+			from, to, err := config.ParsePortRange(p)
+			if err != nil {
+				return nil, fmt.Errorf("%s: port: %w", ru.name, err)
+			}
+			ru.ports = append(ru.ports, portRange{from: from, to: to})
+		}
+		if len(rc.Listener) > 0 {
+			ru.listener = make(map[string]struct{}, len(rc.Listener))
+			for _, l := range rc.Listener {
+				ru.listener[l] = struct{}{}
+			}
+		}
+		if len(rc.User) > 0 {
+			ru.users = make(map[string]struct{}, len(rc.User))
+			for _, u := range rc.User {
+				ru.users[u] = struct{}{}
+			}
+		}
+		r.rules = append(r.rules, ru)
+	}
+	return r, nil
+}
+
+// MatchesIP reports whether any rule has cidr conditions, i.e. whether the
+// destination IP of domain requests takes part in matching.
+func (r *Router) MatchesIP() bool {
+	if r == nil {
+		return false
+	}
+	for i := range r.rules {
+		if len(r.rules[i].nets) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Match returns the decision of the first rule matching req.
+func (r *Router) Match(req Request) (Decision, bool) {
+	if r == nil || len(r.rules) == 0 {
+		return Decision{}, false
+	}
+	req.Host = normalizeHost(req.Host)
+	if req.IP == nil {
+		req.IP = net.ParseIP(req.Host)
+	}
+	for i := range r.rules {
+		if r.rules[i].matches(req) {
+			return r.rules[i].decision, true
+		}
+	}
+	return Decision{}, false
+}
+
+func (ru *rule) matches(req Request) bool {
+	if len(ru.suffixes) > 0 || len(ru.keywords) > 0 || len(ru.regexes) > 0 {
+		if !ru.matchDomain(req.Host) {
+			return false
+		}
+	}
+	if len(ru.nets) > 0 && !ru.matchIP(req.IP) {
+		return false
+	}
+	if len(ru.ports) > 0 && !ru.matchPort(req.Port) {
+		return false
+	}
+	if ru.listener != nil {
+		if _, ok := ru.listener[req.Listener]; !ok {
+			return false
+		}
+	}
+	if ru.users != nil {
+		if _, ok := ru.users[req.User]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// matchDomain reports whether host matches any suffix, keyword or regex.
+func (ru *rule) matchDomain(host string) bool {
+	if host == "" {
+		return false
+	}
+	for _, s := range ru.suffixes {
+		if host == s || strings.HasSuffix(host, "."+s) {
+			return true
+		}
+	}
+	for _, k := range ru.keywords {
+		if strings.Contains(host, k) {
+			return true
+		}
+	}
+	for _, re := range ru.regexes {
+		if re.MatchString(host) {
+			return true
+		}
+	}
+	return false
+}
+
+func (ru *rule) matchIP(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, n := range ru.nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (ru *rule) matchPort(port int) bool {
+	for _, p := range ru.ports {
+		if port >= p.from && port <= p.to {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+}
@@ -0,0 +1,60 @@
+package routing
+
+import (
+	"net"
+	"testing"
+
+	"github.com/CodeBoy2006/EasyProxyPool/internal/config"
+)
+
+func TestRouter_FirstMatchWins(t *testing.T) {
+	r, err := New(config.RoutingConfig{Rules: []config.RoutingRuleConfig{
+		{Name: "internal", DomainSuffix: []string{"corp.example.com"}, CIDR: nil, Action: "direct"},
+		{Name: "lan", CIDR: []string{"10.0.0.0/8"}, Action: "direct"},
+		{Name: "ads", DomainRegex: []string{`^ads\.`}, Action: "reject"},
+		{Name: "video", DomainKeyword: []string{"video"}, Port: []string{"443", "8000-9000"}, Action: "pool", Pool: "strict", Labels: map[string]string{"type": "vless"}},
+		{Name: "tenant", User: []string{"tenantA"}, Listener: []string{ListenerHTTPRelaxed}, Action: "reject"},
+	}})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	cases := []struct {
+		name string
+		req  Request
+		rule string
+		ok   bool
+	}{
+		{"suffix_exact", Request{Host: "corp.example.com"}, "internal", true},
+		{"suffix_sub", Request{Host: "Git.Corp.Example.com."}, "internal", true},
+		{"suffix_not_partial", Request{Host: "evilcorp.example.com"}, "", false},
+		{"cidr_literal", Request{Host: "10.1.2.3"}, "lan", true},
+		{"cidr_resolved", Request{Host: "nas.home", IP: net.ParseIP("10.9.9.9")}, "lan", true},
+		{"regex", Request{Host: "ads.tracker.net"}, "ads", true},
+		{"keyword_port", Request{Host: "www.video.com", Port: 443}, "video", true},
+		{"keyword_port_range", Request{Host: "www.video.com", Port: 8080}, "video", true},
+		{"keyword_wrong_port", Request{Host: "www.video.com", Port: 80}, "", false},
+		{"user_listener", Request{Host: "x.org", User: "tenantA", Listener: ListenerHTTPRelaxed}, "tenant", true},
+		{"user_other_listener", Request{Host: "x.org", User: "tenantA", Listener: ListenerSOCKS5Relaxed}, "", false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			d, ok := r.Match(tc.req)
+			if ok != tc.ok || d.Rule != tc.rule {
+				t.Fatalf("expected rule %q (ok=%v), got %q (ok=%v)", tc.rule, tc.ok, d.Rule, ok)
+			}
+		})
+	}
+
+	d, _ := r.Match(Request{Host: "video.com", Port: 443})
+	if d.Action != ActionPool || d.Pool != "strict" || d.Labels["type"] != "vless" {
+		t.Fatalf("unexpected decision: %+v", d)
+	}
+}
+
+func TestRouter_NilMatchesNothing(t *testing.T) {
+	var r *Router
+	if _, ok := r.Match(Request{Host: "example.com"}); ok {
+		t.Fatalf("expected no match")
+	}
+}
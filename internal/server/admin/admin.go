@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"io/fs"
 	"log/slog"
+	"math"
 	"net/http"
 	"runtime"
 	"runtime/debug"
@@ -34,14 +35,36 @@ type Options struct {
 	LogBuffer     *logging.LogBuffer
 	MaxSSEClients int
 	SSEHeartbeat  time.Duration
+
+	// StrictPool is the optional STRICT pool; nil when no strict listener is configured.
+	StrictPool *pool.Pool
+
+	// Pools lists every pool (including the default one) when named pools are
+	// configured; /api/status then reports each of them under "pools".
+	Pools []NamedPool
+
+	// Leases is the sticky session table shared by the proxy listeners; nil
+	// disables the /api/sessions endpoints.
+	Leases *pool.Leases
+}
+
+// NamedPool is a pool with its own updater, as configured via sources[].pool.
+type NamedPool struct {
+	Name       string
+	Pool       *pool.Pool
+	StrictPool *pool.Pool
+	Status     *orchestrator.Status
 }
 
 type Server struct {
 	log *slog.Logger
 	srv *http.Server
 
-	status *orchestrator.Status
-	pool   *pool.Pool
+	status     *orchestrator.Status
+	pool       *pool.Pool
+	poolStrict *pool.Pool
+	pools      []NamedPool
+	leases     *pool.Leases
 
 	auth      config.AdminAuthConfig
 	startedAt time.Time
@@ -61,6 +84,9 @@ func New(log *slog.Logger, addr string, status *orchestrator.Status, p *pool.Poo
 		log:          log,
 		status:       status,
 		pool:         p,
+		poolStrict:   opt.StrictPool,
+		pools:        opt.Pools,
+		leases:       opt.Leases,
 		auth:         opt.Auth,
 		startedAt:    opt.StartedAt,
 		logBuf:       opt.LogBuffer,
@@ -78,7 +104,12 @@ func New(log *slog.Logger, addr string, status *orchestrator.Status, p *pool.Poo
 	mux.Handle("/api/status", s.wrapAuth(http.HandlerFunc(s.handleStatus)))
 	mux.Handle("/api/info", s.wrapAuth(http.HandlerFunc(s.handleInfo)))
 	mux.Handle("/api/nodes", s.wrapAuth(http.HandlerFunc(s.handleNodes)))
+	mux.Handle("/api/nodes/history", s.wrapAuth(http.HandlerFunc(s.handleNodeHistory)))
 	mux.Handle("/api/events/logs", s.wrapAuth(http.HandlerFunc(s.handleLogsSSE)))
+	mux.Handle("/api/select/explain", s.wrapAuth(http.HandlerFunc(s.handleSelectExplain)))
+	mux.Handle("/api/sessions", s.wrapAuth(http.HandlerFunc(s.handleSessions)))
+	mux.Handle("/api/sessions/rotate", s.wrapAuth(http.HandlerFunc(s.handleSessionRotate)))
+	mux.Handle("/api/sessions/drop", s.wrapAuth(http.HandlerFunc(s.handleSessionDrop)))
 
 	if opt.UIEnabled {
 		mux.Handle("/ui/", s.wrapAuth(http.HandlerFunc(s.handleUI)))
@@ -115,6 +146,23 @@ func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
 		"pool":            s.pool.Stats(now),
 		"server_time_utc": now.UTC().Format(time.RFC3339),
 	}
+	if s.poolStrict != nil {
+		resp["pool_strict"] = s.poolStrict.Stats(now)
+	}
+	if len(s.pools) > 0 {
+		pools := make(map[string]any, len(s.pools))
+		for _, np := range s.pools {
+			item := map[string]any{
+				"updater": np.Status.Snapshot(),
+				"pool":    np.Pool.Stats(now),
+			}
+			if np.StrictPool != nil {
+				item["pool_strict"] = np.StrictPool.Stats(now)
+			}
+			pools[np.Name] = item
+		}
+		resp["pools"] = pools
+	}
 
 	writeJSON(w, resp)
 }
@@ -139,17 +187,69 @@ func (s *Server) handleInfo(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, info)
 }
 
+// nodeQuality is the quality score of a pool entry and its inputs (see
+// pool.Entry.Score), as reported by /api/nodes.
+type nodeQuality struct {
+	Score      float64 `json:"score"`
+	OKRate     float64 `json:"ok_rate"`
+	TTFBMS     int64   `json:"ttfb_ms"`
+	LifetimeMS int64   `json:"lifetime_ms"`
+	Samples    int     `json:"samples"`
+	Ejected    bool    `json:"ejected"`
+}
+
 func (s *Server) handleNodes(w http.ResponseWriter, r *http.Request) {
 	now := time.Now()
 
+	mode := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("mode")))
 	h, updatedAt := s.status.RelaxedNodeHealthSnapshot()
+	p := s.pool
+	if mode == "strict" {
+		h, updatedAt = s.status.StrictNodeHealthSnapshot()
+		p = s.poolStrict
+	} else {
+		mode = "relaxed"
+	}
 
 	type node struct {
-		ID          string `json:"id"`
-		Alive       bool   `json:"alive"`
-		DelayMS     int64  `json:"delay_ms"`
-		LastSeenUTC string `json:"last_seen_utc"`
-		LastTryUTC  string `json:"last_try_utc"`
+		ID            string            `json:"id"`
+		Alive         bool              `json:"alive"`
+		DelayMS       int64             `json:"delay_ms"`
+		LastSeenUTC   string            `json:"last_seen_utc"`
+		LastTryUTC    string            `json:"last_try_utc"`
+		EgressIP      string            `json:"egress_ip,omitempty"`
+		Country       string            `json:"country,omitempty"`
+		ASN           uint              `json:"asn,omitempty"`
+		ASOrg         string            `json:"as_org,omitempty"`
+		Anonymity     string            `json:"anonymity,omitempty"`
+		Tainted       bool              `json:"tainted,omitempty"`
+		ThroughputBps int64             `json:"throughput_bps,omitempty"`
+		Quality       *nodeQuality      `json:"quality,omitempty"`
+		Labels        map[string]string `json:"labels,omitempty"`
+	}
+
+	// Pool entries add what the health checks learned (egress IP, GeoIP, anonymity,
+	// taint, throughput in bytes/s), the quality score and labels to xray nodes
+	// (matched by ID) and stand in for upstreams without node health (legacy SOCKS5
+	// upstreams).
+	var entries []pool.Entry
+	if p != nil {
+		entries = p.Entries()
+	}
+	byKey := make(map[string]pool.Entry, len(entries))
+	for _, e := range entries {
+		byKey[e.Key()] = e
+	}
+	qualityOf := func(e pool.Entry) *nodeQuality {
+		okRate, ttfb, lifetime, samples := e.QualityStats()
+		return &nodeQuality{
+			Score:      math.Round(e.Score()*10) / 10,
+			OKRate:     math.Round(okRate*1000) / 1000,
+			TTFBMS:     int64(ttfb / time.Millisecond),
+			LifetimeMS: int64(lifetime / time.Millisecond),
+			Samples:    samples,
+			Ejected:    p.Ejected(e),
+		}
 	}
 
 	nodes := make([]node, 0, len(h))
@@ -166,12 +266,56 @@ func (s *Server) handleNodes(w http.ResponseWriter, r *http.Request) {
 		if !nh.LastTry.IsZero() {
 			lastTry = nh.LastTry.UTC().Format(time.RFC3339)
 		}
+		e, inPool := byKey[id]
+		delete(byKey, id)
+		var q *nodeQuality
+		if inPool {
+			q = qualityOf(e)
+		}
+		nodes = append(nodes, node{
+			ID:            id,
+			Alive:         nh.Alive,
+			DelayMS:       int64(nh.Delay / time.Millisecond),
+			LastSeenUTC:   lastSeen,
+			LastTryUTC:    lastTry,
+			EgressIP:      e.EgressIP,
+			Country:       e.Country,
+			ASN:           e.ASN,
+			ASOrg:         e.ASOrg,
+			Anonymity:     string(e.Anonymity),
+			Tainted:       e.Tainted,
+			ThroughputBps: e.Throughput,
+			Quality:       q,
+			Labels:        e.Labels,
+		})
+	}
+	for _, e := range entries {
+		if _, ok := byKey[e.Key()]; !ok {
+			continue
+		}
+		lastTry := ""
+		if !e.LastCheckedAt.IsZero() {
+			lastTry = e.LastCheckedAt.UTC().Format(time.RFC3339)
+		}
+		isAlive := e.BreakerState(now) != pool.BreakerOpen
+		if isAlive {
+			alive++
+		}
 		nodes = append(nodes, node{
-			ID:          id,
-			Alive:       nh.Alive,
-			DelayMS:     int64(nh.Delay / time.Millisecond),
-			LastSeenUTC: lastSeen,
-			LastTryUTC:  lastTry,
+			ID:            e.Key(),
+			Alive:         isAlive,
+			DelayMS:       int64(e.Latency / time.Millisecond),
+			LastSeenUTC:   lastTry,
+			LastTryUTC:    lastTry,
+			EgressIP:      e.EgressIP,
+			Country:       e.Country,
+			ASN:           e.ASN,
+			ASOrg:         e.ASOrg,
+			Anonymity:     string(e.Anonymity),
+			Tainted:       e.Tainted,
+			ThroughputBps: e.Throughput,
+			Quality:       qualityOf(e),
+			Labels:        e.Labels,
 		})
 	}
 	sort.Slice(nodes, func(i, j int) bool {
@@ -190,6 +334,7 @@ func (s *Server) handleNodes(w http.ResponseWriter, r *http.Request) {
 	}
 
 	resp := map[string]any{
+		"mode":            mode,
 		"nodes":           nodes,
 		"nodes_total":     len(nodes),
 		"nodes_alive":     alive,
@@ -130,6 +130,200 @@ func TestAdminNodesEndpoint_UsesStatusSnapshot(t *testing.T) {
 	}
 }
 
+func TestAdminStatus_ReportsNamedPools(t *testing.T) {
+	log := newTestLogger()
+	status := orchestrator.NewStatus()
+	p := pool.New("pool", log)
+	paid := pool.New("paid", log)
+	paid.Update([]pool.Entry{{Addr: "1.1.1.1:1080"}, {Addr: "2.2.2.2:1080"}})
+
+	s := New(log, ":0", status, p, Options{
+		Auth: config.AdminAuthConfig{Mode: "disabled"},
+		Pools: []NamedPool{
+			{Name: "default", Pool: p, Status: status},
+			{Name: "paid", Pool: paid, Status: orchestrator.NewStatus()},
+		},
+	})
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "http://example/api/status", nil)
+	s.srv.Handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 for /api/status, got %d", rec.Code)
+	}
+
+	var parsed struct {
+		Pool  pool.Stats `json:"pool"`
+		Pools map[string]struct {
+			Pool pool.Stats `json:"pool"`
+		} `json:"pools"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &parsed); err != nil {
+		t.Fatalf("parse response: %v", err)
+	}
+	if len(parsed.Pools) != 2 {
+		t.Fatalf("expected 2 pools, got %#v", parsed.Pools)
+	}
+	if parsed.Pool.Total != 0 || parsed.Pools["paid"].Pool.Total != 2 {
+		t.Fatalf("unexpected pool stats: %#v", parsed)
+	}
+}
+
+func TestAdminStatus_ReportsCheckProgress(t *testing.T) {
+	log := newTestLogger()
+	status := orchestrator.NewStatus()
+	status.SetProgress(orchestrator.CheckProgress{Running: true, Total: 10, Checked: 4, Healthy: 3})
+
+	s := New(log, ":0", status, pool.New("pool", log), Options{Auth: config.AdminAuthConfig{Mode: "disabled"}})
+	rec := httptest.NewRecorder()
+	s.srv.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://example/api/status", nil))
+
+	var parsed struct {
+		Updater struct {
+			Progress orchestrator.CheckProgress
+		} `json:"updater"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &parsed); err != nil {
+		t.Fatalf("parse response: %v", err)
+	}
+	if got := parsed.Updater.Progress; !got.Running || got.Total != 10 || got.Checked != 4 || got.Healthy != 3 {
+		t.Fatalf("unexpected progress: %+v", got)
+	}
+
+	status.SetEnd(time.Now(), 10, 3, nil, orchestrator.UpdateDetails{})
+	if got := status.Snapshot().Progress; got.Running || got.Checked != 4 {
+		t.Fatalf("expected progress to stop at the end of the refresh, got %+v", got)
+	}
+}
+
+func TestAdminNodeHistory(t *testing.T) {
+	log := newTestLogger()
+	status := orchestrator.NewStatus()
+	s := New(log, ":0", status, pool.New("pool", log), Options{Auth: config.AdminAuthConfig{Mode: "disabled"}})
+
+	get := func(url string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		s.srv.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		return rec
+	}
+	if rec := get("http://example/api/nodes/history"); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 without history, got %d", rec.Code)
+	}
+
+	h := orchestrator.NewHistory(orchestrator.HistoryConfig{Size: 10})
+	h.Record("1.1.1.1:1080", true, 80*time.Millisecond, time.Unix(10, 0))
+	h.Record("1.1.1.1:1080", false, 0, time.Unix(20, 0))
+	status.SetHistory(h)
+
+	rec := get("http://example/api/nodes/history?addr=1.1.1.1:1080")
+	var parsed struct {
+		Node orchestrator.NodeHistory `json:"node"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &parsed); err != nil {
+		t.Fatalf("parse response: %v", err)
+	}
+	if n := parsed.Node; n.Checks != 2 || n.UptimePct != 50 || n.ConsecutiveFailures != 1 || len(n.Recent) != 2 || n.Recent[0].LatencyMS != 80 {
+		t.Fatalf("unexpected node history: %+v", n)
+	}
+	if rec := get("http://example/api/nodes/history?addr=2.2.2.2:1080"); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown node, got %d", rec.Code)
+	}
+}
+
+func TestAdminNodesEndpoint_IncludesEgressIPAndLabels(t *testing.T) {
+	log := newTestLogger()
+	status := orchestrator.NewStatus()
+	p := pool.New("pool", log)
+	p.Update([]pool.Entry{
+		{ID: "n1", Addr: "127.0.0.1:17383", EgressIP: "203.0.113.1", Country: "US", ASN: 64500, Anonymity: pool.AnonymityElite, Throughput: 2 << 20, Labels: map[string]string{"type": "vless"}},
+		{Addr: "198.51.100.2:1080", EgressIP: "198.51.100.2", Tainted: true, Labels: map[string]string{"type": "socks5"}},
+	})
+	p.ObserveOutcome("n1", pool.Outcome{})
+	status.SetRelaxedNodeHealth(time.Unix(10, 0), map[string]xray.NodeHealth{
+		"n1": {Alive: true, Delay: 120 * time.Millisecond},
+	})
+
+	s := New(log, ":0", status, p, Options{Auth: config.AdminAuthConfig{Mode: "disabled"}})
+	rec := httptest.NewRecorder()
+	s.srv.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://example/api/nodes", nil))
+
+	type quality struct {
+		OKRate  float64 `json:"ok_rate"`
+		Samples int     `json:"samples"`
+	}
+	type node struct {
+		ID        string            `json:"id"`
+		EgressIP  string            `json:"egress_ip"`
+		Country   string            `json:"country"`
+		ASN       uint              `json:"asn"`
+		Anonymity string            `json:"anonymity"`
+		Tainted   bool              `json:"tainted"`
+		Bps       int64             `json:"throughput_bps"`
+		Quality   *quality          `json:"quality"`
+		Labels    map[string]string `json:"labels"`
+	}
+	var parsed struct {
+		Nodes      []node `json:"nodes"`
+		NodesTotal int    `json:"nodes_total"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &parsed); err != nil {
+		t.Fatalf("parse response: %v", err)
+	}
+	if parsed.NodesTotal != 2 {
+		t.Fatalf("expected xray node plus legacy upstream, got %#v", parsed)
+	}
+	byID := map[string]node{}
+	for _, n := range parsed.Nodes {
+		byID[n.ID] = n
+	}
+
+	for _, tc := range []struct {
+		id        string
+		egressIP  string
+		labelType string
+		country   string
+		asn       uint
+		anonymity string
+		tainted   bool
+		bps       int64
+		quality   quality
+	}{
+		{id: "n1", egressIP: "203.0.113.1", labelType: "vless", country: "US", asn: 64500, anonymity: "elite", bps: 2 << 20, quality: quality{OKRate: 0.8, Samples: 1}},
+		{id: "198.51.100.2:1080", egressIP: "198.51.100.2", labelType: "socks5", tainted: true, quality: quality{OKRate: 1}},
+	} {
+		n, ok := byID[tc.id]
+		if !ok {
+			t.Fatalf("%s: missing from %v", tc.id, parsed.Nodes)
+		}
+		if n.EgressIP != tc.egressIP {
+			t.Errorf("%s: egress_ip = %q, want %q", tc.id, n.EgressIP, tc.egressIP)
+		}
+		if n.Labels["type"] != tc.labelType {
+			t.Errorf("%s: labels.type = %q, want %q", tc.id, n.Labels["type"], tc.labelType)
+		}
+		if n.Country != tc.country {
+			t.Errorf("%s: country = %q, want %q", tc.id, n.Country, tc.country)
+		}
+		if n.ASN != tc.asn {
+			t.Errorf("%s: asn = %d, want %d", tc.id, n.ASN, tc.asn)
+		}
+		if n.Anonymity != tc.anonymity {
+			t.Errorf("%s: anonymity = %q, want %q", tc.id, n.Anonymity, tc.anonymity)
+		}
+		if n.Tainted != tc.tainted {
+			t.Errorf("%s: tainted = %v, want %v", tc.id, n.Tainted, tc.tainted)
+		}
+		if n.Bps != tc.bps {
+			t.Errorf("%s: throughput_bps = %d, want %d", tc.id, n.Bps, tc.bps)
+		}
+		if n.Quality == nil {
+			t.Errorf("%s: missing quality", tc.id)
+		} else if *n.Quality != tc.quality {
+			t.Errorf("%s: quality = %+v, want %+v", tc.id, *n.Quality, tc.quality)
+		}
+	}
+}
+
 func TestAdminSSE_ConnectionLimit429(t *testing.T) {
 	log := newTestLogger()
 	status := orchestrator.NewStatus()
@@ -244,3 +438,97 @@ func TestAdminUI_ServesAssets(t *testing.T) {
 		t.Fatalf("expected app.js content")
 	}
 }
+
+func TestAdminSessions_RotateAndDrop(t *testing.T) {
+	log := newTestLogger()
+	p := pool.New("pool", log)
+	p.Update([]pool.Entry{{ID: "n1"}, {ID: "n2"}, {ID: "n3"}})
+	leases := pool.NewLeases(pool.LeaseConfig{TTL: time.Hour})
+	now := time.Now()
+	first, _ := leases.Pick(p, "sess", p.Active(now), nil, false, now)
+
+	s := New(log, ":0", orchestrator.NewStatus(), p, Options{
+		Auth:   config.AdminAuthConfig{Mode: "disabled"},
+		Leases: leases,
+	})
+	do := func(method, target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		s.srv.Handler.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+		return rec
+	}
+
+	rec := do(http.MethodGet, "http://example/api/sessions")
+	var listed struct {
+		Sessions []pool.Lease `json:"sessions"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &listed); err != nil {
+		t.Fatalf("parse response: %v", err)
+	}
+	if len(listed.Sessions) != 1 || listed.Sessions[0].Upstream != first.Key() {
+		t.Fatalf("unexpected sessions: %#v", listed.Sessions)
+	}
+
+	if rec := do(http.MethodGet, "http://example/api/sessions/rotate?session=sess"); rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405 for GET rotate, got %d", rec.Code)
+	}
+	if rec := do(http.MethodPost, "http://example/api/sessions/rotate?session=sess"); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 for rotate, got %d", rec.Code)
+	}
+	if next, _ := leases.Pick(p, "sess", p.Active(now), nil, false, now); next.Key() == first.Key() {
+		t.Fatalf("expected rotation off %q", first.Key())
+	}
+
+	if rec := do(http.MethodPost, "http://example/api/sessions/drop?session=sess"); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 for drop, got %d", rec.Code)
+	}
+	if rec := do(http.MethodPost, "http://example/api/sessions/drop?session=sess"); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown session, got %d", rec.Code)
+	}
+}
+
+func TestAdminSelectExplain(t *testing.T) {
+	log := newTestLogger()
+	p := pool.New("pool", log)
+	p.Update([]pool.Entry{{ID: "n1"}, {ID: "n2"}, {ID: "n3"}})
+	now := time.Now()
+	best, _ := pool.PickRendezvous(p.Active(now), "sess", nil)
+	p.MarkFailure(best.Key(), now, time.Minute, time.Hour)
+	want, _ := pool.PickRendezvous(p.Active(now), "sess", nil)
+
+	s := New(log, ":0", orchestrator.NewStatus(), p, Options{
+		Auth:   config.AdminAuthConfig{Mode: "disabled"},
+		Leases: pool.NewLeases(pool.LeaseConfig{}),
+	})
+
+	rec := httptest.NewRecorder()
+	s.srv.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://example/api/select/explain?session=sess", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var parsed struct {
+		HRWKey     string           `json:"hrw_key"`
+		Candidates []pool.Candidate `json:"candidates"`
+		Pick       struct {
+			Key string `json:"key"`
+		} `json:"pick"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &parsed); err != nil {
+		t.Fatalf("parse response: %v", err)
+	}
+	if parsed.HRWKey != "sess" || len(parsed.Candidates) != 3 {
+		t.Fatalf("unexpected response: %#v", parsed)
+	}
+	top := parsed.Candidates[0]
+	if top.Key != best.Key() || top.Available || top.State != pool.BreakerOpen || top.DisabledUntil.IsZero() {
+		t.Fatalf("expected top-ranked upstream to be reported open: %+v", top)
+	}
+	if parsed.Pick.Key != want.Key() {
+		t.Fatalf("expected pick %q, got %q", want.Key(), parsed.Pick.Key)
+	}
+
+	rec = httptest.NewRecorder()
+	s.srv.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://example/api/select/explain", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 without session, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,99 @@
+package admin
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/CodeBoy2006/EasyProxyPool/internal/pool"
+	"github.com/CodeBoy2006/EasyProxyPool/internal/useropts"
+)
+
+// handleSelectExplain shows how a sticky session maps to upstreams: every
+// upstream of the pool ranked by HRW score with its breaker state, the session's
+// lease and the upstream a request would get right now.
+//
+// Query parameters: session (session key) or user (proxy username, including
+// options), and optionally select (label selector), host (destination), pool
+// (named pool) and mode (relaxed|strict).
+func (s *Server) handleSelectExplain(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	now := time.Now()
+
+	query := pool.Query{Host: strings.TrimSpace(q.Get("host"))}
+	session := strings.TrimSpace(q.Get("session"))
+	if user := strings.TrimSpace(q.Get("user")); user != "" && session == "" {
+		opts, err := useropts.Parse(user)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		session = opts.SessionKey()
+		query.Labels = opts.Labels
+	}
+	if session == "" {
+		http.Error(w, "Missing session", http.StatusBadRequest)
+		return
+	}
+	if v := strings.TrimSpace(q.Get("select")); v != "" {
+		labels, err := pool.ParseLabelSelector(v)
+		if err != nil {
+			http.Error(w, "Invalid select (use key=value[,key=value])", http.StatusBadRequest)
+			return
+		}
+		query.Labels = labels
+	}
+
+	mode := strings.ToLower(strings.TrimSpace(q.Get("mode")))
+	if mode != "strict" {
+		mode = "relaxed"
+	}
+	name := strings.TrimSpace(q.Get("pool"))
+	if name == "" {
+		name = "default"
+	}
+	p := s.poolFor(name, mode)
+	if p == nil {
+		http.Error(w, "Unknown pool", http.StatusNotFound)
+		return
+	}
+
+	pick, ok, key, lease := s.leases.Explain(p, session, p.ActiveFor(query, now), now)
+	resp := map[string]any{
+		"session":         session,
+		"hrw_key":         key,
+		"pool":            name,
+		"mode":            mode,
+		"labels":          query.Labels,
+		"host":            query.Host,
+		"lease":           lease,
+		"candidates":      p.Rank(key, query, now),
+		"server_time_utc": now.UTC().Format(time.RFC3339),
+	}
+	if ok {
+		resp["pick"] = map[string]any{"key": pick.Key(), "addr": pick.Addr}
+	} else {
+		resp["pick"] = nil
+	}
+	writeJSON(w, resp)
+}
+
+// poolFor returns the relaxed or strict pool of the named pool, or nil.
+func (s *Server) poolFor(name, mode string) *pool.Pool {
+	if name == "default" {
+		if mode == "strict" {
+			return s.poolStrict
+		}
+		return s.pool
+	}
+	for _, np := range s.pools {
+		if np.Name != name {
+			continue
+		}
+		if mode == "strict" {
+			return np.StrictPool
+		}
+		return np.Pool
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package admin
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/CodeBoy2006/EasyProxyPool/internal/orchestrator"
+)
+
+// handleNodeHistory reports the per-address health-check history of legacy
+// refreshes: uptime, consecutive failures, backoff and the recent results of
+// ?addr=, or a summary of every address without it.
+//
+// Query parameters: addr (host:port) and optionally pool (named pool).
+func (s *Server) handleNodeHistory(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	name := strings.TrimSpace(q.Get("pool"))
+	if name == "" {
+		name = "default"
+	}
+	st := s.statusFor(name)
+	if st == nil {
+		http.Error(w, "Unknown pool", http.StatusNotFound)
+		return
+	}
+	h := st.History()
+	if h == nil {
+		http.Error(w, "Check history unavailable", http.StatusNotFound)
+		return
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	addr := strings.TrimSpace(q.Get("addr"))
+	if addr == "" {
+		nodes := h.List()
+		writeJSON(w, map[string]any{
+			"pool":            name,
+			"nodes":           nodes,
+			"nodes_total":     len(nodes),
+			"server_time_utc": now,
+		})
+		return
+	}
+	node, ok := h.Get(addr)
+	if !ok {
+		http.Error(w, "Unknown node", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, map[string]any{
+		"pool":            name,
+		"node":            node,
+		"server_time_utc": now,
+	})
+}
+
+// statusFor returns the updater status of the named pool, or nil.
+func (s *Server) statusFor(name string) *orchestrator.Status {
+	if name == "default" {
+		return s.status
+	}
+	for _, np := range s.pools {
+		if np.Name == name {
+			return np.Status
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package admin
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// handleSessions lists the sticky sessions that have a lease or were rotated.
+func (s *Server) handleSessions(w http.ResponseWriter, r *http.Request) {
+	if s.leases == nil {
+		http.Error(w, "Sticky sessions unavailable", http.StatusNotFound)
+		return
+	}
+	sessions := s.leases.List()
+	writeJSON(w, map[string]any{
+		"sessions":        sessions,
+		"sessions_total":  len(sessions),
+		"server_time_utc": time.Now().UTC().Format(time.RFC3339),
+	})
+}
+
+// handleSessionRotate moves ?session= to another upstream on its next connection,
+// in ?pool= only if given.
+func (s *Server) handleSessionRotate(w http.ResponseWriter, r *http.Request) {
+	session, ok := s.sessionParam(w, r)
+	if !ok {
+		return
+	}
+	poolName := strings.TrimSpace(r.URL.Query().Get("pool"))
+	s.leases.Rotate(poolName, session)
+	s.log.Info("sticky session rotated", "session", session, "pool", poolName)
+	writeJSON(w, map[string]any{"session": session, "pool": poolName, "rotated": true})
+}
+
+// handleSessionDrop forgets ?session= (in ?pool= only if given), returning it to
+// its original HRW mapping.
+func (s *Server) handleSessionDrop(w http.ResponseWriter, r *http.Request) {
+	session, ok := s.sessionParam(w, r)
+	if !ok {
+		return
+	}
+	poolName := strings.TrimSpace(r.URL.Query().Get("pool"))
+	if !s.leases.Drop(poolName, session) {
+		http.Error(w, "Unknown session", http.StatusNotFound)
+		return
+	}
+	s.log.Info("sticky session dropped", "session", session, "pool", poolName)
+	writeJSON(w, map[string]any{"session": session, "pool": poolName, "dropped": true})
+}
+
+// sessionParam validates a session mutation request and returns its session key.
+func (s *Server) sessionParam(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return "", false
+	}
+	if s.leases == nil {
+		http.Error(w, "Sticky sessions unavailable", http.StatusNotFound)
+		return "", false
+	}
+	session := strings.TrimSpace(r.URL.Query().Get("session"))
+	if session == "" {
+		http.Error(w, "Missing session", http.StatusBadRequest)
+		return "", false
+	}
+	return session, true
+}
@@ -0,0 +1,116 @@
+// Package dispatch holds what the HTTP and SOCKS5 listeners share to send
+// requests through the pools: routing, tier selection, dialing upstreams and
+// attributing the outcome to the upstream or to the (upstream, destination) pair.
+package dispatch
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/CodeBoy2006/EasyProxyPool/internal/config"
+	"github.com/CodeBoy2006/EasyProxyPool/internal/pool"
+	"github.com/CodeBoy2006/EasyProxyPool/internal/routing"
+)
+
+// Dispatcher is the per-listener state shared by the HTTP and SOCKS5 servers,
+// which embed it.
+type Dispatcher struct {
+	log       *slog.Logger
+	listener  string
+	pool      *pool.Pool
+	auth      config.AuthConfig
+	selection config.SelectionConfig
+
+	router *routing.Router
+	pools  map[string]*pool.Pool
+	tiers  []*pool.Pool
+	leases *pool.Leases
+}
+
+// New returns the dispatcher of listener (see the routing.Listener* names),
+// serving requests from p unless routing rules or tiers say otherwise.
+func New(log *slog.Logger, listener string, p *pool.Pool, auth config.AuthConfig, sel config.SelectionConfig) *Dispatcher {
+	return &Dispatcher{
+		log:       log,
+		listener:  listener,
+		pool:      p,
+		auth:      auth,
+		selection: sel,
+	}
+}
+
+// authenticates reports whether clients of the listener must authenticate, so
+// the username they present is vouched for by the credentials.
+func (d *Dispatcher) authenticates() bool {
+	switch strings.ToLower(strings.TrimSpace(d.auth.Mode)) {
+	case "basic", "shared_password":
+		return true
+	}
+	return false
+}
+
+// SharedPassword reports whether clients pick their own username under
+// auth.mode shared_password, so a bare username can name a sticky session.
+// Under basic auth every client presents the same username.
+func (d *Dispatcher) SharedPassword() bool {
+	return strings.EqualFold(strings.TrimSpace(d.auth.Mode), "shared_password")
+}
+
+func (d *Dispatcher) baseBackoff() time.Duration {
+	return time.Duration(d.selection.FailureBackoffSeconds) * time.Second
+}
+
+func (d *Dispatcher) maxBackoff() time.Duration {
+	return time.Duration(d.selection.MaxBackoffSeconds) * time.Second
+}
+
+// MarkFailure attributes a failed request either to the upstream itself (global
+// breaker and quality score) or, with destination_health enabled, to the
+// (upstream, host) pair when the upstream worked but the destination did not.
+// Requests the client cancelled are not attributed at all.
+func (d *Dispatcher) MarkFailure(p *pool.Pool, key, host string, err error, now time.Time) {
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	if d.selection.DestinationHealth.Enabled && !IsUpstreamFailure(err) {
+		p.MarkDestFailure(key, host, now, d.baseBackoff(), d.maxBackoff())
+		return
+	}
+	p.MarkFailure(key, now, d.baseBackoff(), d.maxBackoff())
+	p.ObserveOutcome(key, pool.Outcome{})
+}
+
+// MarkSuccess closes the upstream's breaker and clears its failures for host.
+func (d *Dispatcher) MarkSuccess(p *pool.Pool, key, host string) {
+	p.MarkSuccess(key, time.Now())
+	if d.selection.DestinationHealth.Enabled {
+		p.MarkDestSuccess(key, host)
+	}
+}
+
+// MarkDestinationStatus records a response from host through key. A status code
+// listed in destination_health.failure_status_codes backs off the (upstream,
+// host) pair; the upstream itself worked either way.
+func (d *Dispatcher) MarkDestinationStatus(p *pool.Pool, key, host string, code int, now time.Time) {
+	if !d.isDestFailureStatus(code) {
+		d.MarkSuccess(p, key, host)
+		return
+	}
+	p.MarkSuccess(key, time.Now())
+	p.MarkDestFailure(key, host, now, d.baseBackoff(), d.maxBackoff())
+}
+
+func (d *Dispatcher) isDestFailureStatus(code int) bool {
+	if !d.selection.DestinationHealth.Enabled {
+		return false
+	}
+	for _, c := range d.selection.DestinationHealth.FailureStatusCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package dispatch
+
+import (
+	"fmt"
+
+	"github.com/CodeBoy2006/EasyProxyPool/internal/pool"
+	"github.com/CodeBoy2006/EasyProxyPool/internal/routing"
+)
+
+// SetRouting enables routing rules. pools maps the pool names used by rules to
+// pools; the listener's own pool serves rules without a pool name.
+func (d *Dispatcher) SetRouting(r *routing.Router, pools map[string]*pool.Pool) {
+	d.router = r
+	d.pools = pools
+}
+
+// SetLeases bounds sticky sessions by the lease table l (TTL, max uses and rotation).
+// Without leases sessions map to upstreams purely by HRW.
+func (d *Dispatcher) SetLeases(l *pool.Leases) {
+	d.leases = l
+}
+
+// Leases returns the lease table set by SetLeases; nil picks purely by HRW.
+func (d *Dispatcher) Leases() *pool.Leases {
+	return d.leases
+}
+
+// SetTiers sets the pools requests fall back through, in order of preference, when
+// no routing rule names a pool. Without tiers the listener's pool is used.
+func (d *Dispatcher) SetTiers(tiers []*pool.Pool) {
+	d.tiers = tiers
+}
+
+// Route evaluates the routing rules for req on the dispatcher's listener.
+// Requests matching no rule are served from the listener's pool. req.User only
+// takes part when the listener authenticates clients; otherwise it is chosen by
+// the client and rules matching on user never apply.
+func (d *Dispatcher) Route(req routing.Request) routing.Decision {
+	req.Listener = d.listener
+	if !d.authenticates() {
+		req.User = ""
+	}
+	dec, ok := d.router.Match(req)
+	if !ok {
+		return routing.Decision{Action: routing.ActionPool}
+	}
+	d.log.Debug("routing rule matched", "rule", dec.Rule, "action", string(dec.Action), "pool", dec.Pool, "labels", dec.Labels, "host", req.Host, "ip", req.IP, "port", req.Port)
+	return dec
+}
+
+// RoutesByIP reports whether routing rules match destination IPs, so listeners
+// should resolve domain requests before calling Route.
+func (d *Dispatcher) RoutesByIP() bool {
+	return d.router.MatchesIP()
+}
+
+// Tiers returns the pools to select from for dec, in order of preference.
+func (d *Dispatcher) Tiers(dec routing.Decision) ([]*pool.Pool, error) {
+	if dec.Pool != "" {
+		p, ok := d.pools[dec.Pool]
+		if !ok || p == nil {
+			return nil, fmt.Errorf("routing rule %s: unknown pool %q", dec.Rule, dec.Pool)
+		}
+		return []*pool.Pool{p}, nil
+	}
+	if len(d.tiers) > 0 {
+		return d.tiers, nil
+	}
+	return []*pool.Pool{d.pool}, nil
+}
+
+// MergeLabels combines rule labels with client-requested ones; rule labels win.
+func MergeLabels(rule, client map[string]string) map[string]string {
+	if len(client) == 0 {
+		return rule
+	}
+	if len(rule) == 0 {
+		return client
+	}
+	out := make(map[string]string, len(rule)+len(client))
+	for k, v := range client {
+		out[k] = v
+	}
+	for k, v := range rule {
+		out[k] = v
+	}
+	return out
+}
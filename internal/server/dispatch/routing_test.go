@@ -0,0 +1,41 @@
+package dispatch
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/CodeBoy2006/EasyProxyPool/internal/config"
+	"github.com/CodeBoy2006/EasyProxyPool/internal/pool"
+	"github.com/CodeBoy2006/EasyProxyPool/internal/routing"
+)
+
+func TestRoute_UserRulesRequireAuthentication(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	router, err := routing.New(config.RoutingConfig{Rules: []config.RoutingRuleConfig{
+		{Name: "tenant", User: []string{"tenantA"}, Action: "pool", Pool: "paid"},
+		{Name: "socks-only", Listener: []string{routing.ListenerSOCKS5Relaxed}, Action: "reject"},
+	}})
+	if err != nil {
+		t.Fatalf("routing: %v", err)
+	}
+	req := routing.Request{Host: "example.com", Port: 443, User: "tenantA"}
+
+	open := New(log, routing.ListenerHTTPRelaxed, pool.New("test", log), config.AuthConfig{Mode: "disabled"}, config.SelectionConfig{})
+	open.SetRouting(router, nil)
+	if d := open.Route(req); d.Rule != "" || d.Action != routing.ActionPool {
+		t.Fatalf("expected user rules not to match without auth, got %+v", d)
+	}
+
+	authed := New(log, routing.ListenerHTTPRelaxed, pool.New("test", log), config.AuthConfig{Mode: "shared_password", Password: "p"}, config.SelectionConfig{})
+	authed.SetRouting(router, nil)
+	if d := authed.Route(req); d.Rule != "tenant" || d.Pool != "paid" {
+		t.Fatalf("expected the tenant rule for an authenticated user, got %+v", d)
+	}
+
+	socks := New(log, routing.ListenerSOCKS5Relaxed, pool.New("test", log), config.AuthConfig{Mode: "disabled"}, config.SelectionConfig{})
+	socks.SetRouting(router, nil)
+	if d := socks.Route(req); d.Rule != "socks-only" {
+		t.Fatalf("expected the listener rule, got %+v", d)
+	}
+}
@@ -0,0 +1,234 @@
+package dispatch
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CodeBoy2006/EasyProxyPool/internal/pool"
+)
+
+// dialTimeout bounds the TCP connection to the upstream and, separately, the
+// SOCKS5 handshake over it.
+const dialTimeout = 30 * time.Second
+
+// SOCKS5 reply codes (RFC 1928 section 6) the upstream uses to report that it
+// could not reach the destination.
+const (
+	replyNetworkUnreachable = 0x03
+	replyHostUnreachable    = 0x04
+	replyConnectionRefused  = 0x05
+)
+
+// UpstreamError is a failure of the upstream proxy itself: it could not be
+// reached, the SOCKS5 handshake or authentication failed, it timed out, or it
+// replied with a failure of its own (e.g. 0x01 general server failure).
+type UpstreamError struct{ Err error }
+
+func (e *UpstreamError) Error() string { return "upstream: " + e.Err.Error() }
+func (e *UpstreamError) Unwrap() error { return e.Err }
+
+// DestinationError is a CONNECT the upstream answered with network unreachable,
+// host unreachable or connection refused: the upstream works but could not reach
+// the destination.
+type DestinationError struct{ Reply byte }
+
+func (e *DestinationError) Error() string { return "destination: " + replyText(e.Reply) }
+
+// IsUpstreamFailure reports whether err is a failure of the upstream itself.
+func IsUpstreamFailure(err error) bool {
+	var ue *UpstreamError
+	return errors.As(err, &ue)
+}
+
+// Dial connects to addr through the SOCKS5 upstream e. Upstream failures are
+// returned as *UpstreamError and destinations the upstream could not reach as
+// *DestinationError; when ctx is cancelled, ctx.Err() is returned as is.
+func Dial(ctx context.Context, e pool.Entry, network, addr string) (net.Conn, error) {
+	if !strings.HasPrefix(network, "tcp") {
+		return nil, fmt.Errorf("socks5: unsupported network %q", network)
+	}
+	d := net.Dialer{Timeout: dialTimeout}
+	conn, err := d.DialContext(ctx, "tcp", e.Addr)
+	if err != nil {
+		return nil, classifyDialErr(ctx, err)
+	}
+
+	// Unblock the handshake when ctx is done.
+	stop := context.AfterFunc(ctx, func() { _ = conn.SetDeadline(time.Unix(1, 0)) })
+	_ = conn.SetDeadline(time.Now().Add(dialTimeout))
+	err = handshake(conn, e.Username, e.Password, addr)
+	if !stop() {
+		err = classifyDialErr(ctx, ctx.Err())
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// classifyDialErr returns ctx.Err() when the caller cancelled ctx, and err as an
+// upstream failure otherwise (including a ctx deadline).
+func classifyDialErr(ctx context.Context, err error) error {
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return ctx.Err()
+	}
+	var de *DestinationError
+	if errors.As(err, &de) {
+		return err
+	}
+	return &UpstreamError{Err: err}
+}
+
+// handshake negotiates authentication and sends a CONNECT for addr over conn.
+func handshake(conn net.Conn, user, password, addr string) error {
+	auth := strings.TrimSpace(user) != "" || strings.TrimSpace(password) != ""
+	greeting := []byte{5, 1, 0x00}
+	if auth {
+		greeting = []byte{5, 2, 0x00, 0x02}
+	}
+	if _, err := conn.Write(greeting); err != nil {
+		return &UpstreamError{Err: err}
+	}
+	var b [4]byte
+	if _, err := io.ReadFull(conn, b[:2]); err != nil {
+		return &UpstreamError{Err: err}
+	}
+	if b[0] != 5 {
+		return &UpstreamError{Err: fmt.Errorf("socks5: unexpected protocol version %d", b[0])}
+	}
+	switch b[1] {
+	case 0x00:
+	case 0x02:
+		if !auth {
+			return &UpstreamError{Err: errors.New("socks5: authentication required")}
+		}
+		if err := authenticate(conn, user, password); err != nil {
+			return &UpstreamError{Err: err}
+		}
+	default:
+		return &UpstreamError{Err: errors.New("socks5: no acceptable authentication methods")}
+	}
+
+	req, err := connectRequest(addr)
+	if err != nil {
+		return err
+	}
+	if _, err := conn.Write(req); err != nil {
+		return &UpstreamError{Err: err}
+	}
+	if _, err := io.ReadFull(conn, b[:4]); err != nil {
+		return &UpstreamError{Err: err}
+	}
+	if b[0] != 5 {
+		return &UpstreamError{Err: fmt.Errorf("socks5: unexpected protocol version %d", b[0])}
+	}
+	switch rep := b[1]; rep {
+	case 0x00:
+	case replyNetworkUnreachable, replyHostUnreachable, replyConnectionRefused:
+		return &DestinationError{Reply: rep}
+	default:
+		return &UpstreamError{Err: errors.New("socks5: " + replyText(rep))}
+	}
+
+	// Skip the bound address.
+	var n int
+	switch b[3] {
+	case 0x01:
+		n = net.IPv4len
+	case 0x04:
+		n = net.IPv6len
+	case 0x03:
+		if _, err := io.ReadFull(conn, b[:1]); err != nil {
+			return &UpstreamError{Err: err}
+		}
+		n = int(b[0])
+	default:
+		return &UpstreamError{Err: fmt.Errorf("socks5: unknown address type %d", b[3])}
+	}
+	if _, err := io.CopyN(io.Discard, conn, int64(n)+2); err != nil {
+		return &UpstreamError{Err: err}
+	}
+	return nil
+}
+
+// authenticate performs username/password authentication (RFC 1929).
+func authenticate(conn net.Conn, user, password string) error {
+	if len(user) > 255 || len(password) > 255 {
+		return errors.New("socks5: username or password too long")
+	}
+	b := make([]byte, 0, 3+len(user)+len(password))
+	b = append(b, 1, byte(len(user)))
+	b = append(b, user...)
+	b = append(b, byte(len(password)))
+	b = append(b, password...)
+	if _, err := conn.Write(b); err != nil {
+		return err
+	}
+	if _, err := io.ReadFull(conn, b[:2]); err != nil {
+		return err
+	}
+	if b[1] != 0x00 {
+		return errors.New("socks5: authentication rejected")
+	}
+	return nil
+}
+
+// connectRequest encodes a CONNECT request for addr (host:port).
+func connectRequest(addr string) ([]byte, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 1 || port > 65535 {
+		return nil, fmt.Errorf("socks5: invalid port %q", portStr)
+	}
+	b := []byte{5, 1, 0}
+	if ip := net.ParseIP(host); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			b = append(b, 0x01)
+			b = append(b, ip4...)
+		} else {
+			b = append(b, 0x04)
+			b = append(b, ip.To16()...)
+		}
+	} else {
+		if len(host) > 255 {
+			return nil, errors.New("socks5: host name too long")
+		}
+		b = append(b, 0x03, byte(len(host)))
+		b = append(b, host...)
+	}
+	return binary.BigEndian.AppendUint16(b, uint16(port)), nil
+}
+
+func replyText(rep byte) string {
+	switch rep {
+	case 0x01:
+		return "general SOCKS server failure"
+	case 0x02:
+		return "connection not allowed by ruleset"
+	case replyNetworkUnreachable:
+		return "network unreachable"
+	case replyHostUnreachable:
+		return "host unreachable"
+	case replyConnectionRefused:
+		return "connection refused"
+	case 0x06:
+		return "TTL expired"
+	case 0x07:
+		return "command not supported"
+	case 0x08:
+		return "address type not supported"
+	}
+	return "unknown reply " + strconv.Itoa(int(rep))
+}
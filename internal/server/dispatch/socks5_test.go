@@ -0,0 +1,169 @@
+package dispatch
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/CodeBoy2006/EasyProxyPool/internal/pool"
+)
+
+// fakeUpstream serves one SOCKS5 handshake per connection: it requires
+// username/password auth when password is set and answers CONNECT with reply.
+func fakeUpstream(t *testing.T, password string, reply byte) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(c net.Conn) {
+				defer c.Close()
+				b := make([]byte, 512)
+				if _, err := io.ReadFull(c, b[:2]); err != nil {
+					return
+				}
+				if _, err := io.ReadFull(c, b[:b[1]]); err != nil {
+					return
+				}
+				if password == "" {
+					_, _ = c.Write([]byte{5, 0x00})
+				} else {
+					_, _ = c.Write([]byte{5, 0x02})
+					if _, err := io.ReadFull(c, b[:2]); err != nil {
+						return
+					}
+					ulen := int(b[1])
+					if _, err := io.ReadFull(c, b[:ulen+1]); err != nil {
+						return
+					}
+					plen := int(b[ulen])
+					if _, err := io.ReadFull(c, b[:plen]); err != nil {
+						return
+					}
+					if string(b[:plen]) != password {
+						_, _ = c.Write([]byte{1, 0x01})
+						return
+					}
+					_, _ = c.Write([]byte{1, 0x00})
+				}
+				// CONNECT to an IPv4 address: 4 header bytes, 4 address bytes, port.
+				if _, err := io.ReadFull(c, b[:10]); err != nil {
+					return
+				}
+				_, _ = c.Write([]byte{5, reply, 0, 1, 127, 0, 0, 1, 0, 80})
+				if reply == 0 {
+					_, _ = c.Write([]byte("hello"))
+				}
+			}(c)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestDial_ClassifiesFailures(t *testing.T) {
+	ctx := context.Background()
+	dial := func(addr, password string) error {
+		c, err := Dial(ctx, pool.Entry{Addr: addr, Username: "u", Password: password}, "tcp", "10.0.0.1:80")
+		if err == nil {
+			_ = c.Close()
+		}
+		return err
+	}
+
+	for _, tc := range []struct {
+		name     string
+		password string
+		reply    byte
+		upstream bool
+	}{
+		{name: "general failure", reply: 0x01, upstream: true},
+		{name: "not allowed", reply: 0x02, upstream: true},
+		{name: "network unreachable", reply: 0x03},
+		{name: "host unreachable", reply: 0x04},
+		{name: "connection refused", reply: 0x05},
+		{name: "auth rejected", password: "secret", reply: 0x00, upstream: true},
+	} {
+		addr := fakeUpstream(t, tc.password, tc.reply)
+		err := dial(addr, "wrong")
+		if tc.password == "" {
+			err = dial(addr, "")
+		}
+		if err == nil {
+			t.Fatalf("%s: expected an error", tc.name)
+		}
+		if got := IsUpstreamFailure(err); got != tc.upstream {
+			t.Fatalf("%s: expected upstream failure=%v, got %v (%v)", tc.name, tc.upstream, got, err)
+		}
+		var de *DestinationError
+		if !tc.upstream && (!errors.As(err, &de) || de.Reply != tc.reply) {
+			t.Fatalf("%s: expected a destination error with reply %d, got %v", tc.name, tc.reply, err)
+		}
+	}
+
+	// Unreachable upstreams and garbage handshakes are upstream failures.
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	closed := ln.Addr().String()
+	_ = ln.Close()
+	if err := dial(closed, ""); !IsUpstreamFailure(err) {
+		t.Fatalf("expected an unreachable upstream to be an upstream failure, got %v", err)
+	}
+	garbage, _ := net.Listen("tcp", "127.0.0.1:0")
+	defer garbage.Close()
+	go func() {
+		c, err := garbage.Accept()
+		if err == nil {
+			_, _ = c.Write([]byte("HTTP/1.1 400 Bad Request\r\n\r\n"))
+			_ = c.Close()
+		}
+	}()
+	if err := dial(garbage.Addr().String(), ""); !IsUpstreamFailure(err) {
+		t.Fatalf("expected a handshake error to be an upstream failure, got %v", err)
+	}
+}
+
+func TestDial_Succeeds(t *testing.T) {
+	addr := fakeUpstream(t, "secret", 0x00)
+	c, err := Dial(context.Background(), pool.Entry{Addr: addr, Username: "u", Password: "secret"}, "tcp", "10.0.0.1:80")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer c.Close()
+	_ = c.SetReadDeadline(time.Now().Add(time.Second))
+	b := make([]byte, 5)
+	if _, err := io.ReadFull(c, b); err != nil || string(b) != "hello" {
+		t.Fatalf("expected the tunneled bytes, got %q %v", b, err)
+	}
+}
+
+func TestDial_CancelledIsNotAttributed(t *testing.T) {
+	// An upstream that accepts but never answers the greeting.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		c, err := ln.Accept()
+		if err == nil {
+			defer c.Close()
+			_, _ = io.Copy(io.Discard, c)
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	_, err = Dial(ctx, pool.Entry{Addr: ln.Addr().String()}, "tcp", "10.0.0.1:80")
+	if !errors.Is(err, context.Canceled) || IsUpstreamFailure(err) {
+		t.Fatalf("expected the cancellation as is, got %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package dispatch
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/CodeBoy2006/EasyProxyPool/internal/pool"
+)
+
+// TunnelConn is the upstream side of a tunnel. It times the first byte read from
+// the upstream and, when closed, releases the upstream's in-flight slot and feeds
+// the tunnel into its quality score.
+//
+// Only upstream faults count as failures: a read error, or the upstream closing
+// before its first byte while the client is still connected. A tunnel the client
+// gives up on before the first byte is not scored.
+type TunnelConn struct {
+	net.Conn
+
+	pool    *pool.Pool
+	key     string
+	release func()
+	start   time.Time
+
+	// firstByte is the time from start to the first byte read plus one; 0 until then.
+	firstByte  atomic.Int64
+	readFailed atomic.Bool
+	clientDone atomic.Bool
+	closing    atomic.Bool
+	once       sync.Once
+}
+
+// NewTunnelConn tracks c, a connection to key in p. release frees the in-flight
+// slot reserved for it.
+func NewTunnelConn(c net.Conn, p *pool.Pool, key string, release func()) *TunnelConn {
+	return &TunnelConn{Conn: c, pool: p, key: key, release: release, start: time.Now()}
+}
+
+func (c *TunnelConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 && c.firstByte.Load() == 0 {
+		c.firstByte.CompareAndSwap(0, int64(time.Since(c.start))+1)
+	}
+	if err != nil && err != io.EOF && !c.closing.Load() && !errors.Is(err, net.ErrClosed) {
+		c.readFailed.Store(true)
+	}
+	return n, err
+}
+
+// ClientDone records that the client stopped sending, so an upstream that has not
+// answered yet is not blamed when the tunnel is closed.
+func (c *TunnelConn) ClientDone() {
+	c.clientDone.Store(true)
+}
+
+// CloseWrite records that the client stopped sending and half-closes the
+// upstream connection when it supports that.
+func (c *TunnelConn) CloseWrite() error {
+	c.ClientDone()
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
+
+func (c *TunnelConn) Close() error {
+	c.closing.Store(true)
+	err := c.Conn.Close()
+	c.once.Do(func() {
+		c.release()
+		lifetime := time.Since(c.start)
+		ttfb := time.Duration(c.firstByte.Load())
+		if ttfb > 0 {
+			ttfb--
+		}
+		switch {
+		case c.readFailed.Load():
+			c.pool.ObserveOutcome(c.key, pool.Outcome{TTFB: ttfb, Lifetime: lifetime})
+		case ttfb > 0:
+			c.pool.ObserveOutcome(c.key, pool.Outcome{OK: true, TTFB: ttfb, Lifetime: lifetime})
+		case !c.clientDone.Load():
+			c.pool.ObserveOutcome(c.key, pool.Outcome{Lifetime: lifetime})
+		}
+	})
+	return err
+}
@@ -0,0 +1,81 @@
+package dispatch
+
+import (
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+
+	"github.com/CodeBoy2006/EasyProxyPool/internal/pool"
+)
+
+func TestTunnelConn_ScoresOnlyUpstreamFaults(t *testing.T) {
+	cases := []struct {
+		name string
+		// run drives the tunnel: upstream is the far end of the tracked conn.
+		run         func(tc *TunnelConn, upstream net.Conn)
+		wantSamples int
+		wantOK      bool
+	}{
+		{
+			name: "upstream answers",
+			run: func(tc *TunnelConn, upstream net.Conn) {
+				go func() { _, _ = upstream.Write([]byte("x")) }()
+				_, _ = tc.Read(make([]byte, 1))
+			},
+			wantSamples: 1,
+			wantOK:      true,
+		},
+		{
+			name: "upstream closes before the first byte",
+			run: func(tc *TunnelConn, upstream net.Conn) {
+				_ = upstream.Close()
+				_, _ = io.Copy(io.Discard, tc)
+			},
+			wantSamples: 1,
+		},
+		{
+			name: "client gives up first",
+			run: func(tc *TunnelConn, upstream net.Conn) {
+				_ = tc.CloseWrite()
+			},
+		},
+		{
+			name: "tunnel closed while reading",
+			run: func(tc *TunnelConn, upstream net.Conn) {
+				tc.ClientDone()
+				done := make(chan struct{})
+				go func() {
+					_, _ = tc.Read(make([]byte, 1))
+					close(done)
+				}()
+				_ = tc.Close()
+				<-done
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			p := pool.New("test", slog.New(slog.NewTextHandler(io.Discard, nil)))
+			p.Update([]pool.Entry{{Addr: "a:1080"}})
+			local, upstream := net.Pipe()
+			defer upstream.Close()
+			released := false
+			tc := NewTunnelConn(local, p, "a:1080", func() { released = true })
+
+			c.run(tc, upstream)
+			_ = tc.Close()
+
+			if !released {
+				t.Fatalf("expected the in-flight slot to be released")
+			}
+			okRate, _, _, samples := p.Entries()[0].QualityStats()
+			if samples != c.wantSamples {
+				t.Fatalf("expected %d scored outcomes, got %d", c.wantSamples, samples)
+			}
+			if samples > 0 && (okRate == 1) != c.wantOK {
+				t.Fatalf("expected ok=%v, got ok rate %v", c.wantOK, okRate)
+			}
+		})
+	}
+}
@@ -16,7 +16,9 @@ import (
 
 	"github.com/CodeBoy2006/EasyProxyPool/internal/config"
 	"github.com/CodeBoy2006/EasyProxyPool/internal/pool"
-	"golang.org/x/net/proxy"
+	"github.com/CodeBoy2006/EasyProxyPool/internal/routing"
+	"github.com/CodeBoy2006/EasyProxyPool/internal/server/dispatch"
+	"github.com/CodeBoy2006/EasyProxyPool/internal/useropts"
 )
 
 type Mode string
@@ -27,15 +29,18 @@ const (
 )
 
 type Server struct {
+	// Dispatcher holds routing, tiers and leases (SetRouting, SetTiers, SetLeases).
+	*dispatch.Dispatcher
+
 	log *slog.Logger
 
 	addr      string
 	mode      Mode
-	pool      *pool.Pool
 	auth      config.AuthConfig
 	selection config.SelectionConfig
 
-	client *http.Client
+	client       *http.Client
+	directClient *http.Client
 
 	srv *http.Server
 }
@@ -43,13 +48,18 @@ type Server struct {
 type upstreamContextKey struct{}
 
 func New(log *slog.Logger, addr string, mode Mode, p *pool.Pool, auth config.AuthConfig, sel config.SelectionConfig) *Server {
+	log = log.With("component", "http", "mode", string(mode))
+	listener := routing.ListenerHTTPRelaxed
+	if mode == ModeStrict {
+		listener = routing.ListenerHTTPStrict
+	}
 	s := &Server{
-		log:       log.With("component", "http", "mode", string(mode)),
-		addr:      addr,
-		mode:      mode,
-		pool:      p,
-		auth:      auth,
-		selection: sel,
+		Dispatcher: dispatch.New(log, listener, p, auth, sel),
+		log:        log,
+		addr:       addr,
+		mode:       mode,
+		auth:       auth,
+		selection:  sel,
 	}
 
 	transport := &http.Transport{
@@ -59,7 +69,7 @@ func New(log *slog.Logger, addr string, mode Mode, p *pool.Pool, auth config.Aut
 			if strings.TrimSpace(upstream.Addr) == "" {
 				return nil, errors.New("missing upstream in context")
 			}
-			return dialThroughSOCKS5(ctx, upstream, network, addr)
+			return dispatch.Dial(ctx, upstream, network, addr)
 		},
 		ForceAttemptHTTP2: true,
 		TLSClientConfig: &tls.Config{
@@ -76,6 +86,22 @@ func New(log *slog.Logger, addr string, mode Mode, p *pool.Pool, auth config.Aut
 		},
 	}
 
+	s.directClient = &http.Client{
+		Transport: &http.Transport{
+			Proxy:             nil,
+			DialContext:       (&net.Dialer{Timeout: 30 * time.Second}).DialContext,
+			ForceAttemptHTTP2: true,
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: mode == ModeRelaxed,
+			},
+			TLSHandshakeTimeout:   10 * time.Second,
+			ResponseHeaderTimeout: 30 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
 	s.srv = &http.Server{
 		Addr:    addr,
 		Handler: http.HandlerFunc(s.handle),
@@ -143,7 +169,7 @@ func (s *Server) authorizeHTTP(w http.ResponseWriter, r *http.Request) bool {
 	case "basic":
 		v := r.Header.Get("Proxy-Authorization")
 		user, pass, ok := parseBasicAuth(v)
-		if !ok || user != s.auth.Username || pass != s.auth.Password {
+		if !ok || !matchUser(user, s.auth.Username) || pass != s.auth.Password {
 			w.Header().Set("Proxy-Authenticate", `Basic realm="EasyProxyPool"`)
 			http.Error(w, "Proxy authentication required", http.StatusProxyAuthRequired)
 			return false
@@ -165,6 +191,16 @@ func (s *Server) authorizeHTTP(w http.ResponseWriter, r *http.Request) bool {
 	}
 }
 
+// matchUser reports whether the proxy username is the configured one, possibly
+// followed by username options.
+func matchUser(user, want string) bool {
+	if user == want {
+		return true
+	}
+	opts, err := useropts.Parse(user)
+	return err == nil && opts.User == want
+}
+
 func parseBasicAuth(v string) (string, string, bool) {
 	const prefix = "Basic "
 	if !strings.HasPrefix(v, prefix) {
@@ -199,6 +235,22 @@ func (s *Server) handleConnect(w http.ResponseWriter, r *http.Request) error {
 		stickyEnabled = *policy.forceSticky && strings.TrimSpace(policy.sessionKey) != ""
 	}
 
+	target := r.Host
+	if !strings.Contains(target, ":") {
+		target += ":443"
+	}
+
+	route := s.route(r, target)
+	if route.Action == routing.ActionReject {
+		http.Error(w, "Blocked by routing rule", http.StatusForbidden)
+		return fmt.Errorf("rejected by routing rule %s", route.Rule)
+	}
+	tiers, err := s.Tiers(route)
+	if err != nil {
+		http.Error(w, "No available proxies", http.StatusServiceUnavailable)
+		return err
+	}
+
 	clientConn, _, err := hj.Hijack()
 	if err != nil {
 		http.Error(w, "Hijack failed", http.StatusInternalServerError)
@@ -206,65 +258,51 @@ func (s *Server) handleConnect(w http.ResponseWriter, r *http.Request) error {
 	}
 	defer clientConn.Close()
 
-	target := r.Host
-	if !strings.Contains(target, ":") {
-		target += ":443"
+	if route.Action == routing.ActionDirect {
+		var d net.Dialer
+		upstreamConn, err := d.DialContext(r.Context(), "tcp", target)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("CONNECT failed: %v", err), http.StatusBadGateway)
+			return err
+		}
+		_, _ = clientConn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n"))
+		tunnel(clientConn, upstreamConn)
+		return nil
 	}
 
+	query := pool.Query{Host: target, Labels: dispatch.MergeLabels(route.Labels, policy.labels)}
+
 	attempted := map[string]struct{}{}
 
 	var lastErr error
 	for attempt := 0; attempt <= s.selection.Retries; attempt++ {
 		now := time.Now()
-		var entry pool.Entry
-		var ok bool
-		if strings.TrimSpace(policy.forceKey) != "" {
-			entry, ok = s.pool.Get(policy.forceKey, now)
-			if !ok {
-				http.Error(w, "Unknown upstream", http.StatusBadRequest)
-				return errors.New("unknown upstream")
-			}
-		} else if stickyEnabled {
-			candidates := s.pool.Active(now)
-			var exclude map[string]struct{}
-			if policy.failover == "soft" {
-				exclude = attempted
-			}
-			entry, ok = pickRendezvous(candidates, policy.sessionKey, exclude)
-		} else {
-			entry, ok = s.pool.Next(s.selection.Strategy, now)
+		p, entry, release, err := s.pick(tiers, policy, stickyEnabled, query, attempted, now)
+		policy.rotate = false
+		if errors.Is(err, errUnknownUpstream) {
+			http.Error(w, "Unknown upstream", http.StatusBadRequest)
+			return err
 		}
-		if !ok {
+		if err != nil {
 			http.Error(w, "No available proxies", http.StatusServiceUnavailable)
-			return errors.New("no upstreams available")
+			return err
 		}
 
-		upstreamConn, err := dialThroughSOCKS5(r.Context(), entry, "tcp", target)
+		upstreamConn, err := dispatch.Dial(r.Context(), entry, "tcp", target)
 		if err != nil {
+			release()
 			lastErr = err
-			s.pool.MarkFailure(entry.Key(), now, time.Duration(s.selection.FailureBackoffSeconds)*time.Second, time.Duration(s.selection.MaxBackoffSeconds)*time.Second)
+			s.MarkFailure(p, entry.Key(), query.Host, err, now)
 			if stickyEnabled && policy.failover == "soft" && strings.TrimSpace(policy.forceKey) == "" {
 				attempted[entry.Key()] = struct{}{}
 			}
 			continue
 		}
-		s.pool.MarkSuccess(entry.Key())
+		s.MarkSuccess(p, entry.Key(), query.Host)
+		p.ObserveLatency(entry.Key(), time.Since(now))
 
 		_, _ = clientConn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n"))
-
-		errc := make(chan error, 2)
-		go func() {
-			_, err := io.Copy(upstreamConn, clientConn)
-			errc <- err
-		}()
-		go func() {
-			_, err := io.Copy(clientConn, upstreamConn)
-			errc <- err
-		}()
-
-		<-errc
-		_ = upstreamConn.Close()
-		<-errc
+		tunnel(clientConn, dispatch.NewTunnelConn(upstreamConn, p, entry.Key(), release))
 		return nil
 	}
 
@@ -272,6 +310,27 @@ func (s *Server) handleConnect(w http.ResponseWriter, r *http.Request) error {
 	return lastErr
 }
 
+// tunnel copies bytes in both directions until one side is done, then closes
+// upstreamConn (which scores the tunnel for a *dispatch.TunnelConn).
+func tunnel(clientConn, upstreamConn net.Conn) {
+	errc := make(chan error, 2)
+	go func() {
+		_, err := io.Copy(upstreamConn, clientConn)
+		if tc, ok := upstreamConn.(*dispatch.TunnelConn); ok {
+			tc.ClientDone()
+		}
+		errc <- err
+	}()
+	go func() {
+		_, err := io.Copy(clientConn, upstreamConn)
+		errc <- err
+	}()
+
+	<-errc
+	_ = upstreamConn.Close()
+	<-errc
+}
+
 func (s *Server) handleForward(w http.ResponseWriter, r *http.Request) (int, error) {
 	outReq, err := buildForwardRequest(r)
 	if err != nil {
@@ -295,42 +354,56 @@ func (s *Server) handleForward(w http.ResponseWriter, r *http.Request) (int, err
 	outReq.Header.Del(headerFailover)
 	outReq.Header.Del(headerUpstream)
 	outReq.Header.Del(headerSession)
+	outReq.Header.Del(headerSelect)
+	outReq.Header.Del(headerRotate)
+	outReq.Header.Del(headerCountry)
+
+	route := s.route(r, hostWithDefaultPort(outReq.URL))
+	if route.Action == routing.ActionReject {
+		http.Error(w, "Blocked by routing rule", http.StatusForbidden)
+		return http.StatusForbidden, fmt.Errorf("rejected by routing rule %s", route.Rule)
+	}
+	if route.Action == routing.ActionDirect {
+		resp, err := s.directClient.Do(outReq)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Proxy request failed: %v", err), http.StatusBadGateway)
+			return http.StatusBadGateway, err
+		}
+		defer resp.Body.Close()
+		writeResponse(w, resp)
+		return resp.StatusCode, nil
+	}
+	tiers, err := s.Tiers(route)
+	if err != nil {
+		http.Error(w, "No available proxies", http.StatusServiceUnavailable)
+		return http.StatusServiceUnavailable, err
+	}
 
 	retryable := isRetryableRequest(outReq, s.selection.RetryNonIdempotent)
 	var lastErr error
+	query := pool.Query{Host: outReq.URL.Host, Labels: dispatch.MergeLabels(route.Labels, policy.labels)}
 
 	attempted := map[string]struct{}{}
 
 	for attempt := 0; attempt <= s.selection.Retries; attempt++ {
 		now := time.Now()
-		var entry pool.Entry
-		var ok bool
-		if strings.TrimSpace(policy.forceKey) != "" {
-			entry, ok = s.pool.Get(policy.forceKey, now)
-			if !ok {
-				http.Error(w, "Unknown upstream", http.StatusBadRequest)
-				return http.StatusBadRequest, errors.New("unknown upstream")
-			}
-		} else if stickyEnabled {
-			candidates := s.pool.Active(now)
-			var exclude map[string]struct{}
-			if policy.failover == "soft" {
-				exclude = attempted
-			}
-			entry, ok = pickRendezvous(candidates, policy.sessionKey, exclude)
-		} else {
-			entry, ok = s.pool.Next(s.selection.Strategy, now)
+		p, entry, release, err := s.pick(tiers, policy, stickyEnabled, query, attempted, now)
+		policy.rotate = false
+		if errors.Is(err, errUnknownUpstream) {
+			http.Error(w, "Unknown upstream", http.StatusBadRequest)
+			return http.StatusBadRequest, err
 		}
-		if !ok {
+		if err != nil {
 			http.Error(w, "No available proxies", http.StatusServiceUnavailable)
-			return http.StatusServiceUnavailable, errors.New("no upstreams available")
+			return http.StatusServiceUnavailable, err
 		}
 
 		attemptReq := outReq.Clone(context.WithValue(outReq.Context(), upstreamContextKey{}, entry))
 		resp, err := s.client.Do(attemptReq)
 		if err != nil {
+			release()
 			lastErr = err
-			s.pool.MarkFailure(entry.Key(), now, time.Duration(s.selection.FailureBackoffSeconds)*time.Second, time.Duration(s.selection.MaxBackoffSeconds)*time.Second)
+			s.MarkFailure(p, entry.Key(), query.Host, err, now)
 			if stickyEnabled && policy.failover == "soft" && strings.TrimSpace(policy.forceKey) == "" {
 				attempted[entry.Key()] = struct{}{}
 			}
@@ -340,13 +413,14 @@ func (s *Server) handleForward(w http.ResponseWriter, r *http.Request) (int, err
 			http.Error(w, fmt.Sprintf("Proxy request failed: %v", err), http.StatusBadGateway)
 			return http.StatusBadGateway, err
 		}
+		defer release()
 		defer resp.Body.Close()
-		s.pool.MarkSuccess(entry.Key())
+		s.MarkDestinationStatus(p, entry.Key(), query.Host, resp.StatusCode, now)
+		ttfb := time.Since(now)
+		p.ObserveLatency(entry.Key(), ttfb)
+		p.ObserveOutcome(entry.Key(), pool.Outcome{OK: true, TTFB: ttfb})
 
-		stripHopByHopHeaders(resp.Header)
-		copyHeader(w.Header(), resp.Header)
-		w.WriteHeader(resp.StatusCode)
-		_, _ = io.Copy(w, resp.Body)
+		writeResponse(w, resp)
 		return resp.StatusCode, nil
 	}
 
@@ -354,32 +428,11 @@ func (s *Server) handleForward(w http.ResponseWriter, r *http.Request) (int, err
 	return http.StatusBadGateway, lastErr
 }
 
-func dialThroughSOCKS5(ctx context.Context, upstream pool.Entry, network, addr string) (net.Conn, error) {
-	var auth *proxy.Auth
-	if strings.TrimSpace(upstream.Username) != "" || strings.TrimSpace(upstream.Password) != "" {
-		auth = &proxy.Auth{User: upstream.Username, Password: upstream.Password}
-	}
-	dialer, err := proxy.SOCKS5("tcp", upstream.Addr, auth, proxy.Direct)
-	if err != nil {
-		return nil, err
-	}
-
-	type result struct {
-		conn net.Conn
-		err  error
-	}
-	done := make(chan result, 1)
-	go func() {
-		c, err := dialer.Dial(network, addr)
-		done <- result{conn: c, err: err}
-	}()
-
-	select {
-	case res := <-done:
-		return res.conn, res.err
-	case <-ctx.Done():
-		return nil, ctx.Err()
-	}
+func writeResponse(w http.ResponseWriter, resp *http.Response) {
+	stripHopByHopHeaders(resp.Header)
+	copyHeader(w.Header(), resp.Header)
+	w.WriteHeader(resp.StatusCode)
+	_, _ = io.Copy(w, resp.Body)
 }
 
 func isRetryableRequest(r *http.Request, retryNonIdempotent bool) bool {
@@ -0,0 +1,109 @@
+package httpproxy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CodeBoy2006/EasyProxyPool/internal/pool"
+	"github.com/CodeBoy2006/EasyProxyPool/internal/routing"
+)
+
+// route evaluates the routing rules for a request to hostport. Requests matching
+// no rule are served from the listener's pool. When rules match on cidr, a domain
+// host is resolved locally like the SOCKS5 listener does, so cidr rules also apply
+// to domain requests; if resolution fails only the domain takes part.
+func (s *Server) route(r *http.Request, hostport string) routing.Decision {
+	host, portStr, err := net.SplitHostPort(hostport)
+	if err != nil {
+		host = hostport
+	}
+	port, _ := strconv.Atoi(portStr)
+	opts, _ := proxyUser(r)
+
+	req := routing.Request{
+		Host: host,
+		Port: port,
+		User: opts.User,
+	}
+	if s.RoutesByIP() && net.ParseIP(host) == nil {
+		req.IP = s.resolve(r.Context(), host)
+	}
+	return s.Route(req)
+}
+
+// resolveTimeout bounds the local lookup of a domain for cidr rules.
+const resolveTimeout = 5 * time.Second
+
+// resolve looks up host, preferring an IPv4 address as net.ResolveIPAddr (used
+// by the SOCKS5 listener) does. It returns nil when the lookup fails.
+func (s *Server) resolve(ctx context.Context, host string) net.IP {
+	ctx, cancel := context.WithTimeout(ctx, resolveTimeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil || len(addrs) == 0 {
+		s.log.Debug("routing: resolve failed; cidr rules do not match", "host", host, "err", err)
+		return nil
+	}
+	for _, a := range addrs {
+		if ip4 := a.IP.To4(); ip4 != nil {
+			return ip4
+		}
+	}
+	return addrs[0].IP
+}
+
+var (
+	errUnknownUpstream = errors.New("unknown upstream")
+	errNoUpstreams     = errors.New("no upstreams available")
+)
+
+// pick selects an upstream from the first tier that has one available for the
+// request, honoring a forced upstream key and sticky sessions. The connection is
+// recorded as in flight; release must be called when it ends.
+func (s *Server) pick(tiers []*pool.Pool, policy requestStickyPolicy, sticky bool, q pool.Query, attempted map[string]struct{}, now time.Time) (*pool.Pool, pool.Entry, func(), error) {
+	forceKey := strings.TrimSpace(policy.forceKey)
+	for _, p := range tiers {
+		var entry pool.Entry
+		var release func()
+		var ok bool
+		if forceKey != "" {
+			entry, release, ok = p.AcquireKey(forceKey, now)
+		} else if sticky {
+			var exclude map[string]struct{}
+			if policy.failover == "soft" {
+				exclude = attempted
+			}
+			entry, ok = s.Leases().Pick(p, policy.sessionKey, p.ActiveFor(q, now), exclude, policy.rotate, now)
+			policy.rotate = false
+			if ok {
+				entry, release, ok = p.AcquireKey(entry.Key(), now)
+			}
+		} else {
+			entry, release, ok = p.AcquireNext(s.selection.Strategy, q, now)
+		}
+		if ok {
+			return p, entry, release, nil
+		}
+	}
+	if forceKey != "" {
+		return nil, pool.Entry{}, nil, errUnknownUpstream
+	}
+	return nil, pool.Entry{}, nil, errNoUpstreams
+}
+
+func hostWithDefaultPort(u *url.URL) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	port := "80"
+	if strings.EqualFold(u.Scheme, "https") {
+		port = "443"
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
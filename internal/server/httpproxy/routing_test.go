@@ -0,0 +1,86 @@
+package httpproxy
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/CodeBoy2006/EasyProxyPool/internal/config"
+	"github.com/CodeBoy2006/EasyProxyPool/internal/pool"
+	"github.com/CodeBoy2006/EasyProxyPool/internal/routing"
+)
+
+func TestHandleForward_RoutingDirectAndReject(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "direct-ok")
+	}))
+	defer backend.Close()
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	router, err := routing.New(config.RoutingConfig{Rules: []config.RoutingRuleConfig{
+		{Name: "loopback", CIDR: []string{"127.0.0.0/8"}, Action: "direct"},
+		{Name: "blocked", DomainSuffix: []string{"blocked.example"}, Action: "reject"},
+	}})
+	if err != nil {
+		t.Fatalf("routing: %v", err)
+	}
+	// The pool is empty, so anything not routed direct would fail with 503.
+	s := New(log, ":0", ModeRelaxed, pool.New("test", log), config.AuthConfig{Mode: "disabled"}, config.SelectionConfig{Strategy: "round_robin"})
+	s.SetRouting(router, nil)
+
+	rec := httptest.NewRecorder()
+	s.srv.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, backend.URL+"/", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "direct-ok" {
+		t.Fatalf("expected direct response, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	// Domains are resolved for cidr rules, as on the SOCKS5 listener.
+	u, _ := url.Parse(backend.URL)
+	rec = httptest.NewRecorder()
+	s.srv.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://localhost:"+u.Port()+"/", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "direct-ok" {
+		t.Fatalf("expected localhost to match the loopback cidr, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	s.srv.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://www.blocked.example/", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for rejected host, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	s.srv.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://other.example/", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 for unrouted host with empty pool, got %d", rec.Code)
+	}
+}
+
+func TestPick_FallsBackThroughTiers(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	free := pool.New("free", log)
+	paid := pool.New("paid", log)
+	paid.Update([]pool.Entry{{Addr: "2.2.2.2:1080"}})
+
+	s := New(log, ":0", ModeRelaxed, free, config.AuthConfig{Mode: "disabled"}, config.SelectionConfig{Strategy: "round_robin"})
+	s.SetTiers([]*pool.Pool{free, paid})
+
+	tiers, err := s.Tiers(routing.Decision{Action: routing.ActionPool})
+	if err != nil {
+		t.Fatalf("Tiers: %v", err)
+	}
+	now := time.Now()
+	p, e, _, err := s.pick(tiers, requestStickyPolicy{}, false, pool.Query{}, nil, now)
+	if err != nil || p != paid || e.Addr != "2.2.2.2:1080" {
+		t.Fatalf("expected fallback to paid tier, got %v %v %v", p, e, err)
+	}
+
+	free.Update([]pool.Entry{{Addr: "1.1.1.1:1080"}})
+	p, e, _, err = s.pick(tiers, requestStickyPolicy{}, false, pool.Query{}, nil, now)
+	if err != nil || p != free || e.Addr != "1.1.1.1:1080" {
+		t.Fatalf("expected first tier once it has upstreams, got %v %v %v", p, e, err)
+	}
+}
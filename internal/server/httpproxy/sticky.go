@@ -7,6 +7,9 @@ import (
 
 	"github.com/CodeBoy2006/EasyProxyPool/internal/config"
 	"github.com/CodeBoy2006/EasyProxyPool/internal/pool"
+	"github.com/CodeBoy2006/EasyProxyPool/internal/server/dispatch"
+	"github.com/CodeBoy2006/EasyProxyPool/internal/upstream"
+	"github.com/CodeBoy2006/EasyProxyPool/internal/useropts"
 )
 
 const (
@@ -14,6 +17,9 @@ const (
 	headerFailover    = "X-EasyProxyPool-Failover"
 	headerUpstream    = "X-EasyProxyPool-Upstream"
 	headerSession     = "X-EasyProxyPool-Session"
+	headerSelect      = "X-EasyProxyPool-Select"
+	headerRotate      = "X-EasyProxyPool-Rotate"
+	headerCountry     = "X-EasyProxyPool-Country"
 	headerTraceparent = "traceparent"
 )
 
@@ -22,6 +28,11 @@ type requestStickyPolicy struct {
 	forceSticky *bool
 	failover    string
 	forceKey    string
+	// rotate moves the session to another upstream before picking.
+	rotate bool
+
+	// labels restricts selection to upstreams carrying these labels.
+	labels map[string]string
 }
 
 func parseTraceIDFromTraceparent(v string) (string, bool) {
@@ -71,16 +82,22 @@ func parseBoolLike(v string) (bool, bool) {
 	}
 }
 
-func sessionKeyFromRequest(allowHeaderOverride bool, r *http.Request) string {
+// proxyUser returns the Proxy-Authorization username split into the user and the
+// options encoded in it (see package useropts).
+func proxyUser(r *http.Request) (useropts.Options, error) {
+	user, _, _ := parseBasicAuth(r.Header.Get("Proxy-Authorization"))
+	return useropts.Parse(user)
+}
+
+func sessionKeyFromRequest(allowHeaderOverride bool, r *http.Request, opts useropts.Options) string {
 	if allowHeaderOverride {
 		if v := strings.TrimSpace(r.Header.Get(headerSession)); v != "" {
 			return v
 		}
 	}
 
-	user, _, ok := parseBasicAuth(r.Header.Get("Proxy-Authorization"))
-	if ok && strings.TrimSpace(user) != "" {
-		return user
+	if key := strings.TrimSpace(opts.SessionKey()); key != "" {
+		return key
 	}
 
 	if traceID, ok := parseTraceIDFromTraceparent(r.Header.Get(headerTraceparent)); ok {
@@ -90,13 +107,27 @@ func sessionKeyFromRequest(allowHeaderOverride bool, r *http.Request) string {
 	return ""
 }
 
+// stickyPolicyFromRequest builds the per-request policy from the configuration,
+// the options encoded in the proxy username and the X-EasyProxyPool-* headers,
+// in increasing order of precedence.
 func stickyPolicyFromRequest(sel config.SelectionConfig, r *http.Request) (requestStickyPolicy, error) {
 	p := requestStickyPolicy{
 		failover: sel.Sticky.Failover,
 	}
 
+	opts, err := proxyUser(r)
+	if err != nil {
+		return requestStickyPolicy{}, err
+	}
+	p.labels = opts.Labels
+
 	headerOverride := sel.Sticky.HeaderOverride == nil || *sel.Sticky.HeaderOverride
 	if headerOverride {
+		p.forceSticky = opts.Sticky
+		if opts.Failover != "" {
+			p.failover = opts.Failover
+		}
+
 		if v := strings.TrimSpace(r.Header.Get(headerUpstream)); v != "" {
 			p.forceKey = v
 		}
@@ -107,6 +138,13 @@ func stickyPolicyFromRequest(sel config.SelectionConfig, r *http.Request) (reque
 			}
 			p.forceSticky = &b
 		}
+		if v := strings.TrimSpace(r.Header.Get(headerRotate)); v != "" {
+			b, ok := parseBoolLike(v)
+			if !ok {
+				return requestStickyPolicy{}, errors.New("invalid X-EasyProxyPool-Rotate (use 1/0)")
+			}
+			p.rotate = b
+		}
 		if v := strings.TrimSpace(r.Header.Get(headerFailover)); v != "" {
 			v = strings.ToLower(v)
 			switch v {
@@ -118,48 +156,17 @@ func stickyPolicyFromRequest(sel config.SelectionConfig, r *http.Request) (reque
 		}
 	}
 
-	p.sessionKey = sessionKeyFromRequest(headerOverride, r)
-	return p, nil
-}
-
-func hrwScore(sessionKey, nodeKey string) uint64 {
-	const (
-		offset64 = 14695981039346656037
-		prime64  = 1099511628211
-	)
-	var h uint64 = offset64
-	for i := 0; i < len(sessionKey); i++ {
-		h ^= uint64(sessionKey[i])
-		h *= prime64
-	}
-	h ^= 0
-	h *= prime64
-	for i := 0; i < len(nodeKey); i++ {
-		h ^= uint64(nodeKey[i])
-		h *= prime64
-	}
-	return h
-}
-
-func pickRendezvous(candidates []pool.Entry, sessionKey string, exclude map[string]struct{}) (pool.Entry, bool) {
-	var best pool.Entry
-	var bestScore uint64
-	found := false
-
-	for i := range candidates {
-		k := candidates[i].Key()
-		if exclude != nil {
-			if _, ok := exclude[k]; ok {
-				continue
-			}
-		}
-		score := hrwScore(sessionKey, k)
-		if !found || score > bestScore {
-			best = candidates[i]
-			bestScore = score
-			found = true
+	if v := strings.TrimSpace(r.Header.Get(headerSelect)); v != "" {
+		labels, err := pool.ParseLabelSelector(v)
+		if err != nil {
+			return requestStickyPolicy{}, errors.New("invalid X-EasyProxyPool-Select (use key=value[,key=value])")
 		}
+		p.labels = dispatch.MergeLabels(labels, p.labels)
+	}
+	if v := strings.TrimSpace(r.Header.Get(headerCountry)); v != "" {
+		p.labels = dispatch.MergeLabels(map[string]string{upstream.LabelCountry: v}, p.labels)
 	}
 
-	return best, found
+	p.sessionKey = sessionKeyFromRequest(headerOverride, r, opts)
+	return p, nil
 }
@@ -7,7 +7,6 @@ import (
 	"testing"
 
 	"github.com/CodeBoy2006/EasyProxyPool/internal/config"
-	"github.com/CodeBoy2006/EasyProxyPool/internal/pool"
 )
 
 func TestParseTraceIDFromTraceparent(t *testing.T) {
@@ -111,35 +110,110 @@ func TestStickyPolicyFromRequest(t *testing.T) {
 			t.Fatalf("unexpected sessionKey: %q", p.sessionKey)
 		}
 	})
-}
 
-func TestPickRendezvous_StableAndExclude(t *testing.T) {
-	candidates := []pool.Entry{
-		{ID: "n1"},
-		{ID: "n2"},
-		{ID: "n3"},
-	}
+	t.Run("select_header_labels", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "http://example.com", nil)
+		req.Header.Set(headerSelect, "Type=vless, source=premium")
+		p, err := stickyPolicyFromRequest(config.SelectionConfig{
+			Sticky: config.StickyConfig{
+				HeaderOverride: falsePtr,
+				Failover:       "soft",
+			},
+		}, req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(p.labels) != 2 || p.labels["type"] != "vless" || p.labels["source"] != "premium" {
+			t.Fatalf("unexpected labels: %v", p.labels)
+		}
+	})
 
-	best1, ok := pickRendezvous(candidates, "sess", nil)
-	if !ok {
-		t.Fatalf("expected ok")
-	}
-	best2, ok := pickRendezvous(candidates, "sess", nil)
-	if !ok {
-		t.Fatalf("expected ok")
-	}
-	if best1.Key() != best2.Key() {
-		t.Fatalf("expected stable pick, got %q vs %q", best1.Key(), best2.Key())
-	}
+	t.Run("invalid_select_header", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "http://example.com", nil)
+		req.Header.Set(headerSelect, "type")
+		_, err := stickyPolicyFromRequest(config.SelectionConfig{
+			Sticky: config.StickyConfig{
+				HeaderOverride: truePtr,
+				Failover:       "soft",
+			},
+		}, req)
+		if err == nil {
+			t.Fatalf("expected error")
+		}
+	})
 
-	exclude := map[string]struct{}{best1.Key(): {}}
-	second, ok := pickRendezvous(candidates, "sess", exclude)
-	if !ok {
-		t.Fatalf("expected ok")
-	}
-	if second.Key() == best1.Key() {
-		t.Fatalf("expected different pick when excluding best")
-	}
+	t.Run("username_options", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "http://example.com", nil)
+		req.Header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte("tenantA-session-abc123-sticky-on-failover-hard-type-vless:pw")))
+		p, err := stickyPolicyFromRequest(config.SelectionConfig{
+			Sticky: config.StickyConfig{
+				HeaderOverride: truePtr,
+				Failover:       "soft",
+			},
+		}, req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if p.sessionKey != "tenantA-session-abc123" || p.forceSticky == nil || !*p.forceSticky || p.failover != "hard" {
+			t.Fatalf("unexpected policy: %+v", p)
+		}
+		if len(p.labels) != 1 || p.labels["type"] != "vless" {
+			t.Fatalf("unexpected labels: %v", p.labels)
+		}
+
+		// Headers take precedence over username options.
+		req.Header.Set(headerFailover, "soft")
+		req.Header.Set(headerSelect, "type=trojan")
+		p, err = stickyPolicyFromRequest(config.SelectionConfig{
+			Sticky: config.StickyConfig{
+				HeaderOverride: truePtr,
+				Failover:       "soft",
+			},
+		}, req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if p.failover != "soft" || p.labels["type"] != "trojan" {
+			t.Fatalf("expected headers to win, got %+v", p)
+		}
+	})
+
+	t.Run("country", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "http://example.com", nil)
+		req.Header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte("alice-country-de:pw")))
+		sel := config.SelectionConfig{Sticky: config.StickyConfig{HeaderOverride: falsePtr, Failover: "soft"}}
+		p, err := stickyPolicyFromRequest(sel, req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if p.labels["country"] != "de" {
+			t.Fatalf("unexpected labels: %v", p.labels)
+		}
+
+		req.Header.Set(headerSelect, "type=vless")
+		req.Header.Set(headerCountry, "US")
+		p, err = stickyPolicyFromRequest(sel, req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(p.labels) != 2 || p.labels["country"] != "US" || p.labels["type"] != "vless" {
+			t.Fatalf("unexpected labels: %v", p.labels)
+		}
+	})
+
+	t.Run("invalid_username_options", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "http://example.com", nil)
+		req.Header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte("u-sticky-maybe:pw")))
+		_, err := stickyPolicyFromRequest(config.SelectionConfig{
+			Sticky: config.StickyConfig{
+				HeaderOverride: truePtr,
+				Failover:       "soft",
+			},
+		}, req)
+		if err == nil {
+			t.Fatalf("expected error")
+		}
+	})
 }
 
 func TestAuthorizeHTTP_SharedPassword(t *testing.T) {
@@ -190,6 +264,13 @@ func TestAuthorizeHTTP_Basic(t *testing.T) {
 	if rr.Code != http.StatusProxyAuthRequired {
 		t.Fatalf("expected 407, got %d", rr.Code)
 	}
+
+	optsReq, _ := http.NewRequest("GET", "http://example.com", nil)
+	optsReq.Header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte("u-session-s1:p")))
+	rr = httptest.NewRecorder()
+	if ok := s.authorizeHTTP(rr, optsReq); !ok {
+		t.Fatalf("expected authorized with username options")
+	}
 }
 
 func TestAuthorizeHTTP_Disabled(t *testing.T) {
@@ -0,0 +1,58 @@
+package socks5proxy
+
+import (
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/CodeBoy2006/EasyProxyPool/internal/pool"
+	"github.com/CodeBoy2006/EasyProxyPool/internal/routing"
+)
+
+// route evaluates the routing rules for a request by user. addr is the address
+// go-socks5 dials (already resolved), so CIDR rules also apply to domain requests.
+func (s *Server) route(info requestInfo, user, addr string) routing.Decision {
+	ipStr, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		ipStr = addr
+	}
+	port, _ := strconv.Atoi(portStr)
+
+	return s.Route(routing.Request{
+		Host: hostOnly(info.host),
+		IP:   net.ParseIP(ipStr),
+		Port: port,
+		User: user,
+	})
+}
+
+// next selects an upstream from the first tier that has one available. With a
+// session key the upstream is picked by its lease or rendezvous hashing, skipping
+// excluded keys. The connection is recorded as in flight; release must be called
+// when it ends.
+func (s *Server) next(tiers []*pool.Pool, sessionKey string, q pool.Query, exclude map[string]struct{}, now time.Time) (*pool.Pool, pool.Entry, func(), bool) {
+	for _, p := range tiers {
+		var entry pool.Entry
+		var release func()
+		var ok bool
+		if sessionKey != "" {
+			entry, ok = s.Leases().Pick(p, sessionKey, p.ActiveFor(q, now), exclude, false, now)
+			if ok {
+				entry, release, ok = p.AcquireKey(entry.Key(), now)
+			}
+		} else {
+			entry, release, ok = p.AcquireNext(s.selection.Strategy, q, now)
+		}
+		if ok {
+			return p, entry, release, true
+		}
+	}
+	return nil, pool.Entry{}, nil, false
+}
+
+func hostOnly(hostport string) string {
+	if h, _, err := net.SplitHostPort(hostport); err == nil {
+		return h
+	}
+	return hostport
+}
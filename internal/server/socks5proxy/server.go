@@ -3,6 +3,7 @@ package socks5proxy
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"log"
 	"log/slog"
@@ -12,8 +13,10 @@ import (
 
 	"github.com/CodeBoy2006/EasyProxyPool/internal/config"
 	"github.com/CodeBoy2006/EasyProxyPool/internal/pool"
+	"github.com/CodeBoy2006/EasyProxyPool/internal/routing"
+	"github.com/CodeBoy2006/EasyProxyPool/internal/server/dispatch"
+	"github.com/CodeBoy2006/EasyProxyPool/internal/useropts"
 	"github.com/armon/go-socks5"
-	"golang.org/x/net/proxy"
 )
 
 type Mode string
@@ -24,11 +27,13 @@ const (
 )
 
 type Server struct {
+	// Dispatcher holds routing, tiers and leases (SetRouting, SetTiers, SetLeases).
+	*dispatch.Dispatcher
+
 	log *slog.Logger
 
 	addr      string
 	mode      Mode
-	pool      *pool.Pool
 	auth      config.AuthConfig
 	selection config.SelectionConfig
 
@@ -37,19 +42,25 @@ type Server struct {
 }
 
 func New(log *slog.Logger, addr string, mode Mode, p *pool.Pool, auth config.AuthConfig, sel config.SelectionConfig) *Server {
+	log = log.With("component", "socks5", "mode", string(mode))
+	listener := routing.ListenerSOCKS5Relaxed
+	if mode == ModeStrict {
+		listener = routing.ListenerSOCKS5Strict
+	}
 	return &Server{
-		log:       log.With("component", "socks5", "mode", string(mode)),
-		addr:      addr,
-		mode:      mode,
-		pool:      p,
-		auth:      auth,
-		selection: sel,
+		Dispatcher: dispatch.New(log, listener, p, auth, sel),
+		log:        log,
+		addr:       addr,
+		mode:       mode,
+		auth:       auth,
+		selection:  sel,
 	}
 }
 
 func (s *Server) Start(ctx context.Context) {
 	conf := &socks5.Config{
-		Dial: s.dial,
+		Dial:     s.dial,
+		Rewriter: requestInfoRewriter{},
 		Logger: func() *log.Logger {
 			// Silence go-socks5 internal logs by default; slog handles our own logs.
 			return log.New(io.Discard, "", 0)
@@ -58,6 +69,13 @@ func (s *Server) Start(ctx context.Context) {
 
 	if creds := credentialStoreFromAuth(s.auth); creds != nil {
 		conf.Credentials = creds
+	} else {
+		// Without auth, still accept username/password negotiation so clients can
+		// pass a label selector in the username.
+		conf.AuthMethods = []socks5.Authenticator{
+			socks5.NoAuthAuthenticator{},
+			socks5.UserPassAuthenticator{Credentials: anyCredentials{}},
+		}
 	}
 
 	server, err := socks5.New(conf)
@@ -101,6 +119,28 @@ func (c sharedPasswordCredentials) Valid(user, password string) bool {
 	return password == c.password
 }
 
+// basicCredentials accepts the configured username, optionally followed by
+// username options.
+type basicCredentials struct {
+	username string
+	password string
+}
+
+func (c basicCredentials) Valid(user, password string) bool {
+	if password != c.password {
+		return false
+	}
+	if user == c.username {
+		return true
+	}
+	opts, err := useropts.Parse(user)
+	return err == nil && opts.User == c.username
+}
+
+type anyCredentials struct{}
+
+func (anyCredentials) Valid(user, password string) bool { return true }
+
 func credentialStoreFromAuth(auth config.AuthConfig) socks5.CredentialStore {
 	switch strings.ToLower(strings.TrimSpace(auth.Mode)) {
 	case "", "disabled":
@@ -109,7 +149,7 @@ func credentialStoreFromAuth(auth config.AuthConfig) socks5.CredentialStore {
 		if strings.TrimSpace(auth.Username) == "" {
 			return nil
 		}
-		return socks5.StaticCredentials{auth.Username: auth.Password}
+		return basicCredentials{username: auth.Username, password: auth.Password}
 	case "shared_password":
 		if strings.TrimSpace(auth.Password) == "" {
 			return nil
@@ -120,50 +160,146 @@ func credentialStoreFromAuth(auth config.AuthConfig) socks5.CredentialStore {
 	}
 }
 
+// requestInfo carries per-request details from go-socks5 into dial, which only
+// receives the (possibly locally resolved) destination address.
+type requestInfo struct {
+	host     string
+	username string
+}
+
+type requestInfoKey struct{}
+
+// requestInfoRewriter captures the requested destination host (FQDN when the client
+// sent one) into the context before go-socks5 calls Dial. It never rewrites the address.
+type requestInfoRewriter struct{}
+
+func (requestInfoRewriter) Rewrite(ctx context.Context, req *socks5.Request) (context.Context, *socks5.AddrSpec) {
+	info := requestInfo{}
+	if req.AuthContext != nil {
+		info.username = req.AuthContext.Payload["Username"]
+	}
+	if req.DestAddr != nil {
+		info.host = req.DestAddr.FQDN
+		if info.host == "" && req.DestAddr.IP != nil {
+			info.host = req.DestAddr.IP.String()
+		}
+	}
+	return context.WithValue(ctx, requestInfoKey{}, info), req.DestAddr
+}
+
+func requestInfoFromContext(ctx context.Context, addr string) requestInfo {
+	info, _ := ctx.Value(requestInfoKey{}).(requestInfo)
+	if info.host == "" {
+		info.host = addr
+	}
+	return info
+}
+
 func (s *Server) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	info := requestInfoFromContext(ctx, addr)
+	policy, err := s.policyFor(info.username)
+	if err != nil {
+		return nil, err
+	}
+
+	route := s.route(info, policy.user, addr)
+	switch route.Action {
+	case routing.ActionReject:
+		return nil, fmt.Errorf("rejected by routing rule %s", route.Rule)
+	case routing.ActionDirect:
+		var d net.Dialer
+		return d.DialContext(ctx, network, addr)
+	}
+	tiers, err := s.Tiers(route)
+	if err != nil {
+		return nil, err
+	}
+	query := pool.Query{Host: info.host, Labels: dispatch.MergeLabels(route.Labels, policy.labels)}
+	sessionKey := policy.sessionKey
+
+	attempted := map[string]struct{}{}
 	var lastErr error
 	for attempt := 0; attempt <= s.selection.Retries; attempt++ {
-		entry, ok := s.pool.Next(s.selection.Strategy, time.Now())
+		start := time.Now()
+		p, entry, release, ok := s.next(tiers, sessionKey, query, attempted, start)
 		if !ok {
 			return nil, errors.New("no upstreams available")
 		}
 
-		c, err := dialViaUpstream(ctx, entry, network, addr)
+		c, err := dispatch.Dial(ctx, entry, network, addr)
 		if err != nil {
+			release()
 			lastErr = err
-			s.pool.MarkFailure(entry.Key(), time.Now(), time.Duration(s.selection.FailureBackoffSeconds)*time.Second, time.Duration(s.selection.MaxBackoffSeconds)*time.Second)
+			s.MarkFailure(p, entry.Key(), query.Host, err, time.Now())
+			// Soft failover moves on to the next-ranked upstream; hard failover stays on
+			// the top one until its breaker opens.
+			if sessionKey != "" && policy.failover == "soft" {
+				attempted[entry.Key()] = struct{}{}
+			}
 			continue
 		}
-		s.pool.MarkSuccess(entry.Key())
-		return c, nil
+		s.MarkSuccess(p, entry.Key(), query.Host)
+		p.ObserveLatency(entry.Key(), time.Since(start))
+		return dispatch.NewTunnelConn(c, p, entry.Key(), release), nil
 	}
 	return nil, lastErr
 }
 
-func dialViaUpstream(ctx context.Context, upstream pool.Entry, network, addr string) (net.Conn, error) {
-	var auth *proxy.Auth
-	if strings.TrimSpace(upstream.Username) != "" || strings.TrimSpace(upstream.Password) != "" {
-		auth = &proxy.Auth{User: upstream.Username, Password: upstream.Password}
+// requestPolicy is the per-request selection policy derived from the username.
+type requestPolicy struct {
+	// user is the username without options, as seen by routing rules.
+	user string
+	// sessionKey is set when the request is sticky.
+	sessionKey string
+	failover   string
+	labels     map[string]string
+}
+
+// policyFor derives the selection policy from the SOCKS5 username: either a label
+// selector ("type=vless,source=premium") or a user with options
+// ("tenantA-session-abc123-failover-hard", see package useropts). Without options
+// the username itself is the sticky session key.
+func (s *Server) policyFor(username string) (requestPolicy, error) {
+	p := requestPolicy{failover: s.selection.Sticky.Failover}
+
+	labels, err := labelsFromUsername(username)
+	if err != nil {
+		return requestPolicy{}, err
+	}
+	if labels != nil {
+		p.labels = labels
+		return p, nil
 	}
-	dialer, err := proxy.SOCKS5("tcp", upstream.Addr, auth, proxy.Direct)
+
+	opts, err := useropts.Parse(username)
 	if err != nil {
-		return nil, err
+		return requestPolicy{}, err
 	}
+	p.user = opts.User
+	p.labels = opts.Labels
 
-	type result struct {
-		conn net.Conn
-		err  error
+	sticky := s.selection.Sticky.Enabled
+	if s.selection.Sticky.HeaderOverride == nil || *s.selection.Sticky.HeaderOverride {
+		if opts.Sticky != nil {
+			sticky = *opts.Sticky
+		}
+		if opts.Failover != "" {
+			p.failover = opts.Failover
+		}
 	}
-	done := make(chan result, 1)
-	go func() {
-		c, err := dialer.Dial(network, addr)
-		done <- result{conn: c, err: err}
-	}()
+	// A bare username only names a session under shared_password; an explicit
+	// session option counts in every auth mode.
+	if sticky && (opts.Session != "" || s.SharedPassword()) {
+		p.sessionKey = strings.TrimSpace(opts.SessionKey())
+	}
+	return p, nil
+}
 
-	select {
-	case res := <-done:
-		return res.conn, res.err
-	case <-ctx.Done():
-		return nil, ctx.Err()
+// labelsFromUsername parses a label selector passed as the SOCKS5 username, e.g.
+// "type=vless,source=premium". Usernames without '=' carry no selector.
+func labelsFromUsername(username string) (map[string]string, error) {
+	if !strings.Contains(username, "=") {
+		return nil, nil
 	}
+	return pool.ParseLabelSelector(username)
 }
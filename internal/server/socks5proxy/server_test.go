@@ -1,9 +1,13 @@
 package socks5proxy
 
 import (
+	"io"
+	"log/slog"
 	"testing"
+	"time"
 
 	"github.com/CodeBoy2006/EasyProxyPool/internal/config"
+	"github.com/CodeBoy2006/EasyProxyPool/internal/pool"
 )
 
 func TestCredentialStoreFromAuth(t *testing.T) {
@@ -39,3 +43,106 @@ func TestCredentialStoreFromAuth(t *testing.T) {
 		}
 	})
 }
+
+func TestLabelsFromUsername(t *testing.T) {
+	t.Run("plain_username", func(t *testing.T) {
+		labels, err := labelsFromUsername("alice")
+		if err != nil || labels != nil {
+			t.Fatalf("expected no selector, got %v, %v", labels, err)
+		}
+	})
+
+	t.Run("selector", func(t *testing.T) {
+		labels, err := labelsFromUsername("type=vless,source=premium")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(labels) != 2 || labels["type"] != "vless" || labels["source"] != "premium" {
+			t.Fatalf("unexpected labels: %v", labels)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		if _, err := labelsFromUsername("type=vless,=x"); err == nil {
+			t.Fatalf("expected error")
+		}
+	})
+}
+
+func TestNext_StickySession(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	p := pool.New("test", log)
+	p.Update([]pool.Entry{{Addr: "1.1.1.1:1080"}, {Addr: "2.2.2.2:1080"}, {Addr: "3.3.3.3:1080"}})
+	sel := config.SelectionConfig{Strategy: "round_robin", Sticky: config.StickyConfig{Enabled: true, Failover: "soft"}}
+	s := New(log, ":0", ModeRelaxed, p, config.AuthConfig{Mode: "shared_password", Password: "p"}, sel)
+	tiers := []*pool.Pool{p}
+	now := time.Now()
+
+	policy, err := s.policyFor("browser-7")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	key := policy.sessionKey
+	if key != "browser-7" {
+		t.Fatalf("expected username as session key, got %q", key)
+	}
+	_, first, _, ok := s.next(tiers, key, pool.Query{}, nil, now)
+	if !ok {
+		t.Fatalf("expected an upstream")
+	}
+	for i := 0; i < 5; i++ {
+		if _, e, _, _ := s.next(tiers, key, pool.Query{}, nil, now); e.Key() != first.Key() {
+			t.Fatalf("expected sticky pick %q, got %q", first.Key(), e.Key())
+		}
+	}
+
+	// Soft failover excludes upstreams already attempted by the request.
+	_, second, _, ok := s.next(tiers, key, pool.Query{}, map[string]struct{}{first.Key(): {}}, now)
+	if !ok || second.Key() == first.Key() {
+		t.Fatalf("expected a different upstream after excluding %q, got %q", first.Key(), second.Key())
+	}
+
+	if policy, _ := s.policyFor("type=vless"); policy.sessionKey != "" {
+		t.Fatalf("expected label selectors not to be session keys, got %q", policy.sessionKey)
+	}
+	basic := New(log, ":0", ModeRelaxed, p, config.AuthConfig{Mode: "basic", Username: "browser-7", Password: "p"}, sel)
+	if policy, _ := basic.policyFor("browser-7"); policy.sessionKey != "" {
+		t.Fatalf("expected no session key from the basic auth username, got %q", policy.sessionKey)
+	}
+	if policy, _ := basic.policyFor("browser-7-session-a"); policy.sessionKey != "browser-7-session-a" {
+		t.Fatalf("expected explicit session under basic auth, got %q", policy.sessionKey)
+	}
+	s.selection.Sticky.Enabled = false
+	if policy, _ := s.policyFor("browser-7"); policy.sessionKey != "" {
+		t.Fatalf("expected no session key with sticky disabled, got %q", policy.sessionKey)
+	}
+}
+
+func TestPolicyFor_UsernameOptions(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	sel := config.SelectionConfig{Sticky: config.StickyConfig{Failover: "soft"}}
+	s := New(log, ":0", ModeRelaxed, pool.New("test", log), config.AuthConfig{Mode: "shared_password", Password: "p"}, sel)
+
+	policy, err := s.policyFor("tenantA-session-abc123-sticky-on-failover-hard-type-vless")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if policy.user != "tenantA" || policy.sessionKey != "tenantA-session-abc123" || policy.failover != "hard" {
+		t.Fatalf("unexpected policy: %+v", policy)
+	}
+	if len(policy.labels) != 1 || policy.labels["type"] != "vless" {
+		t.Fatalf("unexpected labels: %v", policy.labels)
+	}
+
+	if _, err := s.policyFor("tenantA-failover-never"); err == nil {
+		t.Fatalf("expected error for invalid failover option")
+	}
+
+	creds := credentialStoreFromAuth(config.AuthConfig{Mode: "basic", Username: "u", Password: "p"})
+	if !creds.Valid("u-session-s1", "p") {
+		t.Fatalf("expected basic auth to accept username options")
+	}
+	if creds.Valid("x-session-s1", "p") {
+		t.Fatalf("expected basic auth to reject other users")
+	}
+}
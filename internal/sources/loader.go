@@ -3,10 +3,16 @@ package sources
 import (
 	"bufio"
 	"context"
+	"crypto/sha256"
 	"fmt"
 	"log/slog"
+	"net/url"
 	"os"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/CodeBoy2006/EasyProxyPool/internal/clash"
 	"github.com/CodeBoy2006/EasyProxyPool/internal/config"
@@ -17,29 +23,113 @@ import (
 type Loader struct {
 	log     *slog.Logger
 	fetcher *fetcher.Fetcher
+
+	mu sync.Mutex
+	// state holds the last load of each source, keyed by sourceKey; order lists
+	// the keys of the last Load in configuration order.
+	state map[string]*sourceState
+	order []string
 }
 
 func New(log *slog.Logger) *Loader {
 	return &Loader{
 		log:     log.With("component", "sources"),
 		fetcher: fetcher.New(log),
+		state:   make(map[string]*sourceState),
 	}
 }
 
+// SetCacheDir keeps the last good body of every source URL under dir (see
+// fetcher.Fetcher.SetCacheDir).
+func (l *Loader) SetCacheDir(dir string) {
+	l.fetcher.SetCacheDir(dir)
+}
+
 type Result struct {
 	Specs     []upstream.Spec
 	SOCKS5Addrs []string
+	// AddrLabels holds the selection labels of each entry in SOCKS5Addrs.
+	AddrLabels map[string]map[string]string
 
 	Problems []string
 	Skipped  map[string]int
 }
 
+// SourceStatus reports the health of one configured source. A source is degraded
+// when its last fetch failed; its last successful result, if any, is still used.
+type SourceStatus struct {
+	Name string
+	Type string
+	// Location is the source path, or its URL without credentials and query.
+	Location string
+
+	Degraded    bool
+	LastError   string
+	LastAttempt time.Time
+	LastSuccess time.Time
+	// NextRefresh is when the source is fetched again; zero means on the next
+	// pool refresh.
+	NextRefresh time.Time
+	// Entries is the number of upstreams in the last successful result.
+	Entries int
+	// CachedAt is when the body in use was downloaded or revalidated; it lags
+	// LastAttempt when the remote failed and the cached body was used. Zero for
+	// file sources.
+	CachedAt time.Time
+	// CacheAgeSeconds is the age of that body at the time of the Status call.
+	CacheAgeSeconds int64
+}
+
+// sourceState is what the Loader remembers about one source between loads.
+type sourceState struct {
+	status SourceStatus
+	last   *sourceResult
+	// fetching is set while a Load or Refresh fetches the source, so the other
+	// uses the last result instead of fetching it again.
+	fetching bool
+}
+
+// sourceResult is what a single source contributes to a Result.
+type sourceResult struct {
+	specs    []upstream.Spec
+	addrs    []string
+	labels   map[string]map[string]string
+	problems []string
+	skipped  map[string]int
+	// fetchedAt is when the URL body was downloaded or revalidated; stale is the
+	// fetch error when the cached body was used instead.
+	fetchedAt time.Time
+	stale     error
+	// sum fingerprints the entries, to tell whether a re-fetch changed anything.
+	sum [sha256.Size]byte
+}
+
+// dueSource is a source to fetch and its state.
+type dueSource struct {
+	src config.SourceConfig
+	st  *sourceState
+}
+
+// Load loads every source and merges the results. Sources are isolated: one that
+// fails is marked degraded and contributes its last successful result (if any)
+// while the others load normally. A source is only re-fetched once its
+// refresh_interval_minutes has passed. Due sources are fetched concurrently,
+// without holding the loader lock.
 func (l *Loader) Load(ctx context.Context, sources []config.SourceConfig) (Result, error) {
+	now := time.Now()
+	l.mu.Lock()
+	order, due := l.planLocked(sources, now, false)
+	l.order = order
+	l.mu.Unlock()
+
+	l.fetchAll(ctx, due, now)
+
 	var out Result
 	out.Skipped = make(map[string]int)
+	out.AddrLabels = make(map[string]map[string]string)
 
 	set := make(map[string]struct{})
-	addAddr := func(addr string) {
+	addAddr := func(addr string, labels map[string]string) {
 		addr = strings.TrimSpace(addr)
 		if addr == "" {
 			return
@@ -52,44 +142,33 @@ func (l *Loader) Load(ctx context.Context, sources []config.SourceConfig) (Resul
 		}
 		set[addr] = struct{}{}
 		out.SOCKS5Addrs = append(out.SOCKS5Addrs, addr)
+		out.AddrLabels[addr] = labels
 	}
 
-	for _, src := range sources {
-		typ := strings.ToLower(strings.TrimSpace(src.Type))
-		switch typ {
-		case "raw_list":
-			addrs, problems, err := l.loadRawList(ctx, src)
-			if err != nil {
-				return Result{}, err
-			}
-			out.Problems = append(out.Problems, problems...)
-			for _, a := range addrs {
-				addAddr(a)
-			}
-		case "clash_yaml":
-			rep, err := l.loadClashYAML(ctx, src)
-			if err != nil {
-				return Result{}, err
-			}
-			out.Problems = append(out.Problems, rep.Problems...)
-			for k, v := range rep.SkippedByType {
-				out.Skipped[k] += v
-			}
-			out.Specs = append(out.Specs, rep.Specs...)
-			for _, s := range rep.Specs {
-				// For the legacy (non-xray) pipeline, we can only use SOCKS5 nodes.
-				// Nodes with auth are skipped until the pool/dialer layer supports credentials.
-				if s.Type != upstream.TypeSOCKS5 || s.SOCKS5 == nil {
-					continue
-				}
-				if strings.TrimSpace(s.SOCKS5.Username) != "" || strings.TrimSpace(s.SOCKS5.Password) != "" {
-					out.Problems = append(out.Problems, fmt.Sprintf("proxy(name=%q,type=socks5): auth not supported in legacy mode; skipped", s.Name))
-					continue
-				}
-				addAddr(fmt.Sprintf("%s:%d", s.Server, s.Port))
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for i, src := range sources {
+		st := l.state[order[i]]
+		res := st.last
+		if res == nil {
+			msg := st.status.LastError
+			if msg == "" {
+				msg = "not loaded yet"
 			}
-		default:
-			out.Problems = append(out.Problems, fmt.Sprintf("source(type=%q): unsupported (use raw_list or clash_yaml)", src.Type))
+			out.Problems = append(out.Problems, fmt.Sprintf("source(%s): %s", sourceLabel(src), msg))
+			continue
+		}
+		if st.status.Degraded {
+			out.Problems = append(out.Problems, fmt.Sprintf("source(%s): %s; using the last good result", sourceLabel(src), st.status.LastError))
+		}
+		out.Problems = append(out.Problems, res.problems...)
+		for k, v := range res.skipped {
+			out.Skipped[k] += v
+		}
+		out.Specs = append(out.Specs, res.specs...)
+		for _, a := range res.addrs {
+			addAddr(a, res.labels[a])
 		}
 	}
 
@@ -100,12 +179,281 @@ func (l *Loader) Load(ctx context.Context, sources []config.SourceConfig) (Resul
 	return out, nil
 }
 
-func (l *Loader) loadRawList(ctx context.Context, src config.SourceConfig) ([]string, []string, error) {
+// Refresh fetches the sources with a refresh_interval_minutes that are due and
+// reports whether any of them returned different entries, so the caller can
+// refresh the pool only then. Other sources are left to Load.
+func (l *Loader) Refresh(ctx context.Context, sources []config.SourceConfig) bool {
+	now := time.Now()
+	l.mu.Lock()
+	_, due := l.planLocked(sources, now, true)
+	l.mu.Unlock()
+	return l.fetchAll(ctx, due, now)
+}
+
+// planLocked returns the state keys of sources in order and the sources to fetch
+// now, marking those as fetching. With scheduledOnly, only sources with their own
+// refresh interval are considered. Callers must hold l.mu.
+func (l *Loader) planLocked(sources []config.SourceConfig, now time.Time, scheduledOnly bool) ([]string, []dueSource) {
+	order := make([]string, 0, len(sources))
+	var due []dueSource
+	for _, src := range sources {
+		key := sourceKey(src)
+		order = append(order, key)
+		st, ok := l.state[key]
+		if !ok {
+			st = &sourceState{status: SourceStatus{Name: src.Name, Type: src.Type, Location: redactURL(src.URL)}}
+			if src.URL == "" {
+				st.status.Location = src.Path
+			}
+			l.state[key] = st
+		}
+		if st.fetching || (scheduledOnly && src.RefreshIntervalMinutes <= 0) {
+			continue
+		}
+		if scheduledOnly && st.last != nil && now.Before(st.status.NextRefresh) {
+			continue
+		}
+		if !scheduledOnly && st.last != nil && !st.status.Degraded && now.Before(st.status.NextRefresh) {
+			continue
+		}
+		st.fetching = true
+		due = append(due, dueSource{src: src, st: st})
+	}
+	return order, due
+}
+
+// fetchAll loads the due sources concurrently and records the results. It
+// reports whether any source returned entries different from its last result.
+func (l *Loader) fetchAll(ctx context.Context, due []dueSource, now time.Time) bool {
+	var wg sync.WaitGroup
+	var changed atomic.Bool
+	for _, d := range due {
+		wg.Add(1)
+		go func(d dueSource) {
+			defer wg.Done()
+			res, err := l.loadSource(ctx, d.src)
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			d.st.fetching = false
+			if l.record(d.src, d.st, res, err, now) {
+				changed.Store(true)
+			}
+		}(d)
+	}
+	wg.Wait()
+	return changed.Load()
+}
+
+// record updates st with the outcome of a fetch of src: a failed fetch marks the
+// source degraded and keeps its last result. It reports whether the result
+// replaced a different one. Callers must hold l.mu.
+func (l *Loader) record(src config.SourceConfig, st *sourceState, res sourceResult, err error, now time.Time) bool {
+	st.status.LastAttempt = now
+	st.status.NextRefresh = time.Time{}
+	if src.RefreshIntervalMinutes > 0 {
+		st.status.NextRefresh = now.Add(time.Duration(src.RefreshIntervalMinutes) * time.Minute)
+	}
+	if err != nil {
+		st.status.Degraded = true
+		st.status.LastError = err.Error()
+		l.log.Warn("source failed", "source", sourceLabel(src), "err", err, "cached", st.last != nil)
+		return false
+	}
+	changed := st.last == nil || st.last.sum != res.sum
+	st.last = &res
+	st.status.CachedAt = res.fetchedAt
+	st.status.Entries = len(res.addrs)
+	if len(res.specs) > st.status.Entries {
+		st.status.Entries = len(res.specs)
+	}
+	if res.stale != nil {
+		// The remote failed but its cached body still loaded: degraded, retried on
+		// the next refresh.
+		st.status.Degraded = true
+		st.status.LastError = res.stale.Error()
+		return changed
+	}
+	st.status.Degraded = false
+	st.status.LastError = ""
+	st.status.LastSuccess = now
+	return changed
+}
+
+// Status returns the status of every source of the last Load, in configuration order.
+func (l *Loader) Status() []SourceStatus {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	out := make([]SourceStatus, 0, len(l.order))
+	now := time.Now()
+	for _, k := range l.order {
+		st := l.state[k].status
+		if !st.CachedAt.IsZero() {
+			st.CacheAgeSeconds = int64(now.Sub(st.CachedAt) / time.Second)
+		}
+		out = append(out, st)
+	}
+	return out
+}
+
+// ListStatus reports the legacy proxy_list_urls in the form of source statuses.
+func ListStatus(lists []fetcher.ListStatus) []SourceStatus {
+	out := make([]SourceStatus, 0, len(lists))
+	now := time.Now()
+	for _, ls := range lists {
+		st := SourceStatus{
+			Type:        "proxy_list_url",
+			Location:    redactURL(ls.URL),
+			LastAttempt: ls.LastAttempt,
+			LastSuccess: ls.LastSuccess,
+			Entries:     ls.Entries,
+			CachedAt:    ls.CachedAt,
+		}
+		if ls.Err != nil {
+			st.Degraded = true
+			st.LastError = ls.Err.Error()
+		}
+		if !st.CachedAt.IsZero() {
+			st.CacheAgeSeconds = int64(now.Sub(st.CachedAt) / time.Second)
+		}
+		out = append(out, st)
+	}
+	return out
+}
+
+func (l *Loader) loadSource(ctx context.Context, src config.SourceConfig) (sourceResult, error) {
+	res := sourceResult{labels: make(map[string]map[string]string), skipped: make(map[string]int)}
+	typ := strings.ToLower(strings.TrimSpace(src.Type))
+	switch typ {
+	case "raw_list":
+		addrs, problems, err := l.loadRawList(ctx, src, &res)
+		if err != nil {
+			return sourceResult{}, err
+		}
+		res.problems = problems
+		labels := upstream.Spec{Type: upstream.TypeSOCKS5, Source: src.Name, Labels: src.Labels}.LabelSet()
+		for _, a := range addrs {
+			a = strings.TrimPrefix(strings.TrimSpace(a), "socks5://")
+			res.addrs = append(res.addrs, a)
+			res.labels[a] = labels
+		}
+	case "clash_yaml":
+		rep, err := l.loadClashYAML(ctx, src, &res)
+		if err != nil {
+			return sourceResult{}, err
+		}
+		res.problems = rep.Problems
+		res.skipped = rep.SkippedByType
+		for i := range rep.Specs {
+			rep.Specs[i].Source = src.Name
+			rep.Specs[i].Labels = src.Labels
+		}
+		res.specs = rep.Specs
+		for _, s := range rep.Specs {
+			// For the legacy (non-xray) pipeline, we can only use SOCKS5 nodes.
+			// Nodes with auth are skipped until the pool/dialer layer supports credentials.
+			if s.Type != upstream.TypeSOCKS5 || s.SOCKS5 == nil {
+				continue
+			}
+			if strings.TrimSpace(s.SOCKS5.Username) != "" || strings.TrimSpace(s.SOCKS5.Password) != "" {
+				res.problems = append(res.problems, fmt.Sprintf("proxy(name=%q,type=socks5): auth not supported in legacy mode; skipped", s.Name))
+				continue
+			}
+			addr := fmt.Sprintf("%s:%d", s.Server, s.Port)
+			res.addrs = append(res.addrs, addr)
+			res.labels[addr] = s.LabelSet()
+		}
+	default:
+		return sourceResult{}, fmt.Errorf("unsupported type %q (use raw_list or clash_yaml)", src.Type)
+	}
+	res.sum = fingerprint(res)
+	return res, nil
+}
+
+// fingerprint hashes the entries of res (SOCKS5 addresses and spec IDs, which
+// are derived from the node settings) in a stable order.
+func fingerprint(res sourceResult) [sha256.Size]byte {
+	keys := make([]string, 0, len(res.addrs)+len(res.specs))
+	keys = append(keys, res.addrs...)
+	for _, s := range res.specs {
+		keys = append(keys, s.Normalize().ID)
+	}
+	sort.Strings(keys)
+	return sha256.Sum256([]byte(strings.Join(keys, "\n")))
+}
+
+// redactURL drops credentials and the query (subscription URLs often carry
+// tokens there) from a source URL before it is reported.
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	u.User = nil
+	u.RawQuery = ""
+	u.Fragment = ""
+	return u.String()
+}
+
+// sourceKey identifies a source across loads.
+func sourceKey(src config.SourceConfig) string {
+	return strings.Join([]string{strings.ToLower(strings.TrimSpace(src.Type)), src.URL, src.Path, src.Name, src.Pool}, "|")
+}
+
+// sourceLabel names a source in logs and problems.
+func sourceLabel(src config.SourceConfig) string {
+	if src.Name != "" {
+		return fmt.Sprintf("name=%q,type=%s", src.Name, src.Type)
+	}
+	loc := src.URL
+	if loc == "" {
+		loc = src.Path
+	}
+	return fmt.Sprintf("type=%s,location=%q", src.Type, loc)
+}
+
+// fetch downloads a source URL and parses it with parse, which returns the number
+// of entries found. A body that fails to parse or has no entries is not cached and
+// the last good body is parsed instead, as for a failed fetch. fetch records in res
+// when the body was fetched and whether it is a cached body.
+func (l *Loader) fetch(ctx context.Context, url string, res *sourceResult, parse func([]byte) (int, error)) error {
+	body, err := l.fetcher.Get(ctx, url)
+	if err != nil {
+		return err
+	}
+	n, err := parse(body.Data)
+	if err == nil && n == 0 {
+		err = fmt.Errorf("no entries")
+	}
+	switch {
+	case err == nil:
+		l.fetcher.Commit(url, body)
+	case body.Stale != nil:
+		return err
+	default:
+		if body, err = l.fetcher.Fallback(url, fmt.Errorf("unusable body: %w", err)); err != nil {
+			return err
+		}
+		if _, err := parse(body.Data); err != nil {
+			return err
+		}
+	}
+	res.fetchedAt = body.FetchedAt
+	if body.Stale != nil {
+		res.stale = fmt.Errorf("%w; using the body cached at %s", body.Stale, body.FetchedAt.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+func (l *Loader) loadRawList(ctx context.Context, src config.SourceConfig, res *sourceResult) ([]string, []string, error) {
 	if src.URL != "" && src.Path != "" {
 		return nil, nil, fmt.Errorf("raw_list: set only one of url or path")
 	}
 	if src.URL != "" {
-		addrs, err := l.fetcher.Fetch(ctx, []string{src.URL})
+		var addrs []string
+		err := l.fetch(ctx, src.URL, res, func(data []byte) (int, error) {
+			addrs = rawListLines(data)
+			return len(addrs), nil
+		})
 		if err != nil {
 			return nil, nil, fmt.Errorf("raw_list fetch url: %w", err)
 		}
@@ -135,16 +483,38 @@ func (l *Loader) loadRawList(ctx context.Context, src config.SourceConfig) ([]st
 	return nil, nil, fmt.Errorf("raw_list: missing url/path")
 }
 
-func (l *Loader) loadClashYAML(ctx context.Context, src config.SourceConfig) (clash.ParseReport, error) {
+// rawListLines returns the non-empty, non-comment lines of a raw_list body.
+func rawListLines(data []byte) []string {
+	var out []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		out = append(out, line)
+	}
+	return out
+}
+
+func (l *Loader) loadClashYAML(ctx context.Context, src config.SourceConfig, res *sourceResult) (clash.ParseReport, error) {
 	if src.URL != "" && src.Path != "" {
 		return clash.ParseReport{}, fmt.Errorf("clash_yaml: set only one of url or path")
 	}
 	if src.URL != "" {
-		data, err := l.fetcher.FetchBytes(ctx, src.URL)
+		var rep clash.ParseReport
+		err := l.fetch(ctx, src.URL, res, func(data []byte) (int, error) {
+			var err error
+			rep, err = clash.ParseYAML(data)
+			n := len(rep.Specs)
+			for _, c := range rep.SkippedByType {
+				n += c
+			}
+			return n, err
+		})
 		if err != nil {
 			return clash.ParseReport{}, fmt.Errorf("clash_yaml fetch url: %w", err)
 		}
-		return clash.ParseYAML(data)
+		return rep, nil
 	}
 	if src.Path != "" {
 		data, err := os.ReadFile(src.Path)
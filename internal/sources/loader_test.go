@@ -4,9 +4,14 @@ import (
 	"context"
 	"io"
 	"log/slog"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/CodeBoy2006/EasyProxyPool/internal/config"
 )
@@ -65,6 +70,185 @@ proxies:
 	}
 }
 
+func TestLoader_Load_IsolatesFailingSources(t *testing.T) {
+	dir := t.TempDir()
+	rawPath := filepath.Join(dir, "list.txt")
+	if err := os.WriteFile(rawPath, []byte("1.1.1.1:1080\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var fail, hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if fail.Load() == 1 {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte("2.2.2.2:1080\n"))
+	}))
+	defer srv.Close()
+
+	l := New(nilLogger(t))
+	srcs := []config.SourceConfig{
+		{Type: "raw_list", Path: rawPath},
+		{Type: "raw_list", URL: srv.URL + "/list?token=secret", Name: "remote"},
+		{Type: "raw_list", URL: srv.URL + "/cached", Name: "slow", RefreshIntervalMinutes: 60},
+	}
+	load := func() Result {
+		t.Helper()
+		res, err := l.Load(context.Background(), srcs)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return res
+	}
+
+	if res := load(); len(res.SOCKS5Addrs) != 2 || hits.Load() != 2 {
+		t.Fatalf("expected both addrs from 2 fetches, got %v after %d fetches", res.SOCKS5Addrs, hits.Load())
+	}
+
+	// The remote source fails: it is marked degraded and its last good result is
+	// reused; the slow source is not due and is not fetched again.
+	fail.Store(1)
+	res := load()
+	if len(res.SOCKS5Addrs) != 2 || res.AddrLabels["2.2.2.2:1080"]["source"] != "remote" {
+		t.Fatalf("expected the cached result of the failing source, got %v %v", res.SOCKS5Addrs, res.AddrLabels)
+	}
+	if hits.Load() != 3 {
+		t.Fatalf("expected only the remote source to be re-fetched, got %d fetches", hits.Load())
+	}
+
+	st := l.Status()
+	if len(st) != 3 {
+		t.Fatalf("expected 3 source statuses, got %+v", st)
+	}
+	if st[0].Degraded || st[2].Degraded || st[2].NextRefresh.IsZero() {
+		t.Fatalf("unexpected status of healthy sources: %+v", st)
+	}
+	remote := st[1]
+	if !remote.Degraded || !strings.Contains(remote.LastError, "404") || remote.LastSuccess.IsZero() || remote.Entries != 1 {
+		t.Fatalf("expected the remote source to be degraded, got %+v", remote)
+	}
+	if remote.CachedAt.IsZero() || remote.CachedAt.After(remote.LastAttempt) || st[0].CachedAt != (time.Time{}) {
+		t.Fatalf("expected the cache time of the remote source only, got %+v", st)
+	}
+	if strings.Contains(remote.Location, "secret") {
+		t.Fatalf("expected the query to be redacted, got %q", remote.Location)
+	}
+}
+
+func TestLoader_Load_UnparseableBodyKeepsCache(t *testing.T) {
+	var portal atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if portal.Load() == 1 {
+			_, _ = w.Write([]byte("<html><body>Sign in to the network</body></html>\n"))
+			return
+		}
+		_, _ = w.Write([]byte("proxies:\n  - name: s1\n    type: socks5\n    server: 3.3.3.3\n    port: 1080\n"))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	srcs := []config.SourceConfig{{Type: "clash_yaml", URL: srv.URL}}
+	l := New(nilLogger(t))
+	l.SetCacheDir(dir)
+	if res, err := l.Load(context.Background(), srcs); err != nil || len(res.SOCKS5Addrs) != 1 {
+		t.Fatalf("expected the subscription to load, got %v (%v)", res.SOCKS5Addrs, err)
+	}
+
+	// After a restart, a captive portal page served with status 200 does not
+	// replace the cached subscription, which is used instead.
+	portal.Store(1)
+	for i := 0; i < 2; i++ {
+		l = New(nilLogger(t))
+		l.SetCacheDir(dir)
+		res, err := l.Load(context.Background(), srcs)
+		if err != nil || len(res.SOCKS5Addrs) != 1 || res.SOCKS5Addrs[0] != "3.3.3.3:1080" {
+			t.Fatalf("load %d: expected the cached subscription, got %v (%v)", i, res.SOCKS5Addrs, err)
+		}
+		if st := l.Status(); len(st) != 1 || !st[0].Degraded || !strings.Contains(st[0].LastError, "unusable body") {
+			t.Fatalf("load %d: expected the source to be degraded, got %+v", i, st)
+		}
+	}
+}
+
+func TestLoader_Refresh_ReportsChanges(t *testing.T) {
+	var body atomic.Value
+	body.Store("1.1.1.1:1080\n")
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		_, _ = w.Write([]byte(body.Load().(string)))
+	}))
+	defer srv.Close()
+
+	l := New(nilLogger(t))
+	srcs := []config.SourceConfig{
+		{Type: "raw_list", URL: srv.URL + "/every-refresh"},
+		{Type: "raw_list", URL: srv.URL + "/scheduled", RefreshIntervalMinutes: 1},
+	}
+	if _, err := l.Load(context.Background(), srcs); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if hits.Load() != 2 {
+		t.Fatalf("expected both sources fetched by Load, got %d fetches", hits.Load())
+	}
+
+	// Not due yet: nothing is fetched.
+	if l.Refresh(context.Background(), srcs) || hits.Load() != 2 {
+		t.Fatalf("expected no fetch before the interval, got %d fetches", hits.Load())
+	}
+
+	// Due with the same entries: fetched, unchanged. Only the scheduled source is
+	// fetched; the other waits for the next Load.
+	l.mu.Lock()
+	for _, st := range l.state {
+		st.status.NextRefresh = time.Now().Add(-time.Second)
+	}
+	l.mu.Unlock()
+	if l.Refresh(context.Background(), srcs) || hits.Load() != 3 {
+		t.Fatalf("expected one unchanged fetch, got %d fetches", hits.Load())
+	}
+
+	body.Store("2.2.2.2:1080\n")
+	l.mu.Lock()
+	for _, st := range l.state {
+		st.status.NextRefresh = time.Now().Add(-time.Second)
+	}
+	l.mu.Unlock()
+	if !l.Refresh(context.Background(), srcs) {
+		t.Fatalf("expected the changed entries to be reported")
+	}
+}
+
+func TestLoader_Load_DoesNotBlockStatusDuringFetch(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		_, _ = w.Write([]byte("1.1.1.1:1080\n"))
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	l := New(nilLogger(t))
+	go func() {
+		_, _ = l.Load(context.Background(), []config.SourceConfig{{Type: "raw_list", URL: srv.URL}})
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		for len(l.Status()) == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("expected Status to return while a source is being fetched")
+	}
+}
+
 // nilLogger returns a no-op logger for tests.
 func nilLogger(t *testing.T) *slog.Logger {
 	t.Helper()
@@ -0,0 +1,39 @@
+package upstream
+
+import "strings"
+
+// Built-in label keys set on every upstream in addition to user-defined ones.
+const (
+	LabelType   = "type"
+	LabelName   = "name"
+	LabelSource = "source"
+)
+
+// Label keys set from the GeoIP databases when configured (see package geoip).
+const (
+	LabelCountry = "country"
+	LabelASN     = "asn"
+)
+
+// LabelSet returns the labels used to filter selection: the source's user-defined
+// labels plus type, name and source. Keys are lowercased; built-in keys win.
+func (s Spec) LabelSet() map[string]string {
+	out := make(map[string]string, len(s.Labels)+3)
+	for k, v := range s.Labels {
+		k = strings.ToLower(strings.TrimSpace(k))
+		if k == "" {
+			continue
+		}
+		out[k] = strings.TrimSpace(v)
+	}
+	if s.Type != "" {
+		out[LabelType] = string(s.Type)
+	}
+	if name := strings.TrimSpace(s.Name); name != "" {
+		out[LabelName] = name
+	}
+	if src := strings.TrimSpace(s.Source); src != "" {
+		out[LabelSource] = src
+	}
+	return out
+}
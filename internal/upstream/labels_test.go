@@ -0,0 +1,22 @@
+package upstream
+
+import "testing"
+
+func TestLabelSet_BuiltinsOverrideUserLabels(t *testing.T) {
+	s := Spec{
+		Name:   "hk-01",
+		Type:   TypeVLESS,
+		Source: "premium",
+		Labels: map[string]string{"Tier": "gold", "type": "bogus"},
+	}
+	got := s.LabelSet()
+	want := map[string]string{"tier": "gold", "type": "vless", "name": "hk-01", "source": "premium"}
+	if len(got) != len(want) {
+		t.Fatalf("unexpected labels: %v", got)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Fatalf("label %q: expected %q, got %q", k, v, got[k])
+		}
+	}
+}
@@ -24,6 +24,11 @@ type Spec struct {
 	Name string
 	Type Type
 
+	// Source is the name of the configured source the spec came from and Labels
+	// are the user-defined labels of that source. Neither affects the ID.
+	Source string
+	Labels map[string]string
+
 	Server string
 	Port   int
 
@@ -0,0 +1,124 @@
+// Package useropts parses per-request options encoded in proxy usernames, for
+// clients that can only configure a proxy URL, e.g.
+//
+//	tenantA-session-abc123-sticky-on-failover-hard-type-vless
+//
+// The leading part is the user; it is followed by "-key-value" pairs. Values
+// cannot contain '-'.
+package useropts
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Option keys. type, source and country select upstreams by label.
+const (
+	KeySession  = "session"
+	KeySticky   = "sticky"
+	KeyFailover = "failover"
+	KeyType     = "type"
+	KeySource   = "source"
+	KeyCountry  = "country"
+)
+
+// Options are the options carried by a username.
+type Options struct {
+	// User is the username without options; it is what authentication and
+	// routing rules see.
+	User string
+	// Session is the explicit session id, if any.
+	Session string
+	// Sticky overrides selection.sticky.enabled when set.
+	Sticky *bool
+	// Failover is "soft", "hard" or empty.
+	Failover string
+	// Labels restricts selection to upstreams carrying these labels.
+	Labels map[string]string
+}
+
+// SessionKey is the sticky session key for the username: the user plus the
+// session id if one is given, so sessions of different users never collide.
+func (o Options) SessionKey() string {
+	if o.Session == "" {
+		return o.User
+	}
+	return o.User + "-" + KeySession + "-" + o.Session
+}
+
+func isKey(s string) bool {
+	switch s {
+	case KeySession, KeySticky, KeyFailover, KeyType, KeySource, KeyCountry:
+		return true
+	}
+	return false
+}
+
+// Parse splits username into the user and its options. The user part ends at the
+// first option key from which the rest of the username consists of key-value
+// pairs, so hyphenated usernames without options are returned unchanged.
+// Invalid values of recognized keys are errors.
+func Parse(username string) (Options, error) {
+	username = strings.TrimSpace(username)
+	tokens := strings.Split(username, "-")
+	start := -1
+	for i := 1; i < len(tokens); i++ {
+		if pairs(tokens[i:]) {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		return Options{User: username}, nil
+	}
+
+	o := Options{User: strings.Join(tokens[:start], "-")}
+	for i := start; i < len(tokens); i += 2 {
+		k, v := strings.ToLower(tokens[i]), tokens[i+1]
+		switch k {
+		case KeySession:
+			o.Session = v
+		case KeySticky:
+			b, ok := parseBool(v)
+			if !ok {
+				return Options{}, fmt.Errorf("username option sticky: invalid value %q (use on/off)", v)
+			}
+			o.Sticky = &b
+		case KeyFailover:
+			v = strings.ToLower(v)
+			if v != "soft" && v != "hard" {
+				return Options{}, fmt.Errorf("username option failover: invalid value %q (use soft/hard)", v)
+			}
+			o.Failover = v
+		default:
+			if o.Labels == nil {
+				o.Labels = make(map[string]string)
+			}
+			o.Labels[k] = v
+		}
+	}
+	return o, nil
+}
+
+// pairs reports whether tokens are key-value pairs with known keys and non-empty values.
+func pairs(tokens []string) bool {
+	if len(tokens) == 0 || len(tokens)%2 != 0 {
+		return false
+	}
+	for i := 0; i < len(tokens); i += 2 {
+		if !isKey(strings.ToLower(tokens[i])) || tokens[i+1] == "" {
+			return false
+		}
+	}
+	return true
+}
+
+func parseBool(v string) (bool, bool) {
+	switch strings.ToLower(v) {
+	case "1", "true", "on", "yes":
+		return true, true
+	case "0", "false", "off", "no":
+		return false, true
+	}
+	return false, false
+}
@@ -0,0 +1,48 @@
+package useropts
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	t.Run("full", func(t *testing.T) {
+		o, err := Parse("tenantA-session-abc123-sticky-on-failover-hard-type-vless")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if o.User != "tenantA" || o.Session != "abc123" || o.Sticky == nil || !*o.Sticky || o.Failover != "hard" {
+			t.Fatalf("unexpected options: %+v", o)
+		}
+		if len(o.Labels) != 1 || o.Labels["type"] != "vless" {
+			t.Fatalf("unexpected labels: %v", o.Labels)
+		}
+		if got := o.SessionKey(); got != "tenantA-session-abc123" {
+			t.Fatalf("unexpected session key: %q", got)
+		}
+	})
+
+	t.Run("hyphenated_user", func(t *testing.T) {
+		o, err := Parse("team-a-source-premium-country-us")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if o.User != "team-a" || o.Labels["source"] != "premium" || o.Labels["country"] != "us" || o.SessionKey() != "team-a" {
+			t.Fatalf("unexpected options: %+v", o)
+		}
+	})
+
+	t.Run("plain", func(t *testing.T) {
+		for _, name := range []string{"alice", "sess-1", "john-doe-smith", "a-session", "a-type-"} {
+			o, err := Parse(name)
+			if err != nil || o.User != name || o.Session != "" || o.Sticky != nil || o.Labels != nil {
+				t.Fatalf("%q: expected plain username, got %+v, %v", name, o, err)
+			}
+		}
+	})
+
+	t.Run("invalid_values", func(t *testing.T) {
+		for _, name := range []string{"u-sticky-maybe", "u-failover-never"} {
+			if _, err := Parse(name); err == nil {
+				t.Fatalf("%q: expected error", name)
+			}
+		}
+	})
+}
@@ -67,6 +67,11 @@ func Generate(specs []upstream.Spec, opt GenerateOptions) (Generated, error) {
 			gen.Skipped[string(s.Type)]++
 			continue
 		}
+		// STRICT pools must never trust an unverified upstream TLS session.
+		if opt.Mode == ModeStrict && skipsCertVerify(s) {
+			gen.Skipped[string(s.Type)]++
+			continue
+		}
 		nodes = append(nodes, s)
 	}
 
@@ -165,12 +170,17 @@ func Generate(specs []upstream.Spec, opt GenerateOptions) (Generated, error) {
 	if err != nil {
 		return Generated{}, fmt.Errorf("marshal xray config: %w", err)
 	}
-	sum := sha256.Sum256(raw)
-	gen.Hash = hex.EncodeToString(sum[:])[:12]
+	gen.Hash = ConfigHash(raw)
 	gen.ConfigJSON = raw
 	return gen, nil
 }
 
+// ConfigHash returns the short hash Generate assigns to a rendered config.
+func ConfigHash(raw []byte) string {
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:])[:12]
+}
+
 func buildOutbound(s upstream.Spec, mode Mode) (map[string]any, bool) {
 	switch s.Type {
 	case upstream.TypeSOCKS5:
@@ -313,6 +323,19 @@ func buildOutbound(s upstream.Spec, mode Mode) (map[string]any, bool) {
 	}
 }
 
+func skipsCertVerify(s upstream.Spec) bool {
+	switch s.Type {
+	case upstream.TypeVMess:
+		return s.VMess != nil && s.VMess.TLS && s.VMess.SkipCertVerify
+	case upstream.TypeVLESS:
+		return s.VLESS != nil && s.VLESS.TLS && s.VLESS.SkipCertVerify
+	case upstream.TypeTrojan:
+		return s.Trojan != nil && s.Trojan.SkipCertVerify
+	default:
+		return false
+	}
+}
+
 func buildStreamSettings(tlsEnabled bool, skipCertVerify bool, serverName string, network string, wsPath string, headers map[string]string, mode Mode) map[string]any {
 	network = strings.ToLower(strings.TrimSpace(network))
 	if network == "" {
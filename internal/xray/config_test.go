@@ -87,3 +87,55 @@ func TestGenerate_MaxNodes(t *testing.T) {
 		t.Fatalf("expected max_nodes error")
 	}
 }
+
+func TestGenerate_StrictSkipsInsecureTLS(t *testing.T) {
+	specs := []upstream.Spec{
+		upstream.Spec{
+			Type:   upstream.TypeTrojan,
+			Server: "example.com",
+			Port:   443,
+			Trojan: &upstream.TrojanConfig{
+				Password:       "pw",
+				TLS:            true,
+				SkipCertVerify: true,
+			},
+		}.Normalize(),
+		upstream.Spec{
+			Type:   upstream.TypeTrojan,
+			Server: "example.org",
+			Port:   443,
+			Trojan: &upstream.TrojanConfig{
+				Password: "pw",
+				TLS:      true,
+			},
+		}.Normalize(),
+	}
+	opt := GenerateOptions{
+		SOCKSListen:   "127.0.0.1:17384",
+		MetricsListen: "127.0.0.1:17388",
+		UserPassword:  "pw",
+		MaxNodes:      10,
+		Observatory: config.ObservatoryConfig{
+			Mode:        "burst",
+			Destination: "https://www.gstatic.com/generate_204",
+		},
+	}
+
+	opt.Mode = ModeStrict
+	strict, err := Generate(specs, opt)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(strict.Included) != 1 || strict.Skipped["trojan"] != 1 {
+		t.Fatalf("expected insecure node skipped in strict mode, got included=%v skipped=%v", strict.Included, strict.Skipped)
+	}
+
+	opt.Mode = ModeRelaxed
+	relaxed, err := Generate(specs, opt)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(relaxed.Included) != 2 {
+		t.Fatalf("expected both nodes in relaxed mode, got %v", relaxed.Included)
+	}
+}
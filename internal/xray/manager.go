@@ -128,6 +128,32 @@ func (i *Instance) Ensure(ctx context.Context, configJSON []byte, hash string) e
 	return nil
 }
 
+// Hash returns the hash of the config the running process was started with, or
+// "" when xray is not running.
+func (i *Instance) Hash() string {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.proc == nil {
+		return ""
+	}
+	return i.lastHash
+}
+
+// Resume starts xray from the config file left in work_dir by a previous run,
+// provided it still matches hash. It lets a warm start serve traffic before the
+// first refresh regenerates (usually the same) config.
+func (i *Instance) Resume(ctx context.Context, hash string) error {
+	configPath := filepath.Join(i.workDir, fmt.Sprintf("xray-%s.json", i.mode))
+	raw, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("read xray config: %w", err)
+	}
+	if got := ConfigHash(raw); got != hash {
+		return fmt.Errorf("xray config hash mismatch: have %s, want %s", got, hash)
+	}
+	return i.Ensure(ctx, raw, hash)
+}
+
 func (i *Instance) Stop(ctx context.Context) error {
 	i.mu.Lock()
 	defer i.mu.Unlock()
@@ -130,3 +130,33 @@ func (p *fakeProcess) Kill() error {
 	return nil
 }
 
+func TestInstance_Resume_RequiresMatchingHash(t *testing.T) {
+	socksAddr := allocAddr(t)
+	metricsAddr := allocAddr(t)
+	dir := t.TempDir()
+
+	var starts atomic.Int32
+	r := &fakeRunner{socksListen: socksAddr, metricsListen: metricsAddr, starts: &starts}
+	newInst := func() *Instance {
+		return NewInstance(slog.New(slog.NewTextHandler(io.Discard, nil)), ModeRelaxed, "/bin/false", dir, socksAddr, metricsAddr, 2*time.Second, r)
+	}
+
+	raw := []byte(`{"log":{}}`)
+	first := newInst()
+	if err := first.Ensure(context.Background(), raw, ConfigHash(raw)); err != nil {
+		t.Fatalf("ensure: %v", err)
+	}
+	_ = first.Stop(context.Background())
+
+	second := newInst()
+	if err := second.Resume(context.Background(), "deadbeef0000"); err == nil {
+		t.Fatalf("expected hash mismatch error")
+	}
+	if err := second.Resume(context.Background(), ConfigHash(raw)); err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+	if got := starts.Load(); got != 2 {
+		t.Fatalf("expected starts=2, got %d", got)
+	}
+	_ = second.Stop(context.Background())
+}